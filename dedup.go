@@ -0,0 +1,192 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btclog
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultDedupWindow is the default duration within which consecutive
+// identical log messages are collapsed.
+const DefaultDedupWindow = 30 * time.Second
+
+// WithDedup configures a Backend to collapse consecutive identical log
+// messages, that is messages with the same level, subsystem tag and text, that
+// are written within the given window of each other.  Once such a run ends,
+// either because a different message is written or because no repeat has been
+// seen for the duration of the window, a single "last message repeated N
+// times" message is written in its place, as syslog does.  A window of zero
+// uses DefaultDedupWindow.
+func WithDedup(window time.Duration) BackendOption {
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	return func(b *Backend) {
+		b.dedup = &dedup{window: window}
+	}
+}
+
+// SuppressedDuplicates returns the total number of log messages that were not
+// written because they repeated the previous message.  It is always zero if
+// the Backend was not created with WithDedup.
+func (b *Backend) SuppressedDuplicates() uint64 {
+	if b.dedup == nil {
+		return 0
+	}
+
+	b.dedup.mu.Lock()
+	defer b.dedup.mu.Unlock()
+
+	return b.dedup.suppressed
+}
+
+// dedup holds the state used by a Backend to collapse consecutive identical
+// log messages.
+type dedup struct {
+	window time.Duration
+
+	mu sync.Mutex
+
+	// lvl, tag and msg identify the last message that was written.
+	lvl string
+	tag string
+	msg []byte
+
+	// last is the time at which the last message was seen, whether it was
+	// written or suppressed.
+	last time.Time
+
+	// repeats is the number of times that the last message has been
+	// suppressed in the current run.
+	repeats uint64
+
+	// suppressed is the total number of suppressed messages.
+	suppressed uint64
+
+	// timer writes the summary of the current run once no repeat has been
+	// seen for the duration of the window, which is the case once due has
+	// passed.  run identifies the current run so that a timer of an earlier
+	// run that fires late doesn't end it.
+	timer *time.Timer
+	due   time.Time
+	run   uint64
+}
+
+// write writes the formatted log message held in buf, with the text of the
+// message starting at msgStart, unless it repeats the last message.  Any error
+// returned by the Backend's Writer is returned so that it can be reported once
+// the mutex has been released.
+func (d *dedup) write(b *Backend, t time.Time, lvl, tag string, buf []byte,
+	msgStart int) error {
+
+	msg := buf[msgStart:]
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.lvl == lvl && d.tag == tag && bytes.Equal(d.msg, msg) &&
+		t.Sub(d.last) < d.window {
+
+		d.repeats++
+		d.suppressed++
+		d.last = t
+
+		d.due = time.Now().Add(d.window)
+		if d.timer == nil {
+			run := d.run
+			d.timer = time.AfterFunc(d.window, func() {
+				b.reportErr(d.expire(b, run))
+			})
+		} else {
+			d.timer.Reset(d.window)
+		}
+
+		return nil
+	}
+
+	flushErr := d.flush(b)
+
+	d.lvl = lvl
+	d.tag = tag
+	d.msg = append(d.msg[:0], msg...)
+	d.last = t
+
+	if err := b.write(buf); err != nil {
+		return err
+	}
+
+	return flushErr
+}
+
+// writeRaw writes the summary of the current run of repeated messages, if any,
+// followed by p, which is not considered for collapsing.  Any error returned
+// by the Backend's Writer is returned so that it can be reported once the
+// mutex has been released.
+func (d *dedup) writeRaw(b *Backend, p []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	flushErr := d.flush(b)
+
+	// The line ends the run, so a repeat of the last message is written.
+	d.msg = d.msg[:0]
+	d.lvl = ""
+
+	if err := b.write(p); err != nil {
+		return err
+	}
+
+	return flushErr
+}
+
+// expire writes the summary of the given run of repeated messages once its
+// timer has fired.  Nothing is written if the timer is stale, which is the case
+// if the run has already ended or if the timer was reset by another repeat
+// while it was waiting for the mutex.
+func (d *dedup) expire(b *Backend, run uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.run != run || time.Now().Before(d.due) {
+		return nil
+	}
+
+	return d.flush(b)
+}
+
+// flush writes the summary of the current run of repeated messages, if any.
+//
+// NOTE: the caller must hold the mutex.
+func (d *dedup) flush(b *Backend) error {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+
+	if d.repeats == 0 {
+		return nil
+	}
+	d.run++
+
+	bytebuf := buffer()
+	formatHeader(bytebuf, time.Now(), d.lvl, d.tag, "", 0)
+	*bytebuf = append(*bytebuf, "last message repeated "...)
+	*bytebuf = strconv.AppendUint(*bytebuf, d.repeats, 10)
+	*bytebuf = append(*bytebuf, " times\n"...)
+	err := b.write(*bytebuf)
+	recycleBuffer(bytebuf)
+
+	d.repeats = 0
+
+	// The summary ends the run, so the next message is always written.
+	d.msg = d.msg[:0]
+	d.lvl = ""
+
+	return err
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btclog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDedup tests that consecutive identical messages are collapsed by a
+// Backend created with WithDedup and that a summary message is written when
+// the run ends.
+func TestDedup(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	backend := NewBackend(&buf, WithDedup(time.Hour))
+	log := backend.Logger("PEER")
+	srvrLog := backend.Logger("SRVR")
+
+	for i := 0; i < 4; i++ {
+		log.Infof("Reconnecting to %s", "1.2.3.4")
+	}
+
+	// Messages that differ in their text, level or subsystem are not
+	// collapsed.
+	log.Info("Reconnecting to 5.6.7.8")
+	log.Warn("Reconnecting to 5.6.7.8")
+	srvrLog.Warn("Reconnecting to 5.6.7.8")
+	srvrLog.Warn("Reconnecting to 5.6.7.8")
+
+	// A line written directly to the Backend ends the run after its
+	// summary.
+	if _, err := backend.Write([]byte("raw line\n")); err != nil {
+		t.Fatalf("Unable to write: %v", err)
+	}
+	srvrLog.Warn("Reconnecting to 5.6.7.8")
+
+	expectedLog := `[INF] PEER: Reconnecting to 1.2.3.4
+[INF] PEER: last message repeated 3 times
+[INF] PEER: Reconnecting to 5.6.7.8
+[WRN] PEER: Reconnecting to 5.6.7.8
+[WRN] SRVR: Reconnecting to 5.6.7.8
+[WRN] SRVR: last message repeated 1 times
+`
+	got := buf.String()
+	raw := bytes.Index(buf.Bytes(), []byte("raw line\n"))
+	if raw < 0 {
+		t.Fatalf("Expected raw line, got %q", got)
+	}
+	if s := stripTimestamps(t, got[:raw]); s != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, s)
+	}
+
+	expectedLog = "[WRN] SRVR: Reconnecting to 5.6.7.8\n"
+	if s := stripTimestamps(t, got[raw+len("raw line\n"):]); s != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, s)
+	}
+
+	if backend.SuppressedDuplicates() != 4 {
+		t.Fatalf("Expected 4 suppressed messages, got %d",
+			backend.SuppressedDuplicates())
+	}
+}
+
+// TestDedupTimer tests that the summary message is written once no repeat has
+// been seen for the duration of the window.
+func TestDedupTimer(t *testing.T) {
+	t.Parallel()
+
+	// The summary is written from a timer, so the output is only read
+	// through the Backend's mutex.
+	var buf bytes.Buffer
+	backend := NewBackend(&buf, WithDedup(10*time.Millisecond))
+	log := backend.Logger("TEST")
+
+	log.Info("Reconnecting")
+	log.Info("Reconnecting")
+
+	output := func() string {
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+
+		return buf.String()
+	}
+
+	expectedLog := `[INF] TEST: Reconnecting
+[INF] TEST: last message repeated 1 times
+`
+	deadline := time.Now().Add(5 * time.Second)
+	for stripTimestamps(t, output()) != expectedLog {
+		if time.Now().After(deadline) {
+			t.Fatalf("Log result mismatch. Expected \n\"%s\", "+
+				"got \n\"%s\"", expectedLog, output())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestDedupStaleTimer tests that a timer that fires once its run has ended, or
+// before a repeat that reset it is a window old, doesn't end the current run.
+func TestDedupStaleTimer(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	backend := NewBackend(&buf, WithDedup(time.Hour))
+	log := backend.Logger("TEST")
+
+	log.Info("Reconnecting")
+	log.Info("Reconnecting")
+	staleRun := backend.dedup.run
+
+	log.Info("Connected")
+	log.Info("Connected")
+	currentRun := backend.dedup.run
+
+	for _, run := range []uint64{staleRun, currentRun} {
+		if err := backend.dedup.expire(backend, run); err != nil {
+			t.Fatalf("Unable to expire run: %v", err)
+		}
+	}
+
+	expectedLog := `[INF] TEST: Reconnecting
+[INF] TEST: last message repeated 1 times
+[INF] TEST: Connected
+`
+	if s := stripTimestamps(t, buf.String()); s != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, s)
+	}
+}
+
+// rejectWriter is an io.Writer that fails to write anything that contains its
+// reject string.
+type rejectWriter struct {
+	bytes.Buffer
+	reject string
+}
+
+// Write writes p to the buffer or returns errDiskFull if it contains the
+// reject string.
+func (w *rejectWriter) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), w.reject) {
+		return 0, errDiskFull
+	}
+
+	return w.Buffer.Write(p)
+}
+
+// TestDedupWriteError tests that a message that ends a run is still written
+// and starts a new run if the summary can't be written.
+func TestDedupWriteError(t *testing.T) {
+	t.Parallel()
+
+	var errs []error
+	w := &rejectWriter{reject: "repeated"}
+	backend := NewBackend(
+		w, WithDedup(time.Hour), WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)
+	log := backend.Logger("TEST")
+
+	log.Info("Reconnecting")
+	log.Info("Reconnecting")
+	log.Info("Connected")
+	log.Info("Connected")
+
+	expectedLog := `[INF] TEST: Reconnecting
+[INF] TEST: Connected
+`
+	if got := stripTimestamps(t, w.String()); got != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, got)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], errDiskFull) {
+		t.Fatalf("Expected a disk full error, got %v", errs)
+	}
+	if backend.SuppressedDuplicates() != 2 {
+		t.Fatalf("Expected 2 suppressed messages, got %d",
+			backend.SuppressedDuplicates())
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btclog
+
+import (
+	"sync"
+	"time"
+)
+
+// LevelElevator is implemented by loggers whose level can be elevated
+// temporarily, such as the loggers returned by (*Backend).Logger.
+type LevelElevator interface {
+	// ElevateLevel lowers the logging level of the logger to the passed
+	// level, if it is more verbose than the current level, until the
+	// returned restore function is called.
+	ElevateLevel(level Level) (restore func())
+
+	// SetLevelFor lowers the logging level of the logger to the passed
+	// level, if it is more verbose than the current level, for the given
+	// duration or until the returned restore function is called.
+	SetLevelFor(level Level, d time.Duration) (restore func())
+}
+
+// LevelElevations tracks the temporary level elevations of a Logger so that
+// they are reverted correctly when they overlap.  While elevations are active,
+// the level of the logger is the most verbose of its base level and the levels
+// of all active elevations.  Once an elevation ends, the level is recomputed
+// from the remaining ones and, once all have ended, the base level is restored.
+// If the level of the logger is changed with SetLevel while elevations are
+// active, the new level becomes the base level.
+//
+// When an elevation created with ElevateFor expires, a message is logged at the
+// info level before the level is reverted so that operators can see when the
+// additional output stops.
+type LevelElevations struct {
+	logger Logger
+
+	mu sync.Mutex
+
+	// base is the level of the logger without any elevations and applied
+	// is the level that was last set on the logger.
+	base    Level
+	applied Level
+
+	// active holds the active elevations in the order they were created.
+	active []*elevation
+}
+
+// elevation is a single temporary level elevation.
+type elevation struct {
+	level Level
+	once  sync.Once
+	timer *time.Timer
+}
+
+// NewLevelElevations creates a new LevelElevations for the given logger.  Only
+// a single LevelElevations should be used for each logger.
+func NewLevelElevations(logger Logger) *LevelElevations {
+	return &LevelElevations{logger: logger}
+}
+
+// Elevate elevates the level of the logger to the passed level until the
+// returned restore function is called.  The restore function may be called
+// more than once.
+func (e *LevelElevations) Elevate(level Level) func() {
+	el := e.add(level)
+
+	return func() {
+		e.remove(el, false)
+	}
+}
+
+// ElevateFor elevates the level of the logger to the passed level for the
+// given duration or until the returned restore function is called.  The
+// restore function may be called more than once.
+func (e *LevelElevations) ElevateFor(level Level, d time.Duration) func() {
+	el := e.add(level)
+
+	// The timer is created while holding the mutex so that it is set
+	// before it can be stopped by the restore function.
+	e.mu.Lock()
+	el.timer = time.AfterFunc(d, func() {
+		e.remove(el, true)
+	})
+	e.mu.Unlock()
+
+	return func() {
+		e.mu.Lock()
+		el.timer.Stop()
+		e.mu.Unlock()
+
+		e.remove(el, false)
+	}
+}
+
+// add adds an elevation to the passed level and applies it.
+func (e *LevelElevations) add(level Level) *elevation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.updateBase()
+
+	el := &elevation{level: level}
+	e.active = append(e.active, el)
+	e.apply(nil)
+
+	return el
+}
+
+// remove ends the given elevation and applies the remaining ones.  If expired
+// is true, a message is logged before the level is reverted.
+func (e *LevelElevations) remove(el *elevation, expired bool) {
+	el.once.Do(func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.updateBase()
+
+		for i, a := range e.active {
+			if a == el {
+				e.active = append(e.active[:i], e.active[i+1:]...)
+				break
+			}
+		}
+
+		if expired {
+			e.apply(el)
+		} else {
+			e.apply(nil)
+		}
+	})
+}
+
+// updateBase makes the current level of the logger the base level if there are
+// no active elevations or if the level was changed since it was last applied.
+//
+// NOTE: the mutex must be held.
+func (e *LevelElevations) updateBase() {
+	if level := e.logger.Level(); len(e.active) == 0 || level != e.applied {
+		e.base = level
+	}
+}
+
+// apply sets the level of the logger to the most verbose of the base level and
+// the active elevations.  If an expired elevation is given, a message is logged
+// first.
+//
+// NOTE: the mutex must be held.
+func (e *LevelElevations) apply(expired *elevation) {
+	level := e.base
+	for _, a := range e.active {
+		if a.level.Severity() < level.Severity() {
+			level = a.level
+		}
+	}
+
+	if expired != nil {
+		e.logger.Infof("Temporary log level %v expired, log level is "+
+			"now %v", expired.level, level)
+	}
+
+	e.applied = level
+	e.logger.SetLevel(level)
+}
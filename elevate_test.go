@@ -0,0 +1,88 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btclog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestElevateLevel tests that overlapping level elevations are combined and
+// reverted correctly.
+func TestElevateLevel(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewBackend(&buf).Logger("TEST")
+	elevator := log.(LevelElevator)
+
+	assertLevel := func(expected Level) {
+		t.Helper()
+
+		if log.Level() != expected {
+			t.Fatalf("Expected level %s, got %s", expected,
+				log.Level())
+		}
+	}
+
+	// The most verbose active elevation applies, regardless of the order
+	// in which they end.
+	restoreDebug := elevator.ElevateLevel(LevelDebug)
+	restoreTrace := elevator.ElevateLevel(LevelTrace)
+	restoreWarn := elevator.ElevateLevel(LevelWarn)
+	assertLevel(LevelTrace)
+
+	restoreTrace()
+	assertLevel(LevelDebug)
+	restoreTrace()
+	assertLevel(LevelDebug)
+
+	restoreDebug()
+	assertLevel(LevelInfo)
+
+	// A level set during an elevation is restored once it ends.
+	log.SetLevel(LevelError)
+	restoreWarn()
+	assertLevel(LevelError)
+}
+
+// TestSetLevelFor tests that timed elevations are reverted once they expire
+// and that their expiry is logged.
+func TestSetLevelFor(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewBackend(&buf).Logger("TEST")
+	elevator := log.(LevelElevator)
+
+	// An elevation that is restored early does not log.
+	restore := elevator.SetLevelFor(LevelDebug, time.Hour)
+	restore()
+
+	elevator.SetLevelFor(LevelTrace, 10*time.Millisecond)
+	elevator.SetLevelFor(LevelDebug, time.Hour)
+	if log.Level() != LevelTrace {
+		t.Fatalf("Expected level trace, got %s", log.Level())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for log.Level() == LevelTrace {
+		if time.Now().After(deadline) {
+			t.Fatalf("Elevation did not expire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if log.Level() != LevelDebug {
+		t.Fatalf("Expected level debug, got %s", log.Level())
+	}
+
+	expected := "[INF] TEST: Temporary log level TRC expired, log level " +
+		"is now DBG\n"
+	if got := stripTimestamps(t, buf.String()); got != expected {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expected, got)
+	}
+}
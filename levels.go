@@ -0,0 +1,205 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btclog
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// offSeverity is the severity of LevelOff, which is above that of any level
+// that messages can be logged at.
+const offSeverity = math.MaxInt32
+
+// levelSeverities defines the severity of each built-in level.  These are the
+// levels the btclog v2 package uses for them with the log/slog package.
+var levelSeverities = [...]int{-5, -4, 0, 4, 8, 9, offSeverity}
+
+// builtinLevels holds the built-in levels that messages can be logged at in
+// order of increasing severity.
+var builtinLevels = []Level{
+	LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError, LevelCritical,
+}
+
+// customLevel describes a level registered with RegisterLevel.
+type customLevel struct {
+	name     string
+	short    string
+	severity int
+}
+
+// levelTable holds the registered levels.  It is replaced as a whole whenever
+// a level is registered so that it can be read without locking.
+type levelTable struct {
+	custom map[Level]customLevel
+	byName map[string]Level
+
+	// ordered holds all levels that messages can be logged at in order of
+	// increasing severity, and severities holds their severities.
+	ordered    []Level
+	severities []int
+}
+
+var (
+	// registerMtx serializes calls to RegisterLevel.
+	registerMtx sync.Mutex
+
+	// registered holds the current *levelTable, if any levels have been
+	// registered.
+	registered atomic.Value
+)
+
+// loadLevels returns the table of registered levels, or nil if no levels have
+// been registered.
+func loadLevels() *levelTable {
+	t, _ := registered.Load().(*levelTable)
+	return t
+}
+
+// RegisterLevel registers an additional named level, such as a notice level
+// between info and warn or a fatal level above critical, and returns it.  The
+// position of the new level relative to the others is given by its severity,
+// which uses the scale of the log/slog package: the built-in levels from trace
+// to critical have the severities -5, -4, 0, 4, 8 and 9.  The short name is used
+// in log output and should therefore have three characters like the names of
+// the built-in levels.  Both names are accepted by LevelFromString regardless
+// of case.
+//
+// Levels should be registered during initialization, before loggers are
+// configured to use them.  An error is returned if either name or the severity
+// is already used by another level.
+func RegisterLevel(name, short string, severity int) (Level, error) {
+	registerMtx.Lock()
+	defer registerMtx.Unlock()
+
+	if name == "" || short == "" {
+		return LevelOff, fmt.Errorf("level names must not be empty")
+	}
+	if severity >= offSeverity {
+		return LevelOff, fmt.Errorf("level severity %d is not below the "+
+			"severity of the off level", severity)
+	}
+	for _, n := range []string{name, short} {
+		if l, ok := LevelFromString(n); ok {
+			return LevelOff, fmt.Errorf("level name %q is already "+
+				"used by level %v", n, l)
+		}
+	}
+
+	next := &levelTable{
+		custom:     make(map[Level]customLevel),
+		byName:     make(map[string]Level),
+		ordered:    builtinLevels,
+		severities: levelSeverities[:len(builtinLevels)],
+	}
+	if t := loadLevels(); t != nil {
+		for l, c := range t.custom {
+			next.custom[l] = c
+		}
+		for n, l := range t.byName {
+			next.byName[n] = l
+		}
+		next.ordered = t.ordered
+		next.severities = t.severities
+	}
+	for i, s := range next.severities {
+		if s == severity {
+			return LevelOff, fmt.Errorf("level severity %d is already "+
+				"used by level %v", severity, next.ordered[i])
+		}
+	}
+
+	level := LevelOff + 1 + Level(len(next.custom))
+	next.custom[level] = customLevel{
+		name:     name,
+		short:    short,
+		severity: severity,
+	}
+	next.byName[strings.ToLower(name)] = level
+	next.byName[strings.ToLower(short)] = level
+
+	// Insert the new level in order of severity, copying the slices since
+	// they may still be used by readers of the previous table.
+	i := sort.SearchInts(next.severities, severity)
+	ordered := make([]Level, 0, len(next.ordered)+1)
+	ordered = append(ordered, next.ordered[:i]...)
+	ordered = append(ordered, level)
+	next.ordered = append(ordered, next.ordered[i:]...)
+	severities := make([]int, 0, len(next.severities)+1)
+	severities = append(severities, next.severities[:i]...)
+	severities = append(severities, severity)
+	next.severities = append(severities, next.severities[i:]...)
+
+	registered.Store(next)
+
+	return level, nil
+}
+
+// lookupLevel returns the registered level with the given lowercase name or
+// short name.
+func lookupLevel(name string) (Level, bool) {
+	t := loadLevels()
+	if t == nil {
+		return LevelInfo, false
+	}
+
+	l, ok := t.byName[name]
+	if !ok {
+		return LevelInfo, false
+	}
+	return l, true
+}
+
+// Severity returns the severity of the level, which orders the built-in and
+// registered levels.  Levels with a higher severity are less verbose.  The
+// severity of an unknown level is that of LevelOff.
+func (l Level) Severity() int {
+	if l <= LevelOff {
+		return levelSeverities[l]
+	}
+
+	if t := loadLevels(); t != nil {
+		if c, ok := t.custom[l]; ok {
+			return c.severity
+		}
+	}
+	return offSeverity
+}
+
+// LevelForSeverity returns the most severe level whose severity doesn't exceed
+// the given severity, or the least severe level if the severity is below that
+// of all levels.  This maps arbitrary severities, such as the levels of records
+// logged through the log/slog package, to the closest level.
+func LevelForSeverity(severity int) Level {
+	if severity >= offSeverity {
+		return LevelOff
+	}
+
+	ordered := builtinLevels
+	severities := levelSeverities[:len(builtinLevels)]
+	if t := loadLevels(); t != nil {
+		ordered = t.ordered
+		severities = t.severities
+	}
+
+	i := sort.SearchInts(severities, severity+1)
+	if i == 0 {
+		return ordered[0]
+	}
+	return ordered[i-1]
+}
+
+// enables returns true if a logger at level l writes messages at the given
+// level.
+func (l Level) enables(level Level) bool {
+	if l <= LevelOff && level <= LevelOff {
+		return l <= level
+	}
+	return l.Severity() <= level.Severity()
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btclog
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The levels registered for the tests.  Registered levels are global and can
+// only be registered once, so this is done during initialization.
+var (
+	levelNotice = mustRegisterLevel("notice", "NTC", 2)
+	levelFatal  = mustRegisterLevel("fatal", "FTL", 12)
+)
+
+// mustRegisterLevel registers a level and panics if that fails.
+func mustRegisterLevel(name, short string, severity int) Level {
+	l, err := RegisterLevel(name, short, severity)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// TestRegisterLevel tests that registered levels can be parsed and printed and
+// that invalid registrations are rejected.
+func TestRegisterLevel(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"notice", "NTC", "Notice"} {
+		if l, ok := LevelFromString(s); !ok || l != levelNotice {
+			t.Fatalf("Expected notice level for %q, got %s", s, l)
+		}
+	}
+	if l, ok := LevelFromString("ftl"); !ok || l != levelFatal {
+		t.Fatalf("Expected fatal level, got %s", l)
+	}
+	if _, ok := LevelFromString("unknown"); ok {
+		t.Fatalf("Expected unknown level to be rejected")
+	}
+
+	if levelNotice.String() != "NTC" || levelFatal.String() != "FTL" {
+		t.Fatalf("Unexpected level names %s and %s", levelNotice,
+			levelFatal)
+	}
+	if levelNotice.Severity() != 2 || levelFatal.Severity() != 12 {
+		t.Fatalf("Unexpected severities %d and %d",
+			levelNotice.Severity(), levelFatal.Severity())
+	}
+	if LevelInfo.Severity() != 0 || LevelCritical.Severity() != 9 {
+		t.Fatalf("Unexpected built-in severities %d and %d",
+			LevelInfo.Severity(), LevelCritical.Severity())
+	}
+
+	tests := []struct {
+		name     string
+		short    string
+		severity int
+	}{
+		{name: "", short: "NEW", severity: 1},
+		{name: "new", short: "", severity: 1},
+		{name: "info", short: "NEW", severity: 1},
+		{name: "new", short: "NTC", severity: 1},
+		{name: "new", short: "NEW", severity: 4},
+		{name: "new", short: "NEW", severity: 2},
+		{name: "new", short: "NEW", severity: offSeverity},
+	}
+	for _, test := range tests {
+		_, err := RegisterLevel(test.name, test.short, test.severity)
+		if err == nil {
+			t.Fatalf("Expected error registering %q, %q at %d",
+				test.name, test.short, test.severity)
+		}
+	}
+}
+
+// TestLevelForSeverity tests that severities are mapped to the most severe
+// level that doesn't exceed them.
+func TestLevelForSeverity(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		severity int
+		expected Level
+	}{
+		{severity: -10, expected: LevelTrace},
+		{severity: -5, expected: LevelTrace},
+		{severity: -3, expected: LevelDebug},
+		{severity: 1, expected: LevelInfo},
+		{severity: 2, expected: levelNotice},
+		{severity: 3, expected: levelNotice},
+		{severity: 4, expected: LevelWarn},
+		{severity: 8, expected: LevelError},
+		{severity: 10, expected: LevelCritical},
+		{severity: 12, expected: levelFatal},
+		{severity: 100, expected: levelFatal},
+		{severity: offSeverity, expected: LevelOff},
+	}
+
+	for _, test := range tests {
+		if l := LevelForSeverity(test.severity); l != test.expected {
+			t.Fatalf("Level mismatch for %d. Expected %s, got %s",
+				test.severity, test.expected, l)
+		}
+	}
+}
+
+// TestLevelEnables tests that loggers set to a registered level write the
+// messages at or above its severity.
+func TestLevelEnables(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		level    Level
+		msgLevel Level
+		expected bool
+	}{
+		{level: LevelInfo, msgLevel: LevelDebug, expected: false},
+		{level: LevelInfo, msgLevel: LevelInfo, expected: true},
+		{level: levelNotice, msgLevel: LevelInfo, expected: false},
+		{level: levelNotice, msgLevel: levelNotice, expected: true},
+		{level: levelNotice, msgLevel: LevelWarn, expected: true},
+		{level: LevelWarn, msgLevel: levelNotice, expected: false},
+		{level: levelFatal, msgLevel: LevelCritical, expected: false},
+		{level: LevelCritical, msgLevel: levelFatal, expected: true},
+		{level: LevelOff, msgLevel: levelFatal, expected: false},
+		{level: LevelOff, msgLevel: LevelCritical, expected: false},
+	}
+
+	for _, test := range tests {
+		if test.level.enables(test.msgLevel) != test.expected {
+			t.Fatalf("Expected %s enabling %s to be %v", test.level,
+				test.msgLevel, test.expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	log := NewBackend(&buf).Logger("TEST")
+	log.SetLevel(levelNotice)
+	log.Info("Hidden")
+	log.Warn("Warning")
+
+	if !bytes.HasSuffix(buf.Bytes(), []byte("[WRN] TEST: Warning\n")) ||
+		bytes.Count(buf.Bytes(), []byte("\n")) != 1 {
+
+		t.Fatalf("Unexpected output %q", buf.Bytes())
+	}
+}
@@ -92,9 +92,9 @@ const (
 // levelStrs defines the human-readable names for each logging level.
 var levelStrs = [...]string{"TRC", "DBG", "INF", "WRN", "ERR", "CRT", "OFF"}
 
-// LevelFromString returns a level based on the input string s.  If the input
-// can't be interpreted as a valid log level, the info level and false is
-// returned.
+// LevelFromString returns a level based on the input string s, which may also
+// be either name of a level registered with RegisterLevel.  If the input can't
+// be interpreted as a valid log level, the info level and false is returned.
 func LevelFromString(s string) (l Level, ok bool) {
 	switch strings.ToLower(s) {
 	case "trace", "trc":
@@ -112,17 +112,24 @@ func LevelFromString(s string) (l Level, ok bool) {
 	case "off":
 		return LevelOff, true
 	default:
-		return LevelInfo, false
+		return lookupLevel(strings.ToLower(s))
 	}
 }
 
 // String returns the tag of the logger used in log messages, or "OFF" if
-// the level will not produce any log output.
+// the level will not produce any log output.  The tag of a level registered
+// with RegisterLevel is its short name.
 func (l Level) String() string {
-	if l >= LevelOff {
-		return "OFF"
+	if l < LevelOff {
+		return levelStrs[l]
+	}
+
+	if t := loadLevels(); t != nil {
+		if c, ok := t.custom[l]; ok {
+			return c.short
+		}
 	}
-	return levelStrs[l]
+	return "OFF"
 }
 
 // NewBackend creates a logger backend from a Writer.
@@ -138,9 +145,20 @@ func NewBackend(w io.Writer, opts ...BackendOption) *Backend {
 // the backend's Writer.  Backend provides atomic writes to the Writer from all
 // subsystems.
 type Backend struct {
+	failedWrites uint64 // atomic, first for 64-bit alignment
+
 	w    io.Writer
 	mu   sync.Mutex // ensures atomic writes
 	flag uint32
+
+	// fallback is written to when a write to w fails.
+	fallback io.Writer
+
+	// errHandler is called with any error returned by w.
+	errHandler func(error)
+
+	// dedup, if set, collapses consecutive identical log messages.
+	dedup *dedup
 }
 
 // BackendOption is a function used to modify the behavior of a Backend.
@@ -155,6 +173,58 @@ func WithFlags(flags uint32) BackendOption {
 	}
 }
 
+// WithErrorHandler configures a Backend to call fn with any error returned by
+// its Writer when writing a log message.  The call-back may itself log.
+func WithErrorHandler(fn func(error)) BackendOption {
+	return func(b *Backend) {
+		b.errHandler = fn
+	}
+}
+
+// WithFallbackWriter configures a Backend to write log messages to w, such as
+// os.Stderr, if writing them to its Writer fails.  Each message is first
+// attempted on the Backend's Writer so that logging returns to it as soon as it
+// recovers.
+func WithFallbackWriter(w io.Writer) BackendOption {
+	return func(b *Backend) {
+		b.fallback = w
+	}
+}
+
+// Flags returns the flags that the Backend was configured with.
+func (b *Backend) Flags() uint32 {
+	return b.flag
+}
+
+// Write writes a fully formatted log line to the Backend's Writer.  It is
+// serialized with the writes of all subsystem loggers of the Backend and is
+// subject to the same error handling.  This allows other loggers to share the
+// Backend's Writer.  Lines written with Write are not collapsed by WithDedup,
+// but they end the current run of repeated messages, so that its summary is
+// written before them.
+//
+// This is part of the io.Writer interface implementation.
+func (b *Backend) Write(p []byte) (int, error) {
+	var err error
+	if b.dedup != nil {
+		err = b.dedup.writeRaw(b, p)
+	} else {
+		err = b.write(p)
+	}
+	b.reportErr(err)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// FailedWrites returns the number of log messages that could not be written to
+// the Backend's Writer.
+func (b *Backend) FailedWrites() uint64 {
+	return atomic.LoadUint64(&b.failedWrites)
+}
+
 // bufferPool defines a concurrent safe free list of byte slices used to provide
 // temporary buffers for formatting log messages prior to outputting them.
 var bufferPool = sync.Pool{
@@ -274,13 +344,12 @@ func (b *Backend) print(lvl, tag string, args ...interface{}) {
 	}
 
 	formatHeader(bytebuf, t, lvl, tag, file, line)
+	msgStart := len(*bytebuf)
 	buf := bytes.NewBuffer(*bytebuf)
 	fmt.Fprintln(buf, args...)
 	*bytebuf = buf.Bytes()
 
-	b.mu.Lock()
-	b.w.Write(*bytebuf)
-	b.mu.Unlock()
+	b.output(t, lvl, tag, *bytebuf, msgStart)
 
 	recycleBuffer(bytebuf)
 }
@@ -301,29 +370,84 @@ func (b *Backend) printf(lvl, tag string, format string, args ...interface{}) {
 	}
 
 	formatHeader(bytebuf, t, lvl, tag, file, line)
+	msgStart := len(*bytebuf)
 	buf := bytes.NewBuffer(*bytebuf)
 	fmt.Fprintf(buf, format, args...)
 	*bytebuf = append(buf.Bytes(), '\n')
 
-	b.mu.Lock()
-	b.w.Write(*bytebuf)
-	b.mu.Unlock()
+	b.output(t, lvl, tag, *bytebuf, msgStart)
 
 	recycleBuffer(bytebuf)
 }
 
+// output writes the formatted log message held in buf, with the text of the
+// message starting at msgStart, to the writer associated with the backend,
+// collapsing repeated messages if configured to do so.  Any write error is
+// reported to the error handler once all locks have been released so that the
+// handler may itself log.
+func (b *Backend) output(t time.Time, lvl, tag string, buf []byte,
+	msgStart int) {
+
+	var err error
+	if b.dedup != nil {
+		err = b.dedup.write(b, t, lvl, tag, buf, msgStart)
+	} else {
+		err = b.write(buf)
+	}
+
+	b.reportErr(err)
+}
+
+// write writes a formatted log message to the writer associated with the
+// backend.  If the write fails, the failure is counted and the message is
+// written to the fallback writer, if any.  The error from the writer is
+// returned.
+func (b *Backend) write(p []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, err := b.w.Write(p)
+	if err != nil {
+		atomic.AddUint64(&b.failedWrites, 1)
+		if b.fallback != nil {
+			b.fallback.Write(p)
+		}
+	}
+
+	return err
+}
+
+// reportErr passes the given error, if any, to the error handler, if any.
+func (b *Backend) reportErr(err error) {
+	if err != nil && b.errHandler != nil {
+		b.errHandler(err)
+	}
+}
+
 // Logger returns a new logger for a particular subsystem that writes to the
 // Backend b.  A tag describes the subsystem and is included in all log
 // messages.  The logger uses the info verbosity level by default.
 func (b *Backend) Logger(subsystemTag string) Logger {
-	return &slog{LevelInfo, subsystemTag, b}
+	return newSlog(LevelInfo, subsystemTag, b)
 }
 
-// slog is a subsystem logger for a Backend.  Implements the Logger interface.
+// slog is a subsystem logger for a Backend.  Implements the Logger and
+// LevelElevator interfaces.
 type slog struct {
 	lvl Level // atomic
 	tag string
 	b   *Backend
+
+	// elevations tracks the temporary level elevations of the logger.
+	elevations *LevelElevations
+}
+
+// newSlog creates a new subsystem logger for the Backend b.
+func newSlog(lvl Level, tag string, b *Backend) *slog {
+	l := &slog{lvl: lvl, tag: tag, b: b}
+	l.elevations = NewLevelElevations(l)
+
+	return l
 }
 
 // Trace formats message using the default formats for its operands, prepends
@@ -332,7 +456,7 @@ type slog struct {
 // This is part of the Logger interface implementation.
 func (l *slog) Trace(args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelTrace {
+	if lvl.enables(LevelTrace) {
 		l.b.print("TRC", l.tag, args...)
 	}
 }
@@ -343,7 +467,7 @@ func (l *slog) Trace(args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Tracef(format string, args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelTrace {
+	if lvl.enables(LevelTrace) {
 		l.b.printf("TRC", l.tag, format, args...)
 	}
 }
@@ -354,7 +478,7 @@ func (l *slog) Tracef(format string, args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Debug(args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelDebug {
+	if lvl.enables(LevelDebug) {
 		l.b.print("DBG", l.tag, args...)
 	}
 }
@@ -365,7 +489,7 @@ func (l *slog) Debug(args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Debugf(format string, args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelDebug {
+	if lvl.enables(LevelDebug) {
 		l.b.printf("DBG", l.tag, format, args...)
 	}
 }
@@ -376,7 +500,7 @@ func (l *slog) Debugf(format string, args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Info(args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelInfo {
+	if lvl.enables(LevelInfo) {
 		l.b.print("INF", l.tag, args...)
 	}
 }
@@ -387,7 +511,7 @@ func (l *slog) Info(args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Infof(format string, args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelInfo {
+	if lvl.enables(LevelInfo) {
 		l.b.printf("INF", l.tag, format, args...)
 	}
 }
@@ -398,7 +522,7 @@ func (l *slog) Infof(format string, args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Warn(args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelWarn {
+	if lvl.enables(LevelWarn) {
 		l.b.print("WRN", l.tag, args...)
 	}
 }
@@ -409,7 +533,7 @@ func (l *slog) Warn(args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Warnf(format string, args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelWarn {
+	if lvl.enables(LevelWarn) {
 		l.b.printf("WRN", l.tag, format, args...)
 	}
 }
@@ -420,7 +544,7 @@ func (l *slog) Warnf(format string, args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Error(args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelError {
+	if lvl.enables(LevelError) {
 		l.b.print("ERR", l.tag, args...)
 	}
 }
@@ -431,7 +555,7 @@ func (l *slog) Error(args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Errorf(format string, args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelError {
+	if lvl.enables(LevelError) {
 		l.b.printf("ERR", l.tag, format, args...)
 	}
 }
@@ -442,7 +566,7 @@ func (l *slog) Errorf(format string, args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Critical(args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelCritical {
+	if lvl.enables(LevelCritical) {
 		l.b.print("CRT", l.tag, args...)
 	}
 }
@@ -453,7 +577,7 @@ func (l *slog) Critical(args ...interface{}) {
 // This is part of the Logger interface implementation.
 func (l *slog) Criticalf(format string, args ...interface{}) {
 	lvl := l.Level()
-	if lvl <= LevelCritical {
+	if lvl.enables(LevelCritical) {
 		l.b.printf("CRT", l.tag, format, args...)
 	}
 }
@@ -472,9 +596,27 @@ func (l *slog) SetLevel(level Level) {
 	atomic.StoreUint32((*uint32)(&l.lvl), uint32(level))
 }
 
+// ElevateLevel lowers the logging level to the passed level, if it is more
+// verbose than the current level, until the returned restore function is
+// called.
+//
+// This is part of the LevelElevator interface implementation.
+func (l *slog) ElevateLevel(level Level) func() {
+	return l.elevations.Elevate(level)
+}
+
+// SetLevelFor lowers the logging level to the passed level, if it is more
+// verbose than the current level, for the given duration or until the returned
+// restore function is called.
+//
+// This is part of the LevelElevator interface implementation.
+func (l *slog) SetLevelFor(level Level, d time.Duration) func() {
+	return l.elevations.ElevateFor(level, d)
+}
+
 // Disabled is a Logger that will never output anything.
 var Disabled Logger
 
 func init() {
-	Disabled = &slog{lvl: LevelOff, b: NewBackend(ioutil.Discard)}
+	Disabled = newSlog(LevelOff, "", NewBackend(ioutil.Discard))
 }
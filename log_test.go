@@ -0,0 +1,158 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btclog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// errDiskFull is the error returned by a failingWriter.
+var errDiskFull = errors.New("disk full")
+
+// failingWriter is an io.Writer that fails while its fail field is set.
+type failingWriter struct {
+	bytes.Buffer
+	fail bool
+}
+
+// Write writes p to the buffer or returns errDiskFull if the writer is set to
+// fail.
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errDiskFull
+	}
+
+	return w.Buffer.Write(p)
+}
+
+// timestampLen is the length of the timestamp that starts each log line.
+const timestampLen = len("2006-01-02 15:04:05.000 ")
+
+// stripTimestamps removes the timestamp from the start of each line of the
+// given log output.
+func stripTimestamps(t *testing.T, log string) string {
+	t.Helper()
+
+	var stripped strings.Builder
+	for _, line := range strings.SplitAfter(log, "\n") {
+		if line == "" {
+			continue
+		}
+		if len(line) < timestampLen {
+			t.Fatalf("Log line %q has no timestamp", line)
+		}
+		stripped.WriteString(line[timestampLen:])
+	}
+
+	return stripped.String()
+}
+
+// TestBackendWriteErrors tests that failed writes are counted, reported and
+// written to the fallback writer and that logging returns to the primary
+// writer once it recovers.
+func TestBackendWriteErrors(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w        = &failingWriter{}
+		fallback bytes.Buffer
+		errs     []error
+	)
+	backend := NewBackend(
+		w, WithFallbackWriter(&fallback),
+		WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)
+	log := backend.Logger("TEST")
+
+	log.Info("before")
+	w.fail = true
+	log.Infof("failed %d", 1)
+	log.Warn("failed 2")
+	w.fail = false
+	log.Info("after")
+
+	expectedLog := "[INF] TEST: before\n[INF] TEST: after\n"
+	if got := stripTimestamps(t, w.String()); got != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, got)
+	}
+
+	expectedLog = "[INF] TEST: failed 1\n[WRN] TEST: failed 2\n"
+	if got := stripTimestamps(t, fallback.String()); got != expectedLog {
+		t.Fatalf("Fallback mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, got)
+	}
+
+	if backend.FailedWrites() != 2 {
+		t.Fatalf("Expected 2 failed writes, got %d",
+			backend.FailedWrites())
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], errDiskFull) ||
+		!errors.Is(errs[1], errDiskFull) {
+
+		t.Fatalf("Expected 2 disk full errors, got %v", errs)
+	}
+}
+
+// TestBackendErrorHandlerLogs tests that the error handler of a Backend may
+// itself log without deadlocking, and that failed messages are dropped if
+// there is no fallback writer.
+func TestBackendErrorHandlerLogs(t *testing.T) {
+	t.Parallel()
+
+	w := &failingWriter{fail: true}
+
+	var log Logger
+	backend := NewBackend(w, WithErrorHandler(func(err error) {
+		w.fail = false
+		log.Errorf("Unable to write log: %v", err)
+	}))
+	log = backend.Logger("TEST")
+
+	log.Info("dropped")
+
+	expectedLog := "[ERR] TEST: Unable to write log: disk full\n"
+	if got := stripTimestamps(t, w.String()); got != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, got)
+	}
+	if backend.FailedWrites() != 1 {
+		t.Fatalf("Expected 1 failed write, got %d",
+			backend.FailedWrites())
+	}
+}
+
+// TestBackendWrite tests that raw lines written to a Backend are written to its
+// Writer along with the lines of its loggers.
+func TestBackendWrite(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	backend := NewBackend(&buf, WithFlags(0))
+	if backend.Flags() != 0 {
+		t.Fatalf("Expected flags 0, got %d", backend.Flags())
+	}
+
+	backend.Logger("PEER").Info("Connected")
+	if _, err := backend.Write([]byte("raw line\n")); err != nil {
+		t.Fatalf("Unable to write: %v", err)
+	}
+
+	lines := strings.SplitAfterN(buf.String(), "\n", 2)
+	if len(lines) != 2 || lines[1] != "raw line\n" {
+		t.Fatalf("Unexpected output %q", buf.Bytes())
+	}
+
+	expectedLog := "[INF] PEER: Connected\n"
+	if got := stripTimestamps(t, lines[0]); got != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, got)
+	}
+}
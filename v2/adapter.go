@@ -0,0 +1,315 @@
+package btclog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/btcsuite/btclog"
+)
+
+// DefaultSubSystemKey is the default attribute key under which a
+// HandlerAdapter adds the subsystem tag to each record.
+const DefaultSubSystemKey = "subsystem"
+
+// AdapterOption is the signature of a functional option that can be used to
+// modify the behaviour of a HandlerAdapter.
+type AdapterOption func(*adapterOpts)
+
+// adapterOpts holds options that can be modified by an AdapterOption.
+type adapterOpts struct {
+	// subSystemKey is the attribute key of the subsystem tag.
+	subSystemKey string
+
+	// subSystemGroup defines whether the subsystem tag is added as a group
+	// rather than as an attribute.
+	subSystemGroup bool
+
+	// hierarchical defines whether subsystem tags are nested and derived
+	// handlers inherit the level of their parent.
+	hierarchical bool
+
+	// criticalExit, if set, exits the process after a critical record is
+	// handled.
+	criticalExit *CriticalExit
+}
+
+// WithSubSystemKey sets the attribute key under which the subsystem tag is
+// added to each record. It defaults to DefaultSubSystemKey.
+func WithSubSystemKey(key string) AdapterOption {
+	return func(opts *adapterOpts) {
+		opts.subSystemKey = key
+	}
+}
+
+// WithSubSystemGroup causes the subsystem tag to be added as a group that all
+// attributes are nested under, rather than as an attribute. Note that most
+// handlers omit empty groups, so a record without attributes will not show its
+// subsystem in this mode.
+func WithSubSystemGroup() AdapterOption {
+	return func(opts *adapterOpts) {
+		opts.subSystemGroup = true
+	}
+}
+
+// WithSubSystemHierarchy enables hierarchical subsystems, as described for
+// WithHierarchicalSubSystems. The nested tag, e.g. "PEER.CONN", is added as the
+// subsystem attribute, or as a single group if WithSubSystemGroup is set.
+func WithSubSystemHierarchy() AdapterOption {
+	return func(opts *adapterOpts) {
+		opts.hierarchical = true
+	}
+}
+
+// WithAdapterCriticalExit causes the adapter to exit the process with the given
+// CriticalExit after it has passed a record at the critical level or above on
+// to the wrapped handler, as described for WithCriticalExit. The record is only
+// passed on if the levels of the adapter and the wrapped handler allow it.
+func WithAdapterCriticalExit(c *CriticalExit) AdapterOption {
+	return func(opts *adapterOpts) {
+		opts.criticalExit = c
+	}
+}
+
+// HandlerAdapter is a Handler that adapts an arbitrary slog.Handler, such as
+// the slog.JSONHandler of the standard library, so that it can be used with
+// NewSLogger. It adds an atomic logging level, subsystem tagging and message
+// prefixes on top of the wrapped handler. Records are only passed on if they
+// are enabled by both the level of the adapter and the wrapped handler.
+//
+// As with the DefaultHandler, handlers created with SubSystem have an
+// independent level, while handlers created with WithPrefix share the level of
+// their parent. Handlers created with SubSystem keep all attributes added with
+// WithAttrs but lose all groups added with WithGroup.
+type HandlerAdapter struct {
+	// base is the adapted handler without the subsystem tag or any of
+	// the attributes and groups added to the adapter.
+	base slog.Handler
+
+	// handler is the base handler with the subsystem tag, attributes and
+	// groups applied.
+	handler slog.Handler
+
+	opts  *adapterOpts
+	level *levelNode
+
+	tag    string
+	prefix string
+
+	// goas holds the attributes and groups added since the subsystem tag
+	// was set so that they can be re-applied to a new subsystem.
+	goas []groupOrAttrs
+}
+
+// A compile-time check to ensure that HandlerAdapter implements Handler.
+var _ Handler = (*HandlerAdapter)(nil)
+
+// NewHandlerAdapter creates a new HandlerAdapter that wraps the given
+// slog.Handler. The adapter uses the info level by default.
+func NewHandlerAdapter(handler slog.Handler,
+	options ...AdapterOption) *HandlerAdapter {
+
+	opts := &adapterOpts{
+		subSystemKey: DefaultSubSystemKey,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+
+	adapter := &HandlerAdapter{
+		base:    handler,
+		handler: handler,
+		opts:    opts,
+		level:   newLevelNode(int64(levelInfo)),
+	}
+
+	return adapter
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the Handler interface.
+func (a *HandlerAdapter) Level() btclog.Level {
+	return fromSlogLevel(slog.Level(a.level.Load()))
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the Handler interface.
+func (a *HandlerAdapter) SetLevel(level btclog.Level) {
+	a.level.Store(int64(toSlogLevel(level)))
+}
+
+// Enabled reports whether the handler handles records at the given level. A
+// level override carried by the context, see WithLevelOverride, can lower the
+// level of the adapter but not that of the wrapped handler.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (a *HandlerAdapter) Enabled(ctx context.Context, level slog.Level) bool {
+	if a.opts.criticalExit.exitsAt(level) {
+		return true
+	}
+
+	return a.enabled(ctx, level)
+}
+
+// enabled reports whether records at the given level are enabled by the levels
+// of both the adapter and the wrapped handler.
+func (a *HandlerAdapter) enabled(ctx context.Context, level slog.Level) bool {
+	return enabledAt(ctx, a.level.Load(), level) &&
+		a.handler.Enabled(ctx, level)
+}
+
+// criticalExits returns the CriticalExits that are run after the handler has
+// handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (a *HandlerAdapter) criticalExits(level slog.Level) []*CriticalExit {
+	return a.opts.criticalExit.exits(level)
+}
+
+// Handle adds the prefix to the message of the record and passes it on to the
+// wrapped handler.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (a *HandlerAdapter) Handle(ctx context.Context, r slog.Record) error {
+	if a.opts.criticalExit.exitsAt(r.Level) {
+		defer a.opts.criticalExit.handled(ctx)
+
+		if !a.enabled(ctx, r.Level) {
+			return nil
+		}
+	}
+
+	if a.prefix != "" {
+		r.Message = a.prefix + " " + r.Message
+	}
+
+	return a.handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new Handler with the given attributes added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (a *HandlerAdapter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return a
+	}
+
+	return a.with(
+		a.handler.WithAttrs(attrs), a.tag, a.prefix, true,
+		append(a.goas[:len(a.goas):len(a.goas)],
+			groupOrAttrs{attrs: attrs}),
+	)
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (a *HandlerAdapter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return a
+	}
+
+	return a.with(
+		a.handler.WithGroup(name), a.tag, a.prefix, true,
+		append(a.goas[:len(a.goas):len(a.goas)],
+			groupOrAttrs{group: name}),
+	)
+}
+
+// SubSystem returns a copy of the given handler but with the new tag.
+//
+// NOTE: this creates a new logger with an independent log level. This
+// means that SetLevel needs to be called on the new logger to change
+// the level as any changes to the parent logger's level after creation
+// will not be inherited by the new logger. If the adapter was created with
+// WithSubSystemHierarchy, the new tag is nested under the current tag and the
+// new logger inherits the level of its parent instead.
+//
+// NOTE: this is part of the Handler interface.
+func (a *HandlerAdapter) SubSystem(tag string) Handler {
+	tag = subSystemTag(a.tag, tag, a.opts.hierarchical)
+
+	handler := a.base
+	if a.opts.subSystemGroup {
+		handler = handler.WithGroup(tag)
+	} else {
+		handler = handler.WithAttrs([]slog.Attr{
+			slog.String(a.opts.subSystemKey, tag),
+		})
+	}
+
+	// Only the attributes are kept since the groups would otherwise
+	// qualify the attributes of the new subsystem.
+	var goas []groupOrAttrs
+	for _, goa := range a.goas {
+		if goa.group != "" {
+			continue
+		}
+
+		handler = handler.WithAttrs(goa.attrs)
+		goas = append(goas, goa)
+	}
+
+	return a.with(handler, tag, a.prefix, false, goas)
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message. Note that the subsystem of the original logger is kept
+// but any existing prefix is overridden.
+//
+// NOTE: this creates a new logger with an inherited log level. This means
+// that if SetLevel is called on the parent logger, then this new level will be
+// inherited by the new logger
+//
+// NOTE: this is part of the Handler interface.
+func (a *HandlerAdapter) WithPrefix(prefix string) Handler {
+	return a.with(a.handler, a.tag, prefix, true, a.goas)
+}
+
+// hierarchical returns true if the adapter was created with
+// WithSubSystemHierarchy.
+//
+// NOTE: this is part of the hierarchicalHandler interface.
+func (a *HandlerAdapter) hierarchical() bool {
+	return a.opts.hierarchical
+}
+
+// levelInherited returns true if the handler inherits the level of its parent.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (a *HandlerAdapter) levelInherited() bool {
+	return a.level.inherited()
+}
+
+// resetLevel makes the handler inherit the level of its parent again.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (a *HandlerAdapter) resetLevel() {
+	a.level.reset()
+}
+
+// with returns a new HandlerAdapter that wraps the given handler. If
+// shareLevel is false, the new adapter has a level that either inherits the
+// level of the adapter or is an independent copy of it, see
+// WithSubSystemHierarchy.
+func (a *HandlerAdapter) with(handler slog.Handler, tag, prefix string,
+	shareLevel bool, goas []groupOrAttrs) *HandlerAdapter {
+
+	level := a.level
+	if !shareLevel {
+		level = a.level.derive(a.opts.hierarchical)
+	}
+
+	return &HandlerAdapter{
+		base:    a.base,
+		handler: handler,
+		opts:    a.opts,
+		level:   level,
+		tag:     tag,
+		prefix:  prefix,
+		goas:    goas,
+	}
+}
@@ -0,0 +1,85 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+// newTestTextHandler creates a slog.TextHandler that writes to the given buffer
+// without timestamps and that handles all levels.
+func newTestTextHandler(buf *bytes.Buffer) slog.Handler {
+	return slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.Level(-10),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	})
+}
+
+// TestHandlerAdapter tests that a HandlerAdapter adds levels, subsystems and
+// prefixes to a third-party slog.Handler.
+func TestHandlerAdapter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	adapter := NewHandlerAdapter(newTestTextHandler(&buf))
+	ctx := context.Background()
+
+	peerHandler := adapter.SubSystem("PEER")
+	log := NewSLogger(peerHandler)
+	prefixLog := NewSLogger(peerHandler.WithPrefix("(inbound)"))
+
+	log.InfoS(ctx, "Connected", "addr", "1.2.3.4")
+	log.Debug("Hidden")
+
+	// The prefixed logger shares the level of its parent while a new
+	// subsystem has an independent level.
+	srvrHandler := peerHandler.SubSystem("SRVR")
+	log.SetLevel(LevelDebug)
+	prefixLog.Debug("Visible")
+	NewSLogger(srvrHandler).Debug("Hidden")
+
+	// Attributes are kept by a new subsystem but groups are not.
+	grouped := peerHandler.WithAttrs([]slog.Attr{slog.Int("id", 1)}).
+		WithGroup("conn")
+	slog.New(grouped).Info("Grouped", "bytes", 10)
+	NewSLogger(grouped.(Handler).SubSystem("SRVR")).InfoS(
+		ctx, "New subsystem", "bytes", 10,
+	)
+
+	expectedLog := `level=INFO msg=Connected subsystem=PEER addr=1.2.3.4
+level=DEBUG msg="(inbound) Visible" subsystem=PEER
+level=INFO msg=Grouped subsystem=PEER id=1 conn.bytes=10
+level=INFO msg="New subsystem" subsystem=SRVR id=1 bytes=10
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
+
+// TestHandlerAdapterGroup tests that the subsystem can be added as a group.
+func TestHandlerAdapterGroup(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	adapter := NewHandlerAdapter(
+		newTestTextHandler(&buf), WithSubSystemGroup(),
+	)
+
+	NewSLogger(adapter.SubSystem("PEER")).InfoS(
+		context.Background(), "Connected", "addr", "1.2.3.4",
+	)
+
+	expectedLog := "level=INFO msg=Connected PEER.addr=1.2.3.4\n"
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
@@ -0,0 +1,372 @@
+package btclog
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultQueueSize is the default number of records that an AsyncWriter can
+// hold before its overflow policy is applied.
+const DefaultQueueSize = 1024
+
+// OverflowPolicy defines what an AsyncWriter does with a new record when its
+// queue is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock blocks the logging goroutine until there is space in
+	// the queue. No records are dropped.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropNewest drops the new record.
+	OverflowDropNewest
+
+	// OverflowDropOldest drops the oldest record in the queue to make
+	// space for the new record.
+	OverflowDropOldest
+)
+
+// String returns a human-readable name for the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+// AsyncOption is the signature of a functional option that can be used to
+// modify the behaviour of an AsyncWriter.
+type AsyncOption func(*asyncOpts)
+
+// asyncOpts holds options that can be modified by an AsyncOption.
+type asyncOpts struct {
+	queueSize  int
+	policy     OverflowPolicy
+	errHandler func(error)
+}
+
+// defaultAsyncOpts constructs an asyncOpts with default settings.
+func defaultAsyncOpts() *asyncOpts {
+	return &asyncOpts{
+		queueSize: DefaultQueueSize,
+		policy:    OverflowBlock,
+	}
+}
+
+// WithQueueSize sets the number of records that can be queued before the
+// overflow policy is applied.
+func WithQueueSize(size int) AsyncOption {
+	return func(opts *asyncOpts) {
+		opts.queueSize = size
+	}
+}
+
+// WithOverflowPolicy sets the policy applied when the queue is full.
+func WithOverflowPolicy(policy OverflowPolicy) AsyncOption {
+	return func(opts *asyncOpts) {
+		opts.policy = policy
+	}
+}
+
+// WithAsyncErrorHandler sets a call-back that is called with any error returned
+// by the underlying writer. Since records are written asynchronously, such
+// errors can't be returned from Write. The call-back is called in order from a
+// goroutine of its own, rather than from the writer goroutine, so it may itself
+// log through the AsyncWriter. Errors that occur while the call-back is still
+// busy with as many earlier errors as the queue can hold records are not passed
+// to it, but are still counted by FailedWrites.
+func WithAsyncErrorHandler(fn func(error)) AsyncOption {
+	return func(opts *asyncOpts) {
+		opts.errHandler = fn
+	}
+}
+
+// asyncEntry is a single item in the queue of an AsyncWriter. It either holds
+// a record to write or, for a flush marker, a channel to close once all
+// earlier records have been written.
+type asyncEntry struct {
+	record  []byte
+	flushed chan struct{}
+}
+
+// AsyncWriter is an io.WriteCloser that hands each record to a bounded queue
+// which is drained by a dedicated goroutine, so that a slow underlying writer
+// does not stall the goroutines that are logging. It can be used as the writer
+// of both a v1 Backend and a v2 handler:
+//
+//	w := NewAsyncWriter(os.Stdout, WithOverflowPolicy(OverflowDropOldest))
+//	defer w.Close()
+//	log := NewSLogger(NewDefaultHandler(w))
+//
+// Each call to Write is treated as a single record. Since the record is written
+// asynchronously, any error returned by the underlying writer is not returned
+// from Write. Such errors are counted and passed to the error handler set with
+// WithAsyncErrorHandler instead.
+type AsyncWriter struct {
+	w    io.Writer
+	opts *asyncOpts
+
+	// mu guards the queue and closed. notEmpty is signalled when an entry
+	// is added to the queue and notFull when a record is removed from it.
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	// queue holds the queued records and flush markers in order. Only the
+	// records, of which there are numRecords, count towards the size of
+	// the queue, and only records are dropped when it overflows.
+	queue      []asyncEntry
+	numRecords int
+	closed     bool
+
+	dropped atomic.Uint64
+	written atomic.Uint64
+	failed  atomic.Uint64
+
+	// errs passes the errors of the underlying writer to the goroutine
+	// that calls the error handler, if there is one, which closes
+	// errsDone once errs has been closed and drained.
+	errs     chan error
+	errsDone chan struct{}
+
+	done chan struct{}
+}
+
+// A compile-time check to ensure that AsyncWriter implements io.WriteCloser.
+var _ io.WriteCloser = (*AsyncWriter)(nil)
+
+// NewAsyncWriter creates a new AsyncWriter that writes to w and starts its
+// writer goroutine, along with the goroutine that calls the error handler if
+// one is set. Close must be called to stop the goroutines.
+func NewAsyncWriter(w io.Writer, options ...AsyncOption) *AsyncWriter {
+	opts := defaultAsyncOpts()
+	for _, o := range options {
+		o(opts)
+	}
+	if opts.queueSize < 1 {
+		opts.queueSize = 1
+	}
+
+	a := &AsyncWriter{
+		w:    w,
+		opts: opts,
+		done: make(chan struct{}),
+	}
+	a.notEmpty = sync.NewCond(&a.mu)
+	a.notFull = sync.NewCond(&a.mu)
+	if opts.errHandler != nil {
+		a.errs = make(chan error, opts.queueSize)
+		a.errsDone = make(chan struct{})
+		go a.reportErrors()
+	}
+	go a.writer()
+
+	return a
+}
+
+// Write queues a copy of the given record to be written. If the queue is full,
+// the overflow policy is applied. os.ErrClosed is returned if the writer has
+// been closed.
+//
+// NOTE: this is part of the io.Writer interface.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	// The caller may reuse p once we return so a copy must be queued.
+	entry := asyncEntry{record: append([]byte(nil), p...)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for !a.closed && a.numRecords >= a.opts.queueSize {
+		switch a.opts.policy {
+		case OverflowDropNewest:
+			a.dropped.Add(1)
+			return len(p), nil
+
+		case OverflowDropOldest:
+			a.dropOldest()
+
+		default:
+			a.notFull.Wait()
+		}
+	}
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+
+	a.queue = append(a.queue, entry)
+	a.numRecords++
+	a.notEmpty.Signal()
+
+	return len(p), nil
+}
+
+// dropOldest removes the oldest record from the queue. Flush markers are kept
+// so that a flush only completes once the records queued before it that
+// weren't dropped have been written.
+//
+// NOTE: the caller must hold the mutex.
+func (a *AsyncWriter) dropOldest() {
+	for i, entry := range a.queue {
+		if entry.flushed != nil {
+			continue
+		}
+
+		copy(a.queue[i:], a.queue[i+1:])
+		a.queue[len(a.queue)-1] = asyncEntry{}
+		a.queue = a.queue[:len(a.queue)-1]
+		a.numRecords--
+		a.dropped.Add(1)
+
+		return
+	}
+}
+
+// Flush blocks until all records queued before the call have been written to
+// the underlying writer or dropped.
+func (a *AsyncWriter) Flush() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+
+	flushed := make(chan struct{})
+	a.queue = append(a.queue, asyncEntry{flushed: flushed})
+	a.notEmpty.Signal()
+	a.mu.Unlock()
+
+	<-flushed
+
+	return nil
+}
+
+// Close stops accepting new records and blocks until all queued records have
+// been written and their errors have been passed to the error handler. The
+// underlying writer is not closed.
+//
+// NOTE: this is part of the io.Closer interface.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	a.notEmpty.Broadcast()
+	a.notFull.Broadcast()
+	a.mu.Unlock()
+
+	<-a.done
+
+	return nil
+}
+
+// Dropped returns the number of records that have been dropped due to the
+// overflow policy.
+func (a *AsyncWriter) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Written returns the number of records that have been passed to the
+// underlying writer.
+func (a *AsyncWriter) Written() uint64 {
+	return a.written.Load()
+}
+
+// FailedWrites returns the number of records that the underlying writer
+// returned an error for.
+func (a *AsyncWriter) FailedWrites() uint64 {
+	return a.failed.Load()
+}
+
+// next removes the next entry from the queue, waiting for one to be added if
+// it is empty. It returns false once the writer is closed and the queue has
+// been drained.
+func (a *AsyncWriter) next() (asyncEntry, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for len(a.queue) == 0 {
+		if a.closed {
+			return asyncEntry{}, false
+		}
+		a.notEmpty.Wait()
+	}
+
+	entry := a.queue[0]
+	a.queue[0] = asyncEntry{}
+	a.queue = a.queue[1:]
+	if entry.flushed == nil {
+		a.numRecords--
+		a.notFull.Signal()
+	}
+
+	return entry, true
+}
+
+// writer drains the queue until the writer is closed.
+//
+// NOTE: this MUST be run as a goroutine.
+func (a *AsyncWriter) writer() {
+	defer close(a.done)
+
+	// The error handler may still log once the writer is closed, but such
+	// writes fail immediately, so the remaining errors can be waited for.
+	if a.errs != nil {
+		defer func() {
+			close(a.errs)
+			<-a.errsDone
+		}()
+	}
+
+	for {
+		entry, ok := a.next()
+		if !ok {
+			return
+		}
+
+		if entry.flushed != nil {
+			close(entry.flushed)
+			continue
+		}
+
+		_, err := a.w.Write(entry.record)
+		a.written.Add(1)
+		if err != nil {
+			a.failed.Add(1)
+			a.reportError(err)
+		}
+	}
+}
+
+// reportError passes the given error to the goroutine that calls the error
+// handler, if there is one. The writer goroutine never blocks on the error
+// handler, since the error handler may be waiting for space in the queue that
+// only the writer goroutine can make, so the error is not passed on if the
+// error handler is too far behind.
+func (a *AsyncWriter) reportError(err error) {
+	if a.errs == nil {
+		return
+	}
+
+	select {
+	case a.errs <- err:
+	default:
+	}
+}
+
+// reportErrors calls the error handler with the errors of the underlying writer
+// until they have all been reported after the writer goroutine has exited.
+//
+// NOTE: this MUST be run as a goroutine.
+func (a *AsyncWriter) reportErrors() {
+	defer close(a.errsDone)
+
+	for err := range a.errs {
+		a.opts.errHandler(err)
+	}
+}
@@ -0,0 +1,304 @@
+package btclog
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedWriter is an io.Writer that blocks all writes until it is released.
+type gatedWriter struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// newGatedWriter creates a new gatedWriter.
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+// Write signals that a write has started, waits to be released and then writes
+// p to the buffer.
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	select {
+	case g.started <- struct{}{}:
+	default:
+	}
+	<-g.release
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.buf.Write(p)
+}
+
+// String returns the contents of the buffer.
+func (g *gatedWriter) String() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.buf.String()
+}
+
+// TestAsyncWriterOverflow tests that each of the overflow policies is applied
+// once the queue of an AsyncWriter is full.
+func TestAsyncWriterOverflow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		policy          OverflowPolicy
+		expectedOutput  string
+		expectedDropped uint64
+	}{
+		{
+			policy:         OverflowBlock,
+			expectedOutput: "1\n2\n3\n4\n5\n",
+		},
+		{
+			policy:          OverflowDropNewest,
+			expectedOutput:  "1\n2\n3\n",
+			expectedDropped: 2,
+		},
+		{
+			policy:          OverflowDropOldest,
+			expectedOutput:  "1\n4\n5\n",
+			expectedDropped: 2,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.policy.String(), func(t *testing.T) {
+			t.Parallel()
+
+			gw := newGatedWriter()
+			w := NewAsyncWriter(
+				gw, WithQueueSize(2),
+				WithOverflowPolicy(test.policy),
+			)
+
+			// Wait for the first record to be picked up by the
+			// writer goroutine so that the queue is empty.
+			w.Write([]byte("1\n"))
+			<-gw.started
+
+			w.Write([]byte("2\n"))
+			w.Write([]byte("3\n"))
+
+			// The queue is now full so, depending on the policy,
+			// the next writes either block or drop a record.
+			writesDone := make(chan struct{})
+			go func() {
+				w.Write([]byte("4\n"))
+				w.Write([]byte("5\n"))
+				close(writesDone)
+			}()
+
+			if test.policy == OverflowBlock {
+				select {
+				case <-writesDone:
+					t.Fatalf("Expected write to block")
+				case <-time.After(50 * time.Millisecond):
+				}
+			} else {
+				<-writesDone
+			}
+
+			close(gw.release)
+			<-writesDone
+
+			if err := w.Flush(); err != nil {
+				t.Fatalf("Unable to flush: %v", err)
+			}
+			if gw.String() != test.expectedOutput {
+				t.Fatalf("Expected output %q, got %q",
+					test.expectedOutput, gw.String())
+			}
+			if w.Dropped() != test.expectedDropped {
+				t.Fatalf("Expected %d dropped records, got %d",
+					test.expectedDropped, w.Dropped())
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatalf("Unable to close: %v", err)
+			}
+		})
+	}
+}
+
+// TestAsyncWriterClose tests that closing an AsyncWriter used by a handler
+// drains all queued records and that later writes are rejected.
+func TestAsyncWriterClose(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := NewAsyncWriter(&buf)
+	log := NewSLogger(NewDefaultHandler(w, WithNoTimestamp()))
+
+	const numLogs = 100
+	for i := 0; i < numLogs; i++ {
+		log.Infof("record %d", i)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+
+	lines := bytes.Count(buf.Bytes(), []byte("[INF]: record "))
+	if lines != numLogs || w.Written() != numLogs {
+		t.Fatalf("Expected %d records, got %d lines and %d written",
+			numLogs, lines, w.Written())
+	}
+
+	if _, err := w.Write([]byte("closed\n")); err == nil {
+		t.Fatalf("Expected an error when writing to a closed writer")
+	}
+
+	// Closing and flushing a closed writer should be a no-op.
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unable to close twice: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Unable to flush a closed writer: %v", err)
+	}
+}
+
+// TestAsyncWriterFlushDropOldest tests that a flush marker is not dropped from
+// a full queue, so that Flush only returns once the records queued before it
+// have been written.
+func TestAsyncWriterFlushDropOldest(t *testing.T) {
+	t.Parallel()
+
+	gw := newGatedWriter()
+	w := NewAsyncWriter(
+		gw, WithQueueSize(2), WithOverflowPolicy(OverflowDropOldest),
+	)
+
+	// Wait for the first record to be picked up by the writer goroutine
+	// and then queue a flush marker behind it.
+	w.Write([]byte("1\n"))
+	<-gw.started
+
+	flushDone := make(chan struct{})
+	go func() {
+		w.Flush()
+		close(flushDone)
+	}()
+
+	// Fill the queue with more records than it can hold so that the
+	// oldest queued record is dropped.
+	time.Sleep(10 * time.Millisecond)
+	w.Write([]byte("2\n"))
+	w.Write([]byte("3\n"))
+	w.Write([]byte("4\n"))
+
+	select {
+	case <-flushDone:
+		t.Fatalf("Flush returned before the first record was written")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(gw.release)
+	<-flushDone
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+
+	expectedOutput := "1\n3\n4\n"
+	if gw.String() != expectedOutput {
+		t.Fatalf("Expected output %q, got %q", expectedOutput,
+			gw.String())
+	}
+	if w.Dropped() != 1 {
+		t.Fatalf("Expected 1 dropped record, got %d", w.Dropped())
+	}
+}
+
+// TestAsyncWriterErrors tests that the errors returned by the underlying writer
+// are counted and reported to the error handler.
+func TestAsyncWriterErrors(t *testing.T) {
+	t.Parallel()
+
+	var (
+		fw   = &failingWriter{fail: true}
+		errs []error
+	)
+	w := NewAsyncWriter(fw, WithAsyncErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	w.Write([]byte("failed\n"))
+	w.Flush()
+	fw.fail = false
+	w.Write([]byte("written\n"))
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+
+	if w.FailedWrites() != 1 || w.Written() != 2 {
+		t.Fatalf("Expected 1 failed of 2 written records, got %d of %d",
+			w.FailedWrites(), w.Written())
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], errDiskFull) {
+		t.Fatalf("Expected a single disk full error, got %v", errs)
+	}
+	if fw.String() != "written\n" {
+		t.Fatalf("Unexpected output %q", fw.String())
+	}
+}
+
+// TestAsyncWriterErrorHandlerLogs tests that the error handler can log through
+// the AsyncWriter without a deadlock when its queue is full and it blocks.
+func TestAsyncWriterErrorHandlerLogs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		fw     = &failingWriter{fail: true}
+		w      *AsyncWriter
+		mu     sync.Mutex
+		logged int
+	)
+	w = NewAsyncWriter(fw, WithQueueSize(1),
+		WithOverflowPolicy(OverflowBlock),
+		WithAsyncErrorHandler(func(err error) {
+			mu.Lock()
+			logged++
+			mu.Unlock()
+
+			w.Write([]byte("write failed: " + err.Error() + "\n"))
+		}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			w.Write([]byte("record\n"))
+		}
+		w.Flush()
+		w.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Writer deadlocked")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logged == 0 {
+		t.Fatal("Expected the error handler to be called")
+	}
+}
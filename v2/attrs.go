@@ -65,7 +65,8 @@ func ClosureAttr(key string, compute func() string) slog.Attr {
 type attrsKey struct{}
 
 // WithCtx returns a copy of the context with which the logging attributes are
-// associated.
+// associated. If a key is set more than once in the context chain, the value
+// that was set last is used.
 //
 // Usage:
 //
@@ -73,14 +74,107 @@ type attrsKey struct{}
 //	...
 //	log.InfoS(unusedCtx, "Height processed") // Will contain attribute: height=1234
 func WithCtx(ctx context.Context, attrs ...any) context.Context {
-	return context.WithValue(ctx, attrsKey{}, mergeAttrs(ctx, attrs))
+	return context.WithValue(ctx, attrsKey{}, append(ctxAttrs(ctx), attrs...))
 }
 
-// mergeAttrs returns the attributes from the context merged with the provided
-// attributes.
+// ctxAttrs returns the attributes that were associated with the context using
+// WithCtx. The returned slice must not be modified in place.
+func ctxAttrs(ctx context.Context) []any {
+	attrs, _ := ctx.Value(attrsKey{}).([]any) // We know the type.
+
+	// Limit the capacity so that appending to the slice never modifies
+	// the attributes held by the context.
+	return attrs[:len(attrs):len(attrs)]
+}
+
+// mergeAttrs returns the attributes returned by the registered context
+// extractors followed by the attributes from the context and the provided
+// attributes. If a key appears more than once, the last value is used at the
+// position of the first appearance of the key. This also applies to keys that
+// are repeated within the provided attributes, whether or not the context has
+// any attributes.
 func mergeAttrs(ctx context.Context, attrs []any) []any {
-	resp, _ := ctx.Value(attrsKey{}).([]any) // We know the type.
-	resp = append(resp, attrs...)
+	extracted := extractAttrs(ctx)
+	stored := ctxAttrs(ctx)
+
+	// A single attribute can't have a repeated key.
+	if len(extracted) == 0 && len(stored) == 0 && len(attrs) < 2 {
+		return attrs
+	}
+
+	merged := make([]slog.Attr, 0, len(extracted)+len(stored)+len(attrs))
+	merged = append(merged, extracted...)
+	merged = append(merged, argsToAttrs(stored)...)
+	merged = append(merged, argsToAttrs(attrs)...)
+
+	return attrsToArgs(dedupAttrs(merged))
+}
+
+// badKey is the key used by slog for a value without a key.
+const badKey = "!BADKEY"
+
+// argsToAttrs converts a list of alternating keys and values, which may also
+// contain slog.Attr values, to a list of attributes in the same way that
+// slog.Logger does.
+func argsToAttrs(args []any) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(args))
+	for len(args) > 0 {
+		switch x := args[0].(type) {
+		case string:
+			if len(args) == 1 {
+				attrs = append(attrs, slog.String(badKey, x))
+				args = args[1:]
+
+				continue
+			}
+			attrs = append(attrs, slog.Any(x, args[1]))
+			args = args[2:]
+
+		case slog.Attr:
+			attrs = append(attrs, x)
+			args = args[1:]
+
+		default:
+			attrs = append(attrs, slog.Any(badKey, x))
+			args = args[1:]
+		}
+	}
+
+	return attrs
+}
+
+// dedupAttrs returns the given attributes with any repeated keys removed. The
+// last value of a key is kept at the position of the first appearance of the
+// key. Attributes with an empty key are always kept since they are either
+// ignored or inlined by the handlers.
+func dedupAttrs(attrs []slog.Attr) []slog.Attr {
+	index := make(map[string]int, len(attrs))
+	deduped := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Key == "" {
+			deduped = append(deduped, a)
+			continue
+		}
+
+		if i, ok := index[a.Key]; ok {
+			deduped[i] = a
+			continue
+		}
+
+		index[a.Key] = len(deduped)
+		deduped = append(deduped, a)
+	}
+
+	return deduped
+}
+
+// attrsToArgs converts a list of attributes to a list of arguments that can be
+// passed to slog.Logger.
+func attrsToArgs(attrs []slog.Attr) []any {
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
 
-	return resp
+	return args
 }
@@ -0,0 +1,256 @@
+package btclog
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// The attribute constructors in this file return attributes with values that
+// implement slog.LogValuer so that they are only formatted if the record they
+// are part of is actually written.
+
+// satoshiPerBitcoin is the number of satoshi in one bitcoin.
+const satoshiPerBitcoin = 1e8
+
+// witnessScaleFactor is the number of weight units per virtual byte.
+const witnessScaleFactor = 4
+
+// Hash is a convenience function for block and transaction hash log
+// attributes. The hash is displayed byte-reversed as is done by block
+// explorers and RPC interfaces. A chainhash.Hash can be passed as is.
+//
+// Example usage:
+//
+//	log.InfoS(ctx, "Block connected", Hash("hash", block.BlockHash()))
+func Hash(key string, hash [32]byte) slog.Attr {
+	return slog.Any(key, hashValue(hash))
+}
+
+// OutPoint is a convenience function for transaction outpoint log attributes
+// which are displayed as txid:index.
+func OutPoint(key string, txid [32]byte, index uint32) slog.Attr {
+	return slog.Any(key, outPointValue{txid: txid, index: index})
+}
+
+// Amount is a convenience function for log attributes holding an amount of
+// satoshi which are displayed in BTC with 8 decimal places, e.g.
+// "0.00100000 BTC". A btcutil.Amount can be passed as int64(amt).
+func Amount(key string, sats int64) slog.Attr {
+	return slog.Any(key, amountValue(sats))
+}
+
+// PubKey is a convenience function for public key log attributes. The key is
+// displayed as the hex encoding of its compressed serialization. Keys given in
+// their uncompressed serialization are compressed first.
+func PubKey(key string, pubKey []byte) slog.Attr {
+	return slog.Any(key, pubKeyValue{pubKey: pubKey})
+}
+
+// PubKeyN is a convenience function for public key log attributes which prints
+// a maximum of n bytes of the compressed serialization of the key.
+func PubKeyN(key string, pubKey []byte, n uint) slog.Attr {
+	return slog.Any(key, pubKeyValue{pubKey: pubKey, n: n, truncate: true})
+}
+
+// ShortChanID is a convenience function for short channel ID log attributes.
+// The ID is displayed in its human readable form of block height, transaction
+// index and output index, e.g. "800000x1234x1".
+func ShortChanID(key string, scid uint64) slog.Attr {
+	return slog.Any(key, shortChanIDValue(scid))
+}
+
+// ByteSize is a convenience function for log attributes holding a number of
+// bytes which are displayed with a binary unit, e.g. "1.50 KiB".
+func ByteSize(key string, size uint64) slog.Attr {
+	return slog.Any(key, byteSizeValue(size))
+}
+
+// Weight is a convenience function for log attributes holding a transaction or
+// block weight which is displayed in weight units along with the equivalent
+// virtual size, e.g. "561 WU (141 vB)".
+func Weight(key string, weight uint64) slog.Attr {
+	return slog.Any(key, weightValue(weight))
+}
+
+// hashValue is a hash that is formatted byte-reversed.
+type hashValue [32]byte
+
+// String returns the byte-reversed hex encoding of the hash.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (h hashValue) String() string {
+	for i := 0; i < len(h)/2; i++ {
+		h[i], h[len(h)-1-i] = h[len(h)-1-i], h[i]
+	}
+
+	return hex.EncodeToString(h[:])
+}
+
+// LogValue returns the hash formatted as a string.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (h hashValue) LogValue() slog.Value {
+	return slog.StringValue(h.String())
+}
+
+// outPointValue is an outpoint that is formatted as txid:index.
+type outPointValue struct {
+	txid  [32]byte
+	index uint32
+}
+
+// String returns the outpoint formatted as txid:index.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (o outPointValue) String() string {
+	return hashValue(o.txid).String() + ":" +
+		strconv.FormatUint(uint64(o.index), 10)
+}
+
+// LogValue returns the outpoint formatted as a string.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (o outPointValue) LogValue() slog.Value {
+	return slog.StringValue(o.String())
+}
+
+// amountValue is an amount of satoshi that is formatted in BTC.
+type amountValue int64
+
+// String returns the amount in BTC with 8 decimal places. Integer arithmetic
+// is used so that no precision is lost for large amounts.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (a amountValue) String() string {
+	sign := ""
+	sats := uint64(a)
+	if a < 0 {
+		sign = "-"
+		sats = uint64(-a)
+	}
+
+	return fmt.Sprintf("%s%d.%08d BTC", sign, sats/satoshiPerBitcoin,
+		sats%satoshiPerBitcoin)
+}
+
+// LogValue returns the amount formatted as a string.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (a amountValue) LogValue() slog.Value {
+	return slog.StringValue(a.String())
+}
+
+// pubKeyValue is a public key that is formatted as the hex encoding of its
+// compressed serialization.
+type pubKeyValue struct {
+	pubKey   []byte
+	n        uint
+	truncate bool
+}
+
+// String returns the hex encoding of the compressed public key, truncated if
+// required.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (p pubKeyValue) String() string {
+	key := p.pubKey
+
+	// An uncompressed key is serialized as 0x04 || x || y. Its compressed
+	// form is 0x02 or 0x03, depending on the parity of y, followed by x.
+	if len(key) == 65 && key[0] == 0x04 {
+		compressed := make([]byte, 33)
+		compressed[0] = 0x02 | key[64]&0x01
+		copy(compressed[1:], key[1:33])
+		key = compressed
+	}
+
+	if p.truncate && len(key) > int(p.n) {
+		key = key[:p.n]
+	}
+
+	return hex.EncodeToString(key)
+}
+
+// LogValue returns the public key formatted as a string.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (p pubKeyValue) LogValue() slog.Value {
+	return slog.StringValue(p.String())
+}
+
+// shortChanIDValue is a short channel ID that is formatted in its human
+// readable form.
+type shortChanIDValue uint64
+
+// String returns the short channel ID formatted as blockxtxxout.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (s shortChanIDValue) String() string {
+	block := uint64(s) >> 40
+	tx := (uint64(s) >> 16) & 0xFFFFFF
+	out := uint64(s) & 0xFFFF
+
+	return fmt.Sprintf("%dx%dx%d", block, tx, out)
+}
+
+// LogValue returns the short channel ID formatted as a string.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (s shortChanIDValue) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// byteSizeUnits are the binary units that a byteSizeValue is formatted with.
+var byteSizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// byteSizeValue is a number of bytes that is formatted with a binary unit.
+type byteSizeValue uint64
+
+// String returns the size in the largest binary unit that keeps the value at
+// or above one, with two decimal places.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (b byteSizeValue) String() string {
+	if b < 1024 {
+		return strconv.FormatUint(uint64(b), 10) + " B"
+	}
+
+	size := float64(b) / 1024
+	unit := 0
+	for size >= 1024 && unit < len(byteSizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.2f %s", size, byteSizeUnits[unit])
+}
+
+// LogValue returns the size formatted as a string.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (b byteSizeValue) LogValue() slog.Value {
+	return slog.StringValue(b.String())
+}
+
+// weightValue is a weight that is formatted in weight units and virtual
+// bytes.
+type weightValue uint64
+
+// String returns the weight in weight units along with the virtual size, which
+// is the weight divided by the witness scale factor, rounded up.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (w weightValue) String() string {
+	vsize := (uint64(w) + witnessScaleFactor - 1) / witnessScaleFactor
+
+	return fmt.Sprintf("%d WU (%d vB)", uint64(w), vsize)
+}
+
+// LogValue returns the weight formatted as a string.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (w weightValue) LogValue() slog.Value {
+	return slog.StringValue(w.String())
+}
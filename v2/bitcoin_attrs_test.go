@@ -0,0 +1,65 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+)
+
+// TestBitcoinAttrs tests the formatting of the bitcoin specific attributes.
+func TestBitcoinAttrs(t *testing.T) {
+	t.Parallel()
+
+	var hash [32]byte
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+
+	// The compressed key has an odd y coordinate.
+	uncompressed := make([]byte, 65)
+	uncompressed[0] = 0x04
+	uncompressed[1] = 0xaa
+	uncompressed[64] = 0x01
+	compressed := append([]byte{0x03, 0xaa}, make([]byte, 31)...)
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(&buf, WithNoTimestamp()))
+	ctx := context.Background()
+
+	log.InfoS(ctx, "Hash", Hash("hash", hash))
+	log.InfoS(ctx, "OutPoint", OutPoint("op", hash, 3))
+	log.InfoS(ctx, "Amounts", Amount("a", 100_000), Amount("b", -1),
+		Amount("c", 21_000_000*satoshiPerBitcoin),
+		Amount("d", math.MinInt64))
+	log.InfoS(ctx, "PubKeys", PubKey("a", compressed),
+		PubKey("b", uncompressed), PubKeyN("c", uncompressed, 4),
+		PubKeyN("d", []byte{0x02}, 4))
+	log.InfoS(ctx, "SCID", ShortChanID("scid", 800000<<40|1234<<16|1))
+	log.InfoS(ctx, "Sizes", ByteSize("a", 512), ByteSize("b", 1536),
+		ByteSize("c", 3<<20), ByteSize("d", math.MaxUint64))
+	log.InfoS(ctx, "Weight", Weight("w", 561))
+
+	// The attributes should be formatted in the same way when used with
+	// the fmt package.
+	log.Infof("Formatted %v", Hash("hash", hash).Value)
+
+	expectedLog := `[INF]: Hash hash=1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100
+[INF]: OutPoint op=1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100:3
+[INF]: Amounts a="0.00100000 BTC" b="-0.00000001 BTC" c="21000000.00000000 BTC" d="-92233720368.54775808 BTC"
+[INF]: PubKeys a=03aa00000000000000000000000000000000000000000000000000000000000000 b=03aa00000000000000000000000000000000000000000000000000000000000000 c=03aa0000 d=02
+[INF]: SCID scid=800000x1234x1
+[INF]: Sizes a="512 B" b="1.50 KiB" c="3.00 MiB" d="16.00 EiB"
+[INF]: Weight w="561 WU (141 vB)"
+[INF]: Formatted 1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+
+	// The original hash must not have been reversed in place.
+	if hash[0] != 0 || hash[31] != 31 {
+		t.Fatalf("Hash modified: %x", hash)
+	}
+}
@@ -0,0 +1,184 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// NewBridgeBackend creates a v1 Backend whose subsystem loggers forward their
+// records to SubSystem handlers of the given v2 Handler. This allows code that
+// still creates its loggers with the Logger method of a v1 Backend to share the
+// sink and format of code using the v2 Logger.
+//
+// The levels of the loggers are those of the v1 loggers, which can be managed
+// with a Registry created by NewBackendRegistry, while the levels of the
+// SubSystem handlers are ignored. Since the records are formatted by the v1
+// loggers, they carry no call-site and no attributes.
+//
+// Example usage:
+//
+//	handler := NewDefaultHandler(os.Stdout)
+//	backend := NewBridgeBackend(handler)
+//	peerLog := backend.Logger("PEER") // Written by handler.
+func NewBridgeBackend(handler Handler) *btclog.Backend {
+	w := &bridgeWriter{
+		handler:  handler,
+		handlers: make(map[string]Handler),
+	}
+
+	return btclog.NewBackend(w, btclog.WithFlags(0))
+}
+
+// bridgeWriter is the writer of a Backend created by NewBridgeBackend. It
+// parses the lines written by the v1 loggers of the Backend and passes them to
+// SubSystem handlers of the bridged Handler as records.
+type bridgeWriter struct {
+	handler Handler
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+}
+
+// Write parses a single line written by a v1 logger, which has the format
+// "<timestamp> [<level>] <tag>: <message>\n", and passes it to the SubSystem
+// handler for the tag. A line that can't be parsed is passed to the bridged
+// Handler as is, at the info level.
+//
+// NOTE: this is part of the io.Writer interface.
+func (b *bridgeWriter) Write(p []byte) (int, error) {
+	handler, level, msg := b.handler, LevelInfo, p
+	if tag, l, m, ok := parseV1Line(p); ok {
+		handler, level, msg = b.subSystem(tag), l, m
+	}
+
+	msg = bytes.TrimSuffix(msg, []byte("\n"))
+	r := slog.NewRecord(time.Now(), toSlogLevel(level), string(msg), 0)
+
+	// The level has already been checked by the v1 logger, so the record is
+	// handled without checking whether the handler is enabled for it.
+	if err := handler.Handle(context.Background(), r); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// subSystem returns the SubSystem handler of the bridged Handler for the given
+// tag, which is created once per tag.
+func (b *bridgeWriter) subSystem(tag string) Handler {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h, ok := b.handlers[tag]
+	if !ok {
+		h = b.handler.SubSystem(tag)
+		b.handlers[tag] = h
+	}
+
+	return h
+}
+
+// parseV1Line splits a line written by a v1 logger without caller flags into
+// its tag, level and message.
+func parseV1Line(line []byte) (string, btclog.Level, []byte, bool) {
+	start := bytes.Index(line, []byte(" ["))
+	if start < 0 {
+		return "", 0, nil, false
+	}
+	line = line[start+2:]
+
+	end := bytes.Index(line, []byte("] "))
+	if end < 0 {
+		return "", 0, nil, false
+	}
+	level, ok := btclog.LevelFromString(string(line[:end]))
+	if !ok {
+		return "", 0, nil, false
+	}
+	line = line[end+2:]
+
+	end = bytes.Index(line, []byte(": "))
+	if end < 0 {
+		return "", 0, nil, false
+	}
+
+	return string(line[:end]), level, line[end+2:], true
+}
+
+// NewBackendHandler creates a DefaultHandler that writes its records via the
+// given v1 Backend. The records are written by v1 loggers of the Backend, so
+// they are in the same format as the lines of the other v1 loggers of the
+// Backend and the writes are serialised with theirs. The message, prefix and
+// attributes of a record are formatted by the handler, while the timestamp,
+// level and subsystem tag are added by the v1 logger.
+//
+// Since the v1 logger writes the header, the handler options that affect it,
+// such as WithCallerFlags, have no effect, and records at levels registered
+// with RegisterLevel are written with the closest built-in level below them.
+// The Backend should be created without caller flags, since the call-site it
+// would report is that of the handler.
+func NewBackendHandler(b *btclog.Backend,
+	opts ...HandlerOption) *DefaultHandler {
+
+	h := NewDefaultHandler(io.Discard, opts...)
+	h.opts.backend = &backendLoggers{
+		backend: b,
+		loggers: make(map[string]btclog.Logger),
+	}
+
+	return h
+}
+
+// backendLoggers holds the v1 loggers of a Backend that the records of a
+// handler created by NewBackendHandler are written by, one per subsystem tag.
+type backendLoggers struct {
+	backend *btclog.Backend
+
+	mu      sync.Mutex
+	loggers map[string]btclog.Logger
+}
+
+// logger returns the v1 logger for the given subsystem tag, which is created
+// once per tag.
+func (b *backendLoggers) logger(tag string) btclog.Logger {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, ok := b.loggers[tag]
+	if !ok {
+		// The level of a record has already been checked by the
+		// handler, so the v1 logger writes all levels.
+		l = b.backend.Logger(tag)
+		l.SetLevel(LevelTrace)
+		b.loggers[tag] = l
+	}
+
+	return l
+}
+
+// writeBackend writes the body of a log line at the given level via a v1 logger
+// of the handler's Backend, which adds the header.
+func (d *DefaultHandler) writeBackend(level slog.Level, body string) {
+	l := d.opts.backend.logger(d.tag)
+
+	switch builtinLevel(level) {
+	case LevelTrace:
+		l.Trace(body)
+	case LevelDebug:
+		l.Debug(body)
+	case LevelInfo:
+		l.Info(body)
+	case LevelWarn:
+		l.Warn(body)
+	case LevelError:
+		l.Error(body)
+	default:
+		l.Critical(body)
+	}
+}
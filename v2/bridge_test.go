@@ -0,0 +1,78 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+// TestBridgeBackend tests that the loggers of a bridge Backend write to the
+// v2 Handler.
+func TestBridgeBackend(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := NewDefaultHandler(&buf, WithNoTimestamp())
+	registry := NewBackendRegistry(NewBridgeBackend(handler))
+
+	peerLog := registry.Logger("PEER")
+	peerLog.Infof("From v1 %d", 1)
+	peerLog.Debug("Hidden")
+
+	if err := registry.ApplyLevelSpec("PEER=debug"); err != nil {
+		t.Fatalf("Unable to apply level spec: %v", err)
+	}
+	peerLog.Debug("Visible")
+
+	NewSLogger(handler.SubSystem("SRVR")).Info("From v2")
+
+	expectedLog := `[INF] PEER: From v1 1
+[DBG] PEER: Visible
+[INF] SRVR: From v2
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
+
+// TestBackendHandler tests that a handler created with NewBackendHandler
+// writes via the v1 Backend in the v1 format.
+func TestBackendHandler(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	backend := btclog.NewBackend(&buf)
+	handler := NewBackendHandler(backend)
+
+	backend.Logger("PEER").Info("From v1")
+
+	log := NewSLogger(handler.SubSystem("SRVR"))
+	log.Info("From v2")
+	log.Debug("Hidden")
+	log.WithPrefix("(peer)").WarnS(
+		context.Background(), "Slow", nil, "ms", 250,
+	)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+
+	// All lines should have the same format, differing only in the
+	// timestamp, the level, the subsystem and the message.
+	const timestampLen = len("2006-01-02 15:04:05.000")
+	expected := []string{
+		" [INF] PEER: From v1",
+		" [INF] SRVR: From v2",
+		" [WRN] SRVR: (peer) Slow ms=250",
+	}
+	for i, line := range lines {
+		if string(line[timestampLen:]) != expected[i] {
+			t.Fatalf("Expected %q, got %q", expected[i],
+				line[timestampLen:])
+		}
+	}
+}
@@ -0,0 +1,461 @@
+// Package btclogtest provides a Handler and Loggers that capture structured
+// log records for use in tests, along with helpers to query them, so that tests
+// don't need to compare formatted log output.
+package btclogtest
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	btclogv2 "github.com/btcsuite/btclog/v2"
+)
+
+// Record is a captured log record.
+type Record struct {
+	// Time is the time of the record. It is taken from the clock set with
+	// WithClock, if any.
+	Time time.Time
+
+	// Level is the level of the record.
+	Level btclog.Level
+
+	// Tag is the subsystem tag of the logger that wrote the record.
+	Tag string
+
+	// Prefix is the prefix of the logger that wrote the record.
+	Prefix string
+
+	// Message is the message of the record without the prefix.
+	Message string
+
+	// Attrs holds the resolved attributes of the record, including those
+	// added to the logger with WithAttrs or With. Groups are flattened into
+	// dotted keys, e.g. "peer.addr".
+	Attrs []slog.Attr
+
+	// File and Line identify the call-site of the record, as given by the
+	// PC of the slog.Record. They are empty if the record has no PC, such
+	// as a summary record written by a DedupHandler.
+	File string
+	Line int
+}
+
+// AttrValue returns the value of the attribute with the given key, which is a
+// dotted path for attributes within groups. If the key appears more than once,
+// the last value is returned.
+func (r Record) AttrValue(key string) (slog.Value, bool) {
+	var (
+		value slog.Value
+		found bool
+	)
+	for _, a := range r.Attrs {
+		if a.Key == key {
+			value, found = a.Value, true
+		}
+	}
+
+	return value, found
+}
+
+// recordStore holds the records captured by a Handler and all the handlers
+// derived from it.
+type recordStore struct {
+	mu      sync.Mutex
+	records []Record
+
+	// callerPC, if set, is used instead of the PC of the records to
+	// determine their call-site. It is set by a TestLogger while it logs,
+	// since the records are created by the logger that it wraps.
+	callerPC uintptr
+}
+
+// Option is the signature of a functional option that can be used to modify
+// the behaviour of a Handler.
+type Option func(*options)
+
+// options holds options that can be modified by an Option.
+type options struct {
+	// level is the initial level of the handler.
+	level btclog.Level
+
+	// clock is used to obtain the time of each record, if set.
+	clock func() time.Time
+
+	// hierarchical defines whether subsystem tags are nested and derived
+	// handlers inherit the level of their parent.
+	hierarchical bool
+}
+
+// WithLevel sets the initial level of the handler. It defaults to LevelTrace
+// so that all records are captured.
+func WithLevel(level btclog.Level) Option {
+	return func(opts *options) {
+		opts.level = level
+	}
+}
+
+// WithClock sets a clock that is used for the time of each record instead of
+// the time at which it was logged, so that records are deterministic.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
+
+// WithHierarchicalSubSystems enables hierarchical subsystems, as described for
+// btclogv2.WithHierarchicalSubSystems. The tag of a subsystem created from a
+// handler with a tag is nested under it and the handlers created with
+// SubSystem inherit the level of their parent until SetLevel is called on them.
+func WithHierarchicalSubSystems() Option {
+	return func(opts *options) {
+		opts.hierarchical = true
+	}
+}
+
+// StepClock returns a deterministic clock which returns start on its first
+// call and advances by step on each subsequent call.
+func StepClock(start time.Time, step time.Duration) func() time.Time {
+	var (
+		mu   sync.Mutex
+		next = start
+	)
+
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := next
+		next = next.Add(step)
+
+		return now
+	}
+}
+
+// Handler is a btclog Handler that captures the records it handles rather than
+// writing them. All handlers derived from a Handler with SubSystem,
+// WithPrefix, WithAttrs or WithGroup capture into the same store, so the query
+// methods of any of them return the records of all of them.
+type Handler struct {
+	store *recordStore
+	opts  *options
+	level *levelNode
+
+	tag    string
+	prefix string
+
+	// attrs holds the flattened attributes added with WithAttrs and
+	// groupPrefix holds the dotted path of the groups added with
+	// WithGroup.
+	attrs       []slog.Attr
+	groupPrefix string
+}
+
+// A compile-time check to ensure that Handler implements btclogv2.Handler.
+var _ btclogv2.Handler = (*Handler)(nil)
+
+// NewHandler creates a new Handler that captures records.
+func NewHandler(opts ...Option) *Handler {
+	o := &options{
+		level: btclog.LevelTrace,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	h := &Handler{
+		store: &recordStore{},
+		opts:  o,
+		level: &levelNode{},
+	}
+	h.SetLevel(o.level)
+
+	return h
+}
+
+// NewLogger creates a new Logger backed by a new capturing Handler, which is
+// returned along with it.
+func NewLogger(opts ...Option) (btclogv2.Logger, *Handler) {
+	h := NewHandler(opts...)
+
+	return btclogv2.NewSLogger(h), h
+}
+
+// All returns all captured records in the order in which they were logged.
+func (h *Handler) All() []Record {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+
+	return append([]Record(nil), h.store.records...)
+}
+
+// Records returns the captured records at or above the given level in the
+// order in which they were logged.
+func (h *Handler) Records(level btclog.Level) []Record {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+
+	var records []Record
+	for _, r := range h.store.records {
+		if btclogv2.SlogLevel(r.Level) >= btclogv2.SlogLevel(level) {
+			records = append(records, r)
+		}
+	}
+
+	return records
+}
+
+// Find returns the first captured record with the given message.
+func (h *Handler) Find(msg string) (Record, bool) {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+
+	for _, r := range h.store.records {
+		if r.Message == msg {
+			return r, true
+		}
+	}
+
+	return Record{}, false
+}
+
+// Reset discards all captured records.
+func (h *Handler) Reset() {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+
+	h.store.records = nil
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the btclogv2.Handler interface.
+func (h *Handler) Level() btclog.Level {
+	return h.level.load()
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the btclogv2.Handler interface.
+func (h *Handler) SetLevel(level btclog.Level) {
+	h.level.store(level)
+}
+
+// Enabled reports whether the handler handles records at the given level. A
+// level override carried by the context can lower the level of the handler but
+// not raise it.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= btclogv2.SlogLevel(h.Level()) {
+		return true
+	}
+
+	override, ok := btclogv2.LevelOverride(ctx)
+
+	return ok && level >= btclogv2.SlogLevel(override)
+}
+
+// Handle captures the record.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	rec := Record{
+		Time:    r.Time,
+		Level:   btclogv2.LevelForSlog(r.Level),
+		Tag:     h.tag,
+		Prefix:  h.prefix,
+		Message: r.Message,
+		Attrs:   append([]slog.Attr(nil), h.attrs...),
+	}
+	if h.opts.clock != nil {
+		rec.Time = h.opts.clock()
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		rec.Attrs = appendFlattened(rec.Attrs, h.groupPrefix, a)
+		return true
+	})
+
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+
+	pc := r.PC
+	if h.store.callerPC != 0 {
+		pc = h.store.callerPC
+	}
+	rec.File, rec.Line = callSite(pc)
+
+	h.store.records = append(h.store.records, rec)
+
+	return nil
+}
+
+// WithAttrs returns a new Handler with the given attributes added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	sub := h.with(h.tag, h.prefix, true)
+	for _, a := range attrs {
+		sub.attrs = appendFlattened(sub.attrs, h.groupPrefix, a)
+	}
+
+	return sub
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	sub := h.with(h.tag, h.prefix, true)
+	if name != "" {
+		sub.groupPrefix += name + "."
+	}
+
+	return sub
+}
+
+// SubSystem returns a copy of the given handler but with the new tag and an
+// independent level, or with the tag nested under the current tag and an
+// inherited level if the handler was created with WithHierarchicalSubSystems.
+// All groups added with WithGroup are lost.
+//
+// NOTE: this is part of the btclogv2.Handler interface.
+func (h *Handler) SubSystem(tag string) btclogv2.Handler {
+	if h.opts.hierarchical && h.tag != "" {
+		tag = h.tag + btclogv2.SubSystemSeparator + tag
+	}
+
+	sub := h.with(tag, h.prefix, false)
+	sub.groupPrefix = ""
+
+	return sub
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message. The new handler shares the level of its parent.
+//
+// NOTE: this is part of the btclogv2.Handler interface.
+func (h *Handler) WithPrefix(prefix string) btclogv2.Handler {
+	return h.with(h.tag, prefix, true)
+}
+
+// with returns a copy of the handler with the given tag and prefix. If
+// shareLevel is false, the new handler has a level that either inherits the
+// level of the handler or is an independent copy of it, see
+// WithHierarchicalSubSystems.
+func (h *Handler) with(tag, prefix string, shareLevel bool) *Handler {
+	level := h.level
+	if !shareLevel {
+		level = h.level.derive(h.opts.hierarchical)
+	}
+
+	return &Handler{
+		store:       h.store,
+		opts:        h.opts,
+		level:       level,
+		tag:         tag,
+		prefix:      prefix,
+		attrs:       h.attrs[:len(h.attrs):len(h.attrs)],
+		groupPrefix: h.groupPrefix,
+	}
+}
+
+// inheritLevel is the value of a levelNode that inherits its parent's level.
+const inheritLevel = math.MinInt64
+
+// levelNode holds the level of a Handler. As with the handlers of the btclogv2
+// package, a node either has its own level or inherits the level of its parent
+// so that level changes propagate down a tree of hierarchical subsystems.
+type levelNode struct {
+	parent *levelNode
+	level  atomic.Int64
+}
+
+// load returns the level of the node, which is the level of its closest
+// ancestor if it doesn't have its own level.
+func (n *levelNode) load() btclog.Level {
+	for ; n != nil; n = n.parent {
+		if level := n.level.Load(); level != inheritLevel {
+			return btclog.Level(level)
+		}
+	}
+
+	return btclog.LevelTrace
+}
+
+// store sets the node's own level.
+func (n *levelNode) store(level btclog.Level) {
+	n.level.Store(int64(level))
+}
+
+// derive returns the level of a derived handler. If inherit is true, the new
+// node inherits the level of n. Otherwise, it has a copy of the current level
+// of n.
+func (n *levelNode) derive(inherit bool) *levelNode {
+	child := &levelNode{}
+	if inherit {
+		child.parent = n
+		child.level.Store(inheritLevel)
+	} else {
+		child.store(n.load())
+	}
+
+	return child
+}
+
+// appendFlattened resolves the given attribute and appends it to attrs with
+// its key qualified by the given group prefix. Group attributes are flattened
+// into one attribute per member.
+func appendFlattened(attrs []slog.Attr, prefix string,
+	a slog.Attr) []slog.Attr {
+
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		if a.Key == "" {
+			return attrs
+		}
+		a.Key = prefix + a.Key
+
+		return append(attrs, a)
+	}
+
+	// A group with an empty key is inlined.
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		attrs = appendFlattened(attrs, prefix, ga)
+	}
+
+	return attrs
+}
+
+// setCallerPC sets the PC that is used to determine the call-site of the
+// records captured by the handler and all handlers derived from it, instead of
+// their own PC. A PC of zero restores the PC of the records.
+func (h *Handler) setCallerPC(pc uintptr) {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+
+	h.store.callerPC = pc
+}
+
+// callSite returns the file and line of the given program counter, which is
+// the PC of a record.
+func callSite(pc uintptr) (string, int) {
+	if pc == 0 {
+		return "", 0
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+
+	return frame.File, frame.Line
+}
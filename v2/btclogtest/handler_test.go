@@ -0,0 +1,230 @@
+package btclogtest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	btclogv2 "github.com/btcsuite/btclog/v2"
+)
+
+// TestHandler tests that records are captured with their subsystem, prefix,
+// attributes and call-site and that they can be queried.
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2009, time.January, 3, 12, 0, 0, 0, time.UTC)
+	log, handler := NewLogger(WithClock(StepClock(start, time.Second)))
+	ctx := context.Background()
+
+	peerLog := log.SubSystem("PEER").WithPrefix("(inbound)").
+		With("id", 1).WithGroup("conn")
+
+	_, _, line, _ := runtime.Caller(0)
+	peerLog.InfoS(ctx, "Connected", "addr", "1.2.3.4")
+	log.Debugf("Height %d", 5)
+	log.ErrorS(ctx, "Failed", errors.New("boom"))
+
+	if len(handler.All()) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(handler.All()))
+	}
+	if len(handler.Records(btclog.LevelInfo)) != 2 {
+		t.Fatalf("Expected 2 records at info or above, got %d",
+			len(handler.Records(btclog.LevelInfo)))
+	}
+
+	r, ok := handler.Find("Connected")
+	if !ok {
+		t.Fatalf("Record not found")
+	}
+	if r.Level != btclog.LevelInfo || r.Tag != "PEER" ||
+		r.Prefix != "(inbound)" || !r.Time.Equal(start) {
+
+		t.Fatalf("Unexpected record: %+v", r)
+	}
+	if v, ok := r.AttrValue("id"); !ok || v.Int64() != 1 {
+		t.Fatalf("Unexpected id attribute: %v", v)
+	}
+	if v, ok := r.AttrValue("conn.addr"); !ok || v.String() != "1.2.3.4" {
+		t.Fatalf("Unexpected conn.addr attribute: %v", v)
+	}
+	if filepath.Base(r.File) != "handler_test.go" || r.Line != line+1 {
+		t.Fatalf("Unexpected call-site %s:%d", r.File, r.Line)
+	}
+
+	r, _ = handler.Find("Failed")
+	if r.Level != btclog.LevelError || !r.Time.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("Unexpected record: %+v", r)
+	}
+	if v, _ := r.AttrValue("err"); v.String() != "boom" {
+		t.Fatalf("Unexpected err attribute: %v", v)
+	}
+
+	handler.Reset()
+	if len(handler.All()) != 0 {
+		t.Fatalf("Expected no records after reset")
+	}
+}
+
+// TestHandlerSlogCallSite tests that the call-site of a record logged with a
+// slog.Logger is that of the logging call.
+func TestHandlerSlogCallSite(t *testing.T) {
+	t.Parallel()
+
+	handler := NewHandler()
+	log := slog.New(handler).With("id", 1)
+
+	_, _, line, _ := runtime.Caller(0)
+	log.Info("Connected")
+
+	r, ok := handler.Find("Connected")
+	if !ok {
+		t.Fatalf("Record not found")
+	}
+	if filepath.Base(r.File) != "handler_test.go" || r.Line != line+1 {
+		t.Fatalf("Unexpected call-site %s:%d", r.File, r.Line)
+	}
+}
+
+// recordingTB is a testing.TB that records the output passed to Log.
+type recordingTB struct {
+	testing.TB
+
+	mu   sync.Mutex
+	logs []string
+}
+
+// Helper is a no-op.
+func (r *recordingTB) Helper() {}
+
+// Log records the given arguments.
+func (r *recordingTB) Log(args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, arg := range args {
+		r.logs = append(r.logs, arg.(string))
+	}
+}
+
+// TestHandlerHierarchy tests that hierarchical subsystems have nested tags and
+// inherit the level of their parent until their own level is set.
+func TestHandlerHierarchy(t *testing.T) {
+	t.Parallel()
+
+	log, handler := NewLogger(
+		WithLevel(btclog.LevelInfo), WithHierarchicalSubSystems(),
+	)
+	peerLog := log.SubSystem("PEER")
+	connLog := peerLog.SubSystem("CONN")
+
+	peerLog.SetLevel(btclog.LevelDebug)
+	if connLog.Level() != btclog.LevelDebug {
+		t.Fatalf("Expected level debug, got %s", connLog.Level())
+	}
+	if log.Level() != btclog.LevelInfo {
+		t.Fatalf("Expected root level info, got %s", log.Level())
+	}
+
+	connLog.Debug("Nested")
+	if r, ok := handler.Find("Nested"); !ok || r.Tag != "PEER.CONN" {
+		t.Fatalf("Expected nested record, got %+v", r)
+	}
+
+	connLog.SetLevel(btclog.LevelTrace)
+	peerLog.SetLevel(btclog.LevelWarn)
+	if connLog.Level() != btclog.LevelTrace {
+		t.Fatalf("Expected level trace, got %s", connLog.Level())
+	}
+}
+
+// TestTestLogger tests that the output of a TestLogger is passed to the
+// testing.TB and that its records are captured.
+func TestTestLogger(t *testing.T) {
+	t.Parallel()
+
+	tb := &recordingTB{TB: t}
+	log := NewTestLogger(tb, WithLevel(btclog.LevelDebug))
+
+	var l btclogv2.Logger = log.SubSystem("PEER").With("id", 1)
+	_, _, line, _ := runtime.Caller(0)
+	l.Infof("Connected %d", 1)
+	l.Trace("Hidden")
+	l.WarnS(context.Background(), "Slow", nil, "ms", 250)
+
+	expected := []string{
+		"[INF] PEER: Connected 1 id=1",
+		"[WRN] PEER: Slow id=1 ms=250",
+	}
+	if len(tb.logs) != len(expected) {
+		t.Fatalf("Expected %d logs, got %d: %v", len(expected),
+			len(tb.logs), tb.logs)
+	}
+	for i := range expected {
+		if tb.logs[i] != expected[i] {
+			t.Fatalf("Expected %q, got %q", expected[i], tb.logs[i])
+		}
+	}
+
+	if len(log.Handler().All()) != 2 {
+		t.Fatalf("Expected 2 records, got %d",
+			len(log.Handler().All()))
+	}
+
+	// The call-site of a record is that of the call to the TestLogger
+	// rather than that of the call to the logger it wraps.
+	r, _ := log.Handler().Find("Connected 1")
+	if filepath.Base(r.File) != "handler_test.go" || r.Line != line+1 {
+		t.Fatalf("Unexpected call-site %s:%d", r.File, r.Line)
+	}
+
+	// The real testing.TB should also be accepted.
+	NewTestLogger(t).Info("Logged via t.Log")
+}
+
+// TestTestLoggerSetLevelFor tests that the expiry of a timed level elevation of
+// a TestLogger is passed to the testing.TB.
+func TestTestLoggerSetLevelFor(t *testing.T) {
+	t.Parallel()
+
+	tb := &recordingTB{TB: t}
+	log := NewTestLogger(tb, WithLevel(btclog.LevelWarn))
+
+	log.SetLevelFor(btclog.LevelTrace, 10*time.Millisecond)
+	log.Trace("Elevated")
+
+	const expired = "Temporary log level TRC expired, log level is now WRN"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := log.Handler().Find(expired); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Elevation did not expire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The expiry is captured and passed to the testing.TB under the same
+	// lock, so it has been passed once the logger can log again.
+	log.Warn("Done")
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	expected := []string{"[TRC]: Elevated", "[INF]: " + expired,
+		"[WRN]: Done"}
+	if !reflect.DeepEqual(tb.logs, expected) {
+		t.Fatalf("Expected %q, got %q", expected, tb.logs)
+	}
+	if log.Level() != btclog.LevelWarn {
+		t.Fatalf("Expected level warn, got %s", log.Level())
+	}
+}
@@ -0,0 +1,371 @@
+package btclogtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+	btclogv2 "github.com/btcsuite/btclog/v2"
+)
+
+// testOutput holds the formatted output of a TestLogger and the loggers derived
+// from it before it is passed to testing.TB.Log.
+type testOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// TestLogger is a Logger that writes each log message via the Log method of a
+// testing.TB, so that the output is attributed to the test and only shown if
+// the test fails or is run in verbose mode. All methods are marked as test
+// helpers so that the call-site reported by the testing package is that of the
+// logging call. The records are also captured and can be queried through the
+// Handler returned by Handler.
+type TestLogger struct {
+	tb      testing.TB
+	logger  btclogv2.Logger
+	handler *Handler
+	out     *testOutput
+}
+
+// A compile-time check to ensure that TestLogger implements btclogv2.Logger.
+var _ btclogv2.Logger = (*TestLogger)(nil)
+
+// A compile-time check to ensure that TestLogger implements
+// btclogv2.LevelElevator.
+var _ btclogv2.LevelElevator = (*TestLogger)(nil)
+
+// NewTestLogger creates a new TestLogger that writes to the given testing.TB.
+//
+// Example usage:
+//
+//	func TestPeer(t *testing.T) {
+//		log := btclogtest.NewTestLogger(t)
+//		p := newPeer(log.SubSystem("PEER"))
+//		...
+//		if _, ok := log.Handler().Find("Connected"); !ok {
+//			t.Fatal("peer did not connect")
+//		}
+//	}
+func NewTestLogger(tb testing.TB, opts ...Option) *TestLogger {
+	out := &testOutput{}
+
+	capture := NewHandler(opts...)
+	text := btclogv2.NewDefaultHandler(&out.buf, btclogv2.WithNoTimestamp())
+	text.SetLevel(btclog.LevelTrace)
+
+	handler := btclogv2.NewMultiHandler(capture, text)
+	handler.SetLevel(capture.Level())
+
+	return &TestLogger{
+		tb:      tb,
+		logger:  btclogv2.NewSLogger(handler),
+		handler: capture,
+		out:     out,
+	}
+}
+
+// Handler returns the Handler that captures the records of the logger and of
+// all loggers derived from it.
+func (l *TestLogger) Handler() *Handler {
+	return l.handler
+}
+
+// log calls the given function, which logs via the underlying logger, and
+// passes the resulting output to the testing.TB.
+func (l *TestLogger) log(fn func()) {
+	l.tb.Helper()
+
+	// Skip runtime.Callers, this function and the logging method, so that
+	// the records are captured with the call-site of the logging call.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	l.out.mu.Lock()
+	l.handler.setCallerPC(pcs[0])
+	fn()
+	l.handler.setCallerPC(0)
+	output := strings.TrimSuffix(l.out.buf.String(), "\n")
+	l.out.buf.Reset()
+	l.out.mu.Unlock()
+
+	if output != "" {
+		l.tb.Log(output)
+	}
+}
+
+// derive returns a new TestLogger that shares the output of l but logs via the
+// given logger.
+func (l *TestLogger) derive(logger btclogv2.Logger) *TestLogger {
+	return &TestLogger{
+		tb:      l.tb,
+		logger:  logger,
+		handler: l.handler,
+		out:     l.out,
+	}
+}
+
+// Tracef formats the message according to the format specifier and writes it
+// with LevelTrace.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Tracef(format string, params ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Tracef(format, params...) })
+}
+
+// Debugf formats the message according to the format specifier and writes it
+// with LevelDebug.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Debugf(format string, params ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Debugf(format, params...) })
+}
+
+// Infof formats the message according to the format specifier and writes it
+// with LevelInfo.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Infof(format string, params ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Infof(format, params...) })
+}
+
+// Warnf formats the message according to the format specifier and writes it
+// with LevelWarn.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Warnf(format string, params ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Warnf(format, params...) })
+}
+
+// Errorf formats the message according to the format specifier and writes it
+// with LevelError.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Errorf(format string, params ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Errorf(format, params...) })
+}
+
+// Criticalf formats the message according to the format specifier and writes it
+// with LevelCritical.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Criticalf(format string, params ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Criticalf(format, params...) })
+}
+
+// Trace formats the message using the default formats for its operands and
+// writes it with LevelTrace.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Trace(v ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Trace(v...) })
+}
+
+// Debug formats the message using the default formats for its operands and
+// writes it with LevelDebug.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Debug(v ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Debug(v...) })
+}
+
+// Info formats the message using the default formats for its operands and
+// writes it with LevelInfo.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Info(v ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Info(v...) })
+}
+
+// Warn formats the message using the default formats for its operands and
+// writes it with LevelWarn.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Warn(v ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Warn(v...) })
+}
+
+// Error formats the message using the default formats for its operands and
+// writes it with LevelError.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Error(v ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Error(v...) })
+}
+
+// Critical formats the message using the default formats for its operands and
+// writes it with LevelCritical.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Critical(v ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.Critical(v...) })
+}
+
+// TraceS writes a structured log with the given message and key-value pair
+// attributes with LevelTrace.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) TraceS(ctx context.Context, msg string, attrs ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.TraceS(ctx, msg, attrs...) })
+}
+
+// DebugS writes a structured log with the given message and key-value pair
+// attributes with LevelDebug.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) DebugS(ctx context.Context, msg string, attrs ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.DebugS(ctx, msg, attrs...) })
+}
+
+// InfoS writes a structured log with the given message and key-value pair
+// attributes with LevelInfo.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) InfoS(ctx context.Context, msg string, attrs ...any) {
+	l.tb.Helper()
+	l.log(func() { l.logger.InfoS(ctx, msg, attrs...) })
+}
+
+// WarnS writes a structured log with the given message, error and key-value
+// pair attributes with LevelWarn.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) WarnS(ctx context.Context, msg string, err error,
+	attrs ...any) {
+
+	l.tb.Helper()
+	l.log(func() { l.logger.WarnS(ctx, msg, err, attrs...) })
+}
+
+// ErrorS writes a structured log with the given message, error and key-value
+// pair attributes with LevelError.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) ErrorS(ctx context.Context, msg string, err error,
+	attrs ...any) {
+
+	l.tb.Helper()
+	l.log(func() { l.logger.ErrorS(ctx, msg, err, attrs...) })
+}
+
+// CriticalS writes a structured log with the given message, error and key-value
+// pair attributes with LevelCritical.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) CriticalS(ctx context.Context, msg string, err error,
+	attrs ...any) {
+
+	l.tb.Helper()
+	l.log(func() { l.logger.CriticalS(ctx, msg, err, attrs...) })
+}
+
+// Level returns the current logging level.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) Level() btclog.Level {
+	return l.logger.Level()
+}
+
+// SetLevel changes the logging level to the passed level.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) SetLevel(level btclog.Level) {
+	l.logger.SetLevel(level)
+}
+
+// ElevateLevel lowers the logging level to the passed level until the returned
+// restore function is called.
+//
+// This is part of the btclogv2.LevelElevator interface implementation.
+func (l *TestLogger) ElevateLevel(level btclog.Level) func() {
+	return l.logger.(btclogv2.LevelElevator).ElevateLevel(level)
+}
+
+// SetLevelFor lowers the logging level to the passed level for the given
+// duration or until the returned restore function is called. The message that
+// is logged when the elevation expires is passed to the testing.TB like any
+// other message. The elevation is restored once the test completes, so that it
+// can't expire afterwards.
+//
+// This is part of the btclogv2.LevelElevator interface implementation.
+func (l *TestLogger) SetLevelFor(level btclog.Level, d time.Duration) func() {
+	restore := l.ElevateLevel(level)
+
+	var once sync.Once
+	timer := time.AfterFunc(d, func() {
+		once.Do(func() {
+			l.log(func() {
+				restore()
+
+				// The message is logged at the info level
+				// regardless of the restored level.
+				ctx := btclogv2.WithLevelOverride(
+					context.Background(), btclog.LevelInfo,
+				)
+				l.logger.InfoS(ctx, fmt.Sprintf("Temporary log "+
+					"level %s expired, log level is now %s",
+					btclogv2.LevelString(level),
+					btclogv2.LevelString(l.logger.Level())))
+			})
+		})
+	})
+
+	stop := func() {
+		timer.Stop()
+		once.Do(restore)
+	}
+	l.tb.Cleanup(stop)
+
+	return stop
+}
+
+// SubSystem returns a copy of the logger but with the new subsystem tag.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) SubSystem(tag string) btclogv2.Logger {
+	return l.derive(l.logger.SubSystem(tag))
+}
+
+// WithPrefix returns a copy of the logger but with the given string prefixed
+// to each log message.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) WithPrefix(prefix string) btclogv2.Logger {
+	return l.derive(l.logger.WithPrefix(prefix))
+}
+
+// With returns a copy of the logger with the given key-value pair attributes
+// added to each log message.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) With(attrs ...any) btclogv2.Logger {
+	return l.derive(l.logger.With(attrs...))
+}
+
+// WithGroup returns a copy of the logger with the given group appended to the
+// logger's existing groups.
+//
+// This is part of the btclogv2.Logger interface implementation.
+func (l *TestLogger) WithGroup(name string) btclogv2.Logger {
+	return l.derive(l.logger.WithGroup(name))
+}
@@ -0,0 +1,99 @@
+// btclogverify verifies log files that were written through a
+// btclog.HashChainWriter, either by the handlers of the v2 package or by a v1
+// Backend, and reports the first broken link or bad checkpoint signature of
+// each file.
+//
+// Usage:
+//
+//	btclogverify [-pubkey <hex>] [file ...]
+//	btclogverify -genkey
+//
+// Standard input is verified if no files are given. Checkpoint signatures are
+// only verified if a public key is given. The -genkey flag generates a new
+// ed25519 key pair for signing checkpoints.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/btcsuite/btclog/v2"
+)
+
+func main() {
+	pubKeyHex := flag.String("pubkey", "", "hex encoded ed25519 public key "+
+		"that signed the checkpoints")
+	genKey := flag.Bool("genkey", false, "generate a new key pair and exit")
+	flag.Parse()
+
+	if *genKey {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fatalf("unable to generate key: %v", err)
+		}
+		fmt.Printf("seed:   %x\n", priv.Seed())
+		fmt.Printf("pubkey: %x\n", pub)
+		return
+	}
+
+	var pub ed25519.PublicKey
+	if *pubKeyHex != "" {
+		var err error
+		pub, err = btclog.ParsePublicKey(*pubKeyHex)
+		if err != nil {
+			fatalf("invalid -pubkey: %v", err)
+		}
+	}
+
+	if flag.NArg() == 0 {
+		if !verify("<stdin>", os.Stdin, pub) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	ok := true
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			ok = false
+			continue
+		}
+		ok = verify(path, f, pub) && ok
+		f.Close()
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// verify verifies the log read from r and prints the result. It returns false
+// if the log failed verification.
+func verify(name string, r io.Reader, pub ed25519.PublicKey) bool {
+	stats, err := btclog.VerifyHashChain(r, pub)
+	if err != nil {
+		fmt.Printf("%s: FAILED: %v\n", name, err)
+		return false
+	}
+
+	fmt.Printf("%s: OK: %d records, %d checkpoints", name, stats.Records,
+		stats.Checkpoints)
+	if stats.Unsigned > 0 {
+		fmt.Printf(" (%d records not covered by a signed checkpoint)",
+			stats.Unsigned)
+	}
+	fmt.Println()
+
+	return true
+}
+
+// fatalf prints the formatted message to stderr and exits.
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,141 @@
+package btclog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+const (
+	// TraceIDKey is the attribute key of a trace ID set with WithTraceID.
+	TraceIDKey = "trace_id"
+
+	// SpanIDKey is the attribute key of a span ID set with WithSpanID.
+	SpanIDKey = "span_id"
+)
+
+// ContextExtractor is a function that returns the logging attributes that
+// should be attached to every structured log record written with the given
+// context.
+type ContextExtractor func(ctx context.Context) []slog.Attr
+
+// extractor is a registered context extractor. Registrations are identified by
+// the address of their extractor so that they can be removed.
+type extractor struct {
+	fn ContextExtractor
+}
+
+var (
+	// extractorsMu protects extractors.
+	extractorsMu sync.RWMutex
+
+	// extractors holds the registered context extractors. The built-in
+	// extractor of trace and span IDs is always consulted first.
+	extractors = []*extractor{{fn: extractIDs}}
+)
+
+// RegisterContextExtractor registers a function that is consulted by the
+// structured logging methods of a Logger, such as InfoS, for attributes to
+// attach to each record. Extractors are consulted in the order in which they
+// were registered and their attributes precede those associated with the
+// context using WithCtx and those passed to the logging call. If a key appears
+// more than once, the value that appears last is used.
+//
+// The returned function unregisters the extractor. It may be called more than
+// once, which allows it to be deferred or passed to testing.T.Cleanup.
+//
+// Example usage:
+//
+//	unregister := btclog.RegisterContextExtractor(
+//		func(ctx context.Context) []slog.Attr {
+//			peer, ok := ctx.Value(peerKey{}).(string)
+//			if !ok {
+//				return nil
+//			}
+//			return []slog.Attr{slog.String("peer", peer)}
+//		},
+//	)
+//	defer unregister()
+func RegisterContextExtractor(fn ContextExtractor) func() {
+	e := &extractor{fn: fn}
+
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	extractors = append(extractors[:len(extractors):len(extractors)], e)
+
+	return func() {
+		extractorsMu.Lock()
+		defer extractorsMu.Unlock()
+
+		// A new slice is built since extractAttrs may still be
+		// iterating over the current one.
+		remaining := make([]*extractor, 0, len(extractors))
+		for _, registered := range extractors {
+			if registered != e {
+				remaining = append(remaining, registered)
+			}
+		}
+		extractors = remaining
+	}
+}
+
+// extractAttrs returns the attributes returned by all registered context
+// extractors for the given context.
+func extractAttrs(ctx context.Context) []slog.Attr {
+	extractorsMu.RLock()
+	registered := extractors
+	extractorsMu.RUnlock()
+
+	var attrs []slog.Attr
+	for _, e := range registered {
+		attrs = append(attrs, e.fn(ctx)...)
+	}
+
+	return attrs
+}
+
+type traceIDKey struct{}
+
+type spanIDKey struct{}
+
+// WithTraceID returns a copy of the context which carries the given trace ID.
+// The ID is attached to each structured log record written with the context
+// under the TraceIDKey key.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// TraceID returns the trace ID carried by the context, if any.
+func TraceID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(traceIDKey{}).(string)
+
+	return id, ok
+}
+
+// WithSpanID returns a copy of the context which carries the given span ID.
+// The ID is attached to each structured log record written with the context
+// under the SpanIDKey key.
+func WithSpanID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, spanIDKey{}, id)
+}
+
+// SpanID returns the span ID carried by the context, if any.
+func SpanID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(spanIDKey{}).(string)
+
+	return id, ok
+}
+
+// extractIDs is the built-in context extractor of the trace and span IDs.
+func extractIDs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if id, ok := TraceID(ctx); ok {
+		attrs = append(attrs, slog.String(TraceIDKey, id))
+	}
+	if id, ok := SpanID(ctx); ok {
+		attrs = append(attrs, slog.String(SpanIDKey, id))
+	}
+
+	return attrs
+}
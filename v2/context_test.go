@@ -0,0 +1,112 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+// testPeerKey is the context key of the peer attribute used by the context
+// extractor registered in TestContextExtractors.
+type testPeerKey struct{}
+
+// TestContextExtractors tests that the attributes of registered context
+// extractors and trace and span IDs are attached to records and that repeated
+// keys are de-duplicated.
+func TestContextExtractors(t *testing.T) {
+	t.Parallel()
+
+	unregister := RegisterContextExtractor(
+		func(ctx context.Context) []slog.Attr {
+			peer, ok := ctx.Value(testPeerKey{}).(string)
+			if !ok {
+				return nil
+			}
+
+			return []slog.Attr{slog.String("peer", peer)}
+		},
+	)
+	t.Cleanup(unregister)
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(&buf, WithNoTimestamp()))
+
+	ctx := WithTraceID(context.Background(), "4bf92f35")
+	ctx = context.WithValue(ctx, testPeerKey{}, "1.2.3.4")
+	log.InfoS(ctx, "Extracted", "height", 5)
+
+	// Repeated keys are de-duplicated even if the context has no
+	// attributes.
+	log.InfoS(context.Background(), "Repeated", "user", "alice",
+		slog.Int("height", 5), "user", "bob")
+
+	// A key set later in the context chain overrides an earlier one, and
+	// the attributes of the logging call override those of the context.
+	ctx = WithCtx(ctx, "request_id", 1, "user", "alice")
+	ctx = WithSpanID(WithCtx(ctx, "request_id", 2), "00f067aa")
+	log.InfoS(ctx, "Overridden", "user", "bob", "peer", "5.6.7.8")
+
+	// Deriving a context must not modify the attributes of its parent.
+	_ = WithCtx(ctx, "request_id", 3)
+	log.InfoS(ctx, "Parent")
+
+	id, ok := TraceID(ctx)
+	if !ok || id != "4bf92f35" {
+		t.Fatalf("Unexpected trace ID: %v, %v", id, ok)
+	}
+	id, ok = SpanID(ctx)
+	if !ok || id != "00f067aa" {
+		t.Fatalf("Unexpected span ID: %v, %v", id, ok)
+	}
+	if _, ok := SpanID(context.Background()); ok {
+		t.Fatalf("Expected no span ID")
+	}
+
+	expectedLog := `[INF]: Extracted trace_id=4bf92f35 peer=1.2.3.4 height=5
+[INF]: Repeated user=bob height=5
+[INF]: Overridden trace_id=4bf92f35 span_id=00f067aa peer=5.6.7.8 request_id=2 user=bob
+[INF]: Parent trace_id=4bf92f35 span_id=00f067aa peer=1.2.3.4 request_id=2 user=alice
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
+
+// TestUnregisterContextExtractor tests that an unregistered context extractor
+// is no longer consulted.
+func TestUnregisterContextExtractor(t *testing.T) {
+	t.Parallel()
+
+	// The extractor only returns an attribute for the context key of this
+	// test so that it doesn't affect the records of other tests while it's
+	// registered.
+	type key struct{}
+	unregister := RegisterContextExtractor(
+		func(ctx context.Context) []slog.Attr {
+			if ctx.Value(key{}) == nil {
+				return nil
+			}
+
+			return []slog.Attr{slog.Bool("extracted", true)}
+		},
+	)
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(&buf, WithNoTimestamp()))
+	ctx := context.WithValue(context.Background(), key{}, 1)
+
+	log.InfoS(ctx, "Registered")
+	unregister()
+	unregister()
+	log.InfoS(ctx, "Unregistered")
+
+	expectedLog := `[INF]: Registered extracted=true
+[INF]: Unregistered
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
@@ -0,0 +1,331 @@
+package btclog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// DefaultDedupWindow is the default duration within which consecutive
+// identical records are collapsed by a DedupHandler.
+const DefaultDedupWindow = 30 * time.Second
+
+// DedupOption is the signature of a functional option that can be used to
+// modify the behaviour of a DedupHandler.
+type DedupOption func(*dedupOpts)
+
+// dedupOpts holds options that can be modified by a DedupOption.
+type dedupOpts struct {
+	// window is the maximum time between two identical records for them to
+	// be collapsed.
+	window time.Duration
+
+	// timeSource is used to obtain the current time.
+	timeSource func() time.Time
+}
+
+// WithDedupWindow sets the maximum time between two consecutive identical
+// records for them to be collapsed. It is also the time after which the
+// summary of a run of repeated records is written if no other record is.
+func WithDedupWindow(window time.Duration) DedupOption {
+	return func(opts *dedupOpts) {
+		opts.window = window
+	}
+}
+
+// WithDedupTimeSource can be used to overwrite the time source used to
+// determine whether records are within the window of each other.
+func WithDedupTimeSource(fn func() time.Time) DedupOption {
+	return func(opts *dedupOpts) {
+		opts.timeSource = fn
+	}
+}
+
+// dedupState holds the de-duplication state shared by a DedupHandler and all
+// the handlers derived from it.
+type dedupState struct {
+	mu sync.Mutex
+
+	// key identifies the last record that was passed on and handler is the
+	// wrapped handler that it was passed to.
+	key     string
+	handler Handler
+	level   slog.Level
+
+	// last is the time at which the last record was seen, whether it was
+	// passed on or suppressed.
+	last time.Time
+
+	// repeats is the number of times that the last record has been
+	// suppressed in the current run.
+	repeats uint64
+
+	// suppressed is the total number of suppressed records.
+	suppressed uint64
+
+	// timer writes the summary of the current run once no repeat has been
+	// seen for the duration of the window, which is the case once due has
+	// passed. run identifies the current run so that a timer of an earlier
+	// run that fires late doesn't end it.
+	timer *time.Timer
+	due   time.Time
+	run   uint64
+}
+
+// DedupHandler is a Handler that wraps another Handler and collapses
+// consecutive identical records, that is records with the same level,
+// subsystem, prefix, message and attributes, that are seen within the window
+// of each other. Once such a run ends, either because a different record is
+// seen or because no repeat has been seen for the duration of the window, a
+// single "last message repeated N times" record is passed on in its place, as
+// syslog does.
+//
+// All handlers derived from a DedupHandler share its state since records of
+// different subsystems that are interleaved are not consecutive.
+//
+// NOTE: the wrapped handler is called while holding a lock so it must not log
+// through the DedupHandler, for example from an error handler set with
+// WithErrorHandler.
+type DedupHandler struct {
+	handler Handler
+	opts    *dedupOpts
+	state   *dedupState
+
+	// ident identifies the subsystem, prefix, attributes and groups of the
+	// handler.
+	ident string
+}
+
+// A compile-time check to ensure that DedupHandler implements Handler.
+var _ Handler = (*DedupHandler)(nil)
+
+// NewDedupHandler creates a new DedupHandler that wraps the given handler.
+func NewDedupHandler(handler Handler, options ...DedupOption) *DedupHandler {
+	opts := &dedupOpts{
+		window:     DefaultDedupWindow,
+		timeSource: time.Now,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+
+	return &DedupHandler{
+		handler: handler,
+		opts:    opts,
+		state:   &dedupState{},
+	}
+}
+
+// Suppressed returns the total number of records that were not passed on
+// because they repeated the previous record.
+func (d *DedupHandler) Suppressed() uint64 {
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	return d.state.suppressed
+}
+
+// Flush ends the current run of repeated records, if any, and passes on its
+// summary record.
+func (d *DedupHandler) Flush(ctx context.Context) error {
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	return d.flush(ctx)
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the Handler interface.
+func (d *DedupHandler) Level() btclog.Level {
+	return d.handler.Level()
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the Handler interface.
+func (d *DedupHandler) SetLevel(level btclog.Level) {
+	d.handler.SetLevel(level)
+}
+
+// Enabled reports whether the handler handles records at the given level.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (d *DedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return d.handler.Enabled(ctx, level)
+}
+
+// criticalExits returns the CriticalExits that are run after the wrapped
+// handler has handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (d *DedupHandler) criticalExits(level slog.Level) []*CriticalExit {
+	return criticalExitsOf(d.handler, level)
+}
+
+// Handle passes the record on to the wrapped handler unless it repeats the
+// previous record. Records that cause the wrapped handler to exit the process,
+// see WithCriticalExit, are always passed on.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (d *DedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	key := d.recordKey(r)
+	now := d.opts.timeSource()
+
+	s := d.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.handler != nil && s.key == key &&
+		now.Sub(s.last) < d.opts.window &&
+		len(d.criticalExits(r.Level)) == 0 {
+
+		s.repeats++
+		s.suppressed++
+		s.last = now
+
+		s.due = time.Now().Add(d.opts.window)
+		if s.timer == nil {
+			run := s.run
+			s.timer = time.AfterFunc(d.opts.window, func() {
+				_ = d.expire(context.Background(), run)
+			})
+		} else {
+			s.timer.Reset(d.opts.window)
+		}
+
+		return nil
+	}
+
+	// A failure to write the summary doesn't stop the record from being
+	// handled, since the run has ended either way.
+	flushErr := d.flush(ctx)
+
+	s.key = key
+	s.handler = d.handler
+	s.level = r.Level
+	s.last = now
+
+	return errors.Join(flushErr, d.handler.Handle(ctx, r))
+}
+
+// WithAttrs returns a new Handler with the given attributes added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (d *DedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(d.ident)
+	for _, a := range attrs {
+		writeAttrKey(&b, a)
+	}
+
+	return d.with(withAttrs(d.handler, attrs), b.String())
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (d *DedupHandler) WithGroup(name string) slog.Handler {
+	return d.with(withGroup(d.handler, name), d.ident+"\x00g="+name)
+}
+
+// SubSystem returns a copy of the given handler but with the new tag.
+//
+// NOTE: this is part of the Handler interface.
+func (d *DedupHandler) SubSystem(tag string) Handler {
+	return d.with(d.handler.SubSystem(tag), d.ident+"\x00t="+tag)
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message.
+//
+// NOTE: this is part of the Handler interface.
+func (d *DedupHandler) WithPrefix(prefix string) Handler {
+	return d.with(d.handler.WithPrefix(prefix), d.ident+"\x00p="+prefix)
+}
+
+// with returns a new DedupHandler that wraps the given handler.
+func (d *DedupHandler) with(handler Handler, ident string) *DedupHandler {
+	return &DedupHandler{
+		handler: handler,
+		opts:    d.opts,
+		state:   d.state,
+		ident:   ident,
+	}
+}
+
+// expire passes on the summary record of the given run of repeated records once
+// its timer has fired. Nothing is passed on if the timer is stale, which is the
+// case if the run has already ended or if the timer was reset by another repeat
+// while it was waiting for the mutex.
+func (d *DedupHandler) expire(ctx context.Context, run uint64) error {
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+
+	if d.state.run != run || time.Now().Before(d.state.due) {
+		return nil
+	}
+
+	return d.flush(ctx)
+}
+
+// flush passes on the summary record of the current run of repeated records,
+// if any.
+//
+// NOTE: the caller must hold the mutex.
+func (d *DedupHandler) flush(ctx context.Context) error {
+	s := d.state
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	if s.repeats == 0 {
+		return nil
+	}
+	s.run++
+
+	summary := slog.NewRecord(
+		d.opts.timeSource(), s.level,
+		fmt.Sprintf("last message repeated %d times", s.repeats), 0,
+	)
+
+	// The summary ends the run, so the next record is always passed on.
+	handler := s.handler
+	s.repeats = 0
+	s.handler = nil
+
+	if !handler.Enabled(ctx, summary.Level) {
+		return nil
+	}
+
+	return handler.Handle(ctx, summary)
+}
+
+// recordKey returns a string that identifies the given record along with the
+// subsystem, prefix, attributes and groups of the handler.
+func (d *DedupHandler) recordKey(r slog.Record) string {
+	var b strings.Builder
+	b.WriteString(d.ident)
+	fmt.Fprintf(&b, "\x00l=%d\x00m=%s", r.Level, r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttrKey(&b, a)
+		return true
+	})
+
+	return b.String()
+}
+
+// writeAttrKey writes a string that identifies the given attribute to b.
+func writeAttrKey(b *strings.Builder, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	fmt.Fprintf(b, "\x00a=%s", a)
+}
@@ -0,0 +1,212 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDedupHandler tests that consecutive identical records are collapsed and
+// that a summary record is written when the run ends.
+func TestDedupHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf bytes.Buffer
+		now = timeSource()
+		ctx = context.Background()
+	)
+	handler := NewDedupHandler(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithDedupWindow(time.Hour),
+		WithDedupTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	log := NewSLogger(handler.SubSystem("PEER"))
+	srvrLog := NewSLogger(handler.SubSystem("SRVR"))
+
+	for i := 0; i < 4; i++ {
+		log.InfoS(ctx, "Reconnecting", "peer", "1.2.3.4")
+	}
+
+	// Records that differ in their attributes, level or subsystem are not
+	// collapsed.
+	log.InfoS(ctx, "Reconnecting", "peer", "5.6.7.8")
+	log.WarnS(ctx, "Reconnecting", nil, "peer", "5.6.7.8")
+	srvrLog.WarnS(ctx, "Reconnecting", nil, "peer", "5.6.7.8")
+	srvrLog.WarnS(ctx, "Reconnecting", nil, "peer", "5.6.7.8")
+
+	// A repeat outside of the window starts a new run.
+	now = now.Add(time.Hour)
+	srvrLog.WarnS(ctx, "Reconnecting", nil, "peer", "5.6.7.8")
+	srvrLog.WarnS(ctx, "Reconnecting", nil, "peer", "5.6.7.8")
+
+	if err := handler.Flush(ctx); err != nil {
+		t.Fatalf("Unable to flush: %v", err)
+	}
+
+	expectedLog := `[INF] PEER: Reconnecting peer=1.2.3.4
+[INF] PEER: last message repeated 3 times
+[INF] PEER: Reconnecting peer=5.6.7.8
+[WRN] PEER: Reconnecting peer=5.6.7.8
+[WRN] SRVR: Reconnecting peer=5.6.7.8
+[WRN] SRVR: last message repeated 1 times
+[WRN] SRVR: Reconnecting peer=5.6.7.8
+[WRN] SRVR: last message repeated 1 times
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+
+	if handler.Suppressed() != 5 {
+		t.Fatalf("Expected 5 suppressed records, got %d",
+			handler.Suppressed())
+	}
+}
+
+// TestDedupHandlerTimer tests that the summary record is written once no
+// repeat has been seen for the duration of the window.
+func TestDedupHandlerTimer(t *testing.T) {
+	t.Parallel()
+
+	// The summary is written from a timer so a writer that can be read
+	// concurrently is used.
+	w := newGatedWriter()
+	close(w.release)
+
+	handler := NewDedupHandler(
+		NewDefaultHandler(w, WithNoTimestamp()),
+		WithDedupWindow(10*time.Millisecond),
+	)
+	log := NewSLogger(handler)
+
+	log.Info("Reconnecting")
+	log.Info("Reconnecting")
+
+	expectedLog := `[INF]: Reconnecting
+[INF]: last message repeated 1 times
+`
+	deadline := time.Now().Add(5 * time.Second)
+	for w.String() != expectedLog {
+		if time.Now().After(deadline) {
+			t.Fatalf("Log result mismatch. Expected \n\"%s\", "+
+				"got \n\"%s\"", expectedLog, w.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// rejectWriter is an io.Writer that fails to write anything that contains its
+// reject string.
+type rejectWriter struct {
+	bytes.Buffer
+	reject string
+}
+
+// Write writes p to the buffer or returns errDiskFull if it contains the
+// reject string.
+func (w *rejectWriter) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), w.reject) {
+		return 0, errDiskFull
+	}
+
+	return w.Buffer.Write(p)
+}
+
+// TestDedupHandlerStaleTimer tests that a timer that fires once its run has
+// ended, or before a repeat that reset it is a window old, doesn't end the
+// current run.
+func TestDedupHandlerStaleTimer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf bytes.Buffer
+		ctx = context.Background()
+	)
+	handler := NewDedupHandler(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithDedupWindow(time.Hour),
+	)
+	log := NewSLogger(handler)
+
+	log.Info("Reconnecting")
+	log.Info("Reconnecting")
+	staleRun := handler.state.run
+
+	log.Info("Connected")
+	log.Info("Connected")
+	currentRun := handler.state.run
+
+	for _, run := range []uint64{staleRun, currentRun} {
+		if err := handler.expire(ctx, run); err != nil {
+			t.Fatalf("Unable to expire run: %v", err)
+		}
+	}
+
+	expectedLog := `[INF]: Reconnecting
+[INF]: last message repeated 1 times
+[INF]: Connected
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
+
+// TestDedupHandlerSummaryError tests that a record that ends a run is still
+// handled if the summary record can't be written, and that the error is
+// returned.
+func TestDedupHandlerSummaryError(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w   = &rejectWriter{reject: "repeated"}
+		now = timeSource()
+		ctx = context.Background()
+	)
+	handler := NewDedupHandler(
+		NewDefaultHandler(w, WithNoTimestamp()),
+		WithDedupWindow(time.Hour),
+		WithDedupTimeSource(func() time.Time {
+			return now
+		}),
+	)
+
+	record := func(msg string) slog.Record {
+		return slog.NewRecord(now, slog.LevelInfo, msg, 0)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := handler.Handle(ctx, record("Reconnecting")); err != nil {
+			t.Fatalf("Unable to handle record: %v", err)
+		}
+	}
+
+	err := handler.Handle(ctx, record("Connected"))
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("Expected %v, got %v", errDiskFull, err)
+	}
+
+	// The record that ended the run starts a new one.
+	if err := handler.Handle(ctx, record("Connected")); err != nil {
+		t.Fatalf("Unable to handle record: %v", err)
+	}
+
+	expectedLog := `[INF]: Reconnecting
+[INF]: Connected
+`
+	if w.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, w.Bytes())
+	}
+	if handler.Suppressed() != 2 {
+		t.Fatalf("Expected 2 suppressed records, got %d",
+			handler.Suppressed())
+	}
+}
@@ -0,0 +1,236 @@
+package btclog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// LevelElevator is implemented by loggers whose level can be elevated
+// temporarily, such as the loggers created with NewSLogger. It is not part of
+// the Logger interface so that other implementations of Logger don't need to
+// support it.
+//
+// Example usage:
+//
+//	if e, ok := log.(LevelElevator); ok {
+//		restore := e.SetLevelFor(LevelTrace, time.Hour)
+//		defer restore()
+//	}
+type LevelElevator interface {
+	// ElevateLevel lowers the logging level to the passed level, if it is
+	// more verbose than the current level, until the returned restore
+	// function is called. Overlapping elevations are combined such that
+	// the most verbose active one applies.
+	ElevateLevel(level btclog.Level) (restore func())
+
+	// SetLevelFor lowers the logging level to the passed level, if it is
+	// more verbose than the current level, for the given duration or until
+	// the returned restore function is called. A message is logged when
+	// the elevation expires.
+	SetLevelFor(level btclog.Level, d time.Duration) (restore func())
+}
+
+// levelInheritor is implemented by handlers whose level may be inherited from
+// the handler that they were derived from, see WithHierarchicalSubSystems.
+type levelInheritor interface {
+	// levelInherited returns true if the handler currently inherits its
+	// level.
+	levelInherited() bool
+
+	// resetLevel makes the handler inherit the level of its parent again.
+	resetLevel()
+}
+
+// levelElevations tracks the temporary level elevations of a logger so that
+// they are reverted correctly when they overlap. While elevations are active,
+// the level of the logger is the most verbose of its base level and the levels
+// of all active elevations. Once an elevation ends, the level is recomputed
+// from the remaining ones and, once all have ended, the base level is restored.
+// If the logger inherited its level from its parent before it was elevated, it
+// inherits it again once all elevations have ended. If the level of the logger
+// is changed with SetLevel while elevations are active, the new level becomes
+// the base level.
+//
+// When an elevation created with elevateFor expires, a message is logged at the
+// info level before the level is reverted so that operators can see when the
+// additional output stops.
+//
+// Besides the loggers created with NewSLogger, the LevelHTTPHandler uses it to
+// elevate the levels of other loggers, such as v1 loggers, for a limited time.
+type levelElevations struct {
+	logger Leveler
+
+	mu sync.Mutex
+
+	// base is the level of the logger without any elevations and applied
+	// is the level that was last set on the logger. baseInherited is true
+	// if the base level is inherited from the logger's parent.
+	base          btclog.Level
+	baseInherited bool
+	applied       btclog.Level
+
+	// active holds the active elevations in the order they were created.
+	active []*elevation
+}
+
+// elevation is a single temporary level elevation.
+type elevation struct {
+	level btclog.Level
+	once  sync.Once
+	timer *time.Timer
+}
+
+// newLevelElevations creates a new levelElevations for the given logger. Only a
+// single levelElevations should be used for each level.
+func newLevelElevations(logger Leveler) *levelElevations {
+	return &levelElevations{logger: logger}
+}
+
+// A compile-time check to ensure that levelElevations implements
+// LevelElevator.
+var _ LevelElevator = (*levelElevations)(nil)
+
+// ElevateLevel lowers the logging level to the passed level, if it is more
+// verbose than the current level, until the returned restore function is
+// called.
+//
+// NOTE: this is part of the LevelElevator interface.
+func (e *levelElevations) ElevateLevel(level btclog.Level) func() {
+	return e.elevate(level)
+}
+
+// SetLevelFor lowers the logging level to the passed level, if it is more
+// verbose than the current level, for the given duration or until the returned
+// restore function is called.
+//
+// NOTE: this is part of the LevelElevator interface.
+func (e *levelElevations) SetLevelFor(level btclog.Level,
+	d time.Duration) func() {
+
+	return e.elevateFor(level, d)
+}
+
+// elevate elevates the level of the logger to the passed level until the
+// returned restore function is called. The restore function may be called more
+// than once.
+func (e *levelElevations) elevate(level btclog.Level) func() {
+	el := e.add(level)
+
+	return func() {
+		e.remove(el, false)
+	}
+}
+
+// elevateFor elevates the level of the logger to the passed level for the given
+// duration or until the returned restore function is called. The restore
+// function may be called more than once.
+func (e *levelElevations) elevateFor(level btclog.Level,
+	d time.Duration) func() {
+
+	el := e.add(level)
+
+	// The timer is created while holding the mutex so that it is set
+	// before it can be stopped by the restore function.
+	e.mu.Lock()
+	el.timer = time.AfterFunc(d, func() {
+		e.remove(el, true)
+	})
+	e.mu.Unlock()
+
+	return func() {
+		e.mu.Lock()
+		el.timer.Stop()
+		e.mu.Unlock()
+
+		e.remove(el, false)
+	}
+}
+
+// add adds an elevation to the passed level and applies it.
+func (e *levelElevations) add(level btclog.Level) *elevation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.updateBase()
+
+	el := &elevation{level: level}
+	e.active = append(e.active, el)
+	e.apply(nil)
+
+	return el
+}
+
+// remove ends the given elevation and applies the remaining ones. If expired
+// is true, a message is logged before the level is reverted.
+func (e *levelElevations) remove(el *elevation, expired bool) {
+	el.once.Do(func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.updateBase()
+
+		for i, a := range e.active {
+			if a == el {
+				e.active = append(e.active[:i], e.active[i+1:]...)
+				break
+			}
+		}
+
+		if expired {
+			e.apply(el)
+		} else {
+			e.apply(nil)
+		}
+	})
+}
+
+// updateBase makes the current level of the logger the base level if there are
+// no active elevations or if the level was changed since it was last applied.
+//
+// NOTE: the mutex must be held.
+func (e *levelElevations) updateBase() {
+	level := e.logger.Level()
+	if len(e.active) != 0 && level == e.applied {
+		return
+	}
+
+	e.base = level
+	e.baseInherited = false
+	if li, ok := e.logger.(levelInheritor); ok {
+		e.baseInherited = li.levelInherited()
+	}
+}
+
+// apply sets the level of the logger to the most verbose of the base level and
+// the active elevations. If no elevation is more verbose than an inherited base
+// level, the logger inherits its level again. If an expired elevation is given,
+// a message is logged first if the logger is a btclog.Logger.
+//
+// NOTE: the mutex must be held.
+func (e *levelElevations) apply(expired *elevation) {
+	level := e.base
+	for _, a := range e.active {
+		if toSlogLevel(a.level) < toSlogLevel(level) {
+			level = a.level
+		}
+	}
+
+	l, ok := e.logger.(btclog.Logger)
+	if expired != nil && ok {
+		l.Infof("Temporary log level %s expired, log level is "+
+			"now %s", LevelString(expired.level), LevelString(level))
+	}
+
+	li, ok := e.logger.(levelInheritor)
+	if ok && e.baseInherited && level == e.base {
+		li.resetLevel()
+		e.applied = e.logger.Level()
+
+		return
+	}
+
+	e.applied = level
+	e.logger.SetLevel(level)
+}
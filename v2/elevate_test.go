@@ -0,0 +1,126 @@
+package btclog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// TestElevateLevel tests that overlapping level elevations are combined and
+// reverted correctly.
+func TestElevateLevel(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(&buf, WithNoTimestamp()))
+	prefixLog := log.WithPrefix("(prefix)")
+
+	assertLevel := func(expected btclog.Level) {
+		t.Helper()
+
+		if log.Level() != expected {
+			t.Fatalf("Expected level %s, got %s", expected,
+				log.Level())
+		}
+	}
+
+	// The most verbose active elevation applies, regardless of the order
+	// in which they end. Loggers sharing a level share elevations.
+	elevator := log.(LevelElevator)
+	restoreDebug := elevator.ElevateLevel(LevelDebug)
+	restoreTrace := prefixLog.(LevelElevator).ElevateLevel(LevelTrace)
+	restoreWarn := elevator.ElevateLevel(LevelWarn)
+	assertLevel(LevelTrace)
+
+	restoreTrace()
+	assertLevel(LevelDebug)
+	restoreTrace()
+	assertLevel(LevelDebug)
+
+	restoreDebug()
+	assertLevel(LevelInfo)
+
+	// A level set during an elevation is restored once it ends.
+	log.SetLevel(LevelError)
+	restoreWarn()
+	assertLevel(LevelError)
+
+	// A subsystem has its own level and so its own elevations.
+	subLog := log.SubSystem("SUBS")
+	restore := subLog.(LevelElevator).ElevateLevel(LevelTrace)
+	assertLevel(LevelError)
+	restore()
+	if subLog.Level() != LevelError {
+		t.Fatalf("Expected level error, got %s", subLog.Level())
+	}
+}
+
+// TestElevateLevelInherited tests that a hierarchical subsystem that inherits
+// its level from its parent inherits it again once its elevations have ended.
+func TestElevateLevelInherited(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(
+		&buf, WithNoTimestamp(), WithHierarchicalSubSystems(),
+	))
+	peerLog := log.SubSystem("PEER")
+
+	restore := peerLog.(LevelElevator).ElevateLevel(LevelTrace)
+	log.SetLevel(LevelWarn)
+	if peerLog.Level() != LevelTrace {
+		t.Fatalf("Expected level trace, got %s", peerLog.Level())
+	}
+
+	restore()
+	if peerLog.Level() != LevelWarn {
+		t.Fatalf("Expected inherited level warn, got %s",
+			peerLog.Level())
+	}
+
+	log.SetLevel(LevelDebug)
+	if peerLog.Level() != LevelDebug {
+		t.Fatalf("Expected inherited level debug, got %s",
+			peerLog.Level())
+	}
+}
+
+// TestSetLevelFor tests that timed elevations are reverted once they expire
+// and that their expiry is logged.
+func TestSetLevelFor(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(&buf, WithNoTimestamp()))
+	elevator := log.(LevelElevator)
+
+	// An elevation that is restored early does not log.
+	restore := elevator.SetLevelFor(LevelDebug, time.Hour)
+	restore()
+
+	elevator.SetLevelFor(LevelTrace, 10*time.Millisecond)
+	elevator.SetLevelFor(LevelDebug, time.Hour)
+	if log.Level() != LevelTrace {
+		t.Fatalf("Expected level trace, got %s", log.Level())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for log.Level() == LevelTrace {
+		if time.Now().After(deadline) {
+			t.Fatalf("Elevation did not expire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if log.Level() != LevelDebug {
+		t.Fatalf("Expected level debug, got %s", log.Level())
+	}
+
+	expected := "[INF]: Temporary log level TRC expired, log level is " +
+		"now DBG\n"
+	if buf.String() != expected {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expected, buf.Bytes())
+	}
+}
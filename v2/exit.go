@@ -0,0 +1,347 @@
+package btclog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultExitCode is the default code that the process exits with
+	// after a critical record.
+	DefaultExitCode = 1
+
+	// DefaultExitTimeout is the default time that is allowed for running
+	// the shutdown hooks and closing the sinks before the process exits.
+	DefaultExitTimeout = 5 * time.Second
+)
+
+// CriticalExitOption is the signature of a functional option that can be used
+// to modify the behaviour of a CriticalExit.
+type CriticalExitOption func(*criticalExitOpts)
+
+// criticalExitOpts holds options that can be modified by a CriticalExitOption.
+type criticalExitOpts struct {
+	code     int
+	timeout  time.Duration
+	exitFn   func(int)
+	dump     io.Writer
+	errorsTo io.Writer
+}
+
+// defaultCriticalExitOpts constructs a criticalExitOpts with default settings.
+func defaultCriticalExitOpts() *criticalExitOpts {
+	return &criticalExitOpts{
+		code:     DefaultExitCode,
+		timeout:  DefaultExitTimeout,
+		exitFn:   os.Exit,
+		errorsTo: os.Stderr,
+	}
+}
+
+// WithExitCode sets the code that the process exits with.
+func WithExitCode(code int) CriticalExitOption {
+	return func(opts *criticalExitOpts) {
+		opts.code = code
+	}
+}
+
+// WithExitTimeout sets the time that is allowed for running the shutdown hooks
+// and closing the sinks. The process exits once it has passed, even if they
+// haven't completed.
+func WithExitTimeout(timeout time.Duration) CriticalExitOption {
+	return func(opts *criticalExitOpts) {
+		opts.timeout = timeout
+	}
+}
+
+// WithExitFunc sets the function that is called to exit the process instead of
+// os.Exit, which allows the behaviour to be tested.
+func WithExitFunc(fn func(code int)) CriticalExitOption {
+	return func(opts *criticalExitOpts) {
+		opts.exitFn = fn
+	}
+}
+
+// WithGoroutineDump causes the stack traces of all goroutines to be written to
+// the given writer before the shutdown hooks are run. The writer is usually
+// the one that the log is written to, so that the dump follows the critical
+// record.
+func WithGoroutineDump(w io.Writer) CriticalExitOption {
+	return func(opts *criticalExitOpts) {
+		opts.dump = w
+	}
+}
+
+// WithExitErrorWriter sets the writer that errors returned by the shutdown
+// hooks and sinks, and a timeout, are reported to. It defaults to os.Stderr
+// since the log itself may already be closed.
+func WithExitErrorWriter(w io.Writer) CriticalExitOption {
+	return func(opts *criticalExitOpts) {
+		opts.errorsTo = w
+	}
+}
+
+// WithCriticalExit causes the handler to exit the process with the given
+// CriticalExit after it has handled a record at the critical level or above,
+// which makes calls such as Critical and CriticalS fatal. Such records are
+// written if the level of the handler allows it, but the process exits in
+// either case.
+func WithCriticalExit(c *CriticalExit) HandlerOption {
+	return func(opts *handlerOpts) {
+		opts.criticalExit = c
+	}
+}
+
+// exitsAt returns true if a handler with these options exits the process after
+// handling a record at the given level.
+func (o *handlerOpts) exitsAt(level slog.Level) bool {
+	return o.criticalExit.exitsAt(level)
+}
+
+// criticalExiter is implemented by handlers that exit the process after they
+// have handled a record at the critical level or above.
+type criticalExiter interface {
+	// criticalExits returns the CriticalExits that are run after the
+	// handler has handled a record at the given level.
+	criticalExits(level slog.Level) []*CriticalExit
+}
+
+// criticalExitsOf returns the CriticalExits that are run after the given
+// handler has handled a record at the given level.
+func criticalExitsOf(h slog.Handler, level slog.Level) []*CriticalExit {
+	if e, ok := h.(criticalExiter); ok {
+		return e.criticalExits(level)
+	}
+
+	return nil
+}
+
+type deferredExitKey struct{}
+
+// withDeferredExit returns a copy of the context which causes the handlers
+// that records written with it are passed to not to exit the process. It is
+// used by the MultiHandler to exit only once all of its children have handled
+// a record.
+func withDeferredExit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deferredExitKey{}, true)
+}
+
+// exitDeferred returns true if the context was returned by withDeferredExit.
+func exitDeferred(ctx context.Context) bool {
+	deferred, _ := ctx.Value(deferredExitKey{}).(bool)
+	return deferred
+}
+
+// CriticalExit exits the process after a critical record has been written by
+// a handler created with the WithCriticalExit, WithSyslogCriticalExit or
+// WithAdapterCriticalExit option. A MultiHandler with such children exits once
+// all of its children have handled the record. Before exiting, it runs the
+// registered shutdown hooks and then closes the registered sinks, such as an
+// AsyncWriter or a RotatingFile, so that the final records aren't lost. Both are
+// given a limited time to complete, after which the process exits anyway.
+//
+// A CriticalExit only exits once. A critical record written by a shutdown hook
+// while the process is exiting doesn't start another shutdown. One written by
+// another goroutine blocks that goroutine until the process has exited, so that
+// it doesn't carry on as if the record hadn't been fatal.
+type CriticalExit struct {
+	opts *criticalExitOpts
+
+	mu    sync.Mutex
+	hooks []func() error
+	sinks []io.Closer
+
+	exiting atomic.Bool
+
+	// exited is closed once the exit function has returned, which only
+	// happens if one was set with WithExitFunc.
+	exited chan struct{}
+}
+
+// NewCriticalExit creates a new CriticalExit with the given options.
+func NewCriticalExit(options ...CriticalExitOption) *CriticalExit {
+	opts := defaultCriticalExitOpts()
+	for _, o := range options {
+		o(opts)
+	}
+
+	return &CriticalExit{
+		opts:   opts,
+		exited: make(chan struct{}),
+	}
+}
+
+// RegisterShutdownHook registers a function that is run before the process
+// exits, such as one that stops a server or closes a database. Hooks are run
+// in the reverse order of their registration, before the sinks are closed so
+// that anything they log is written.
+func (c *CriticalExit) RegisterShutdownHook(fn func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hooks = append(c.hooks, fn)
+}
+
+// RegisterSink registers a sink that is closed before the process exits, after
+// the shutdown hooks have run. Sinks are closed in the reverse order of their
+// registration, so a writer should be registered before any AsyncWriter that
+// wraps it.
+func (c *CriticalExit) RegisterSink(sink io.Closer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sinks = append(c.sinks, sink)
+}
+
+// exitsAt returns true if c is set and exits the process after a record at the
+// given level has been handled.
+func (c *CriticalExit) exitsAt(level slog.Level) bool {
+	return c != nil && level >= levelCritical
+}
+
+// exits returns c in a slice if it exits the process after a record at the
+// given level has been handled.
+func (c *CriticalExit) exits(level slog.Level) []*CriticalExit {
+	if !c.exitsAt(level) {
+		return nil
+	}
+
+	return []*CriticalExit{c}
+}
+
+// handled is called by a handler once it has handled a record at a level that
+// c exits at. It exits the process unless the exit was deferred by the context
+// of the record.
+func (c *CriticalExit) handled(ctx context.Context) {
+	if exitDeferred(ctx) {
+		return
+	}
+
+	c.Exit()
+}
+
+// Exit writes the goroutine dump if enabled, runs the shutdown hooks, closes
+// the sinks and then exits the process. If the process is already exiting, it
+// returns immediately when called by a shutdown hook or a sink, and otherwise
+// blocks until the process has exited. If an exit function was set with
+// WithExitFunc, Exit returns once it has returned.
+func (c *CriticalExit) Exit() {
+	if !c.exiting.CompareAndSwap(false, true) {
+		if !inShutdown() {
+			<-c.exited
+		}
+
+		return
+	}
+	defer close(c.exited)
+
+	if c.opts.dump != nil {
+		_, _ = c.opts.dump.Write(goroutineDump())
+	}
+
+	c.mu.Lock()
+	hooks := append([]func() error(nil), c.hooks...)
+	sinks := append([]io.Closer(nil), c.sinks...)
+	c.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- shutdown(hooks, sinks)
+	}()
+
+	timer := time.NewTimer(c.opts.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			c.reportErr(err)
+		}
+
+	case <-timer.C:
+		c.reportErr(fmt.Errorf("shutdown timed out after %v",
+			c.opts.timeout))
+	}
+
+	c.opts.exitFn(c.opts.code)
+}
+
+// shutdown runs the given shutdown hooks and then closes the given sinks, both
+// in reverse order.
+func shutdown(hooks []func() error, sinks []io.Closer) error {
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := len(sinks) - 1; i >= 0; i-- {
+		if err := sinks[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// shutdownFunc is the name of the shutdown function as reported by the
+// runtime.
+var shutdownFunc = runtime.FuncForPC(
+	reflect.ValueOf(shutdown).Pointer(),
+).Name()
+
+// inShutdown returns true if it is called by a shutdown hook or a sink while
+// they are run by shutdown, which is the case if shutdown is on the stack of
+// the calling goroutine.
+func inShutdown() bool {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(2, pcs)
+		if n == len(pcs) {
+			pcs = make([]uintptr, 2*len(pcs))
+			continue
+		}
+
+		frames := runtime.CallersFrames(pcs[:n])
+		for {
+			frame, more := frames.Next()
+			if frame.Function == shutdownFunc {
+				return true
+			}
+			if !more {
+				return false
+			}
+		}
+	}
+}
+
+// reportErr writes an error that occurred while exiting to the error writer.
+func (c *CriticalExit) reportErr(err error) {
+	if c.opts.errorsTo == nil {
+		return
+	}
+
+	_, _ = fmt.Fprintf(c.opts.errorsTo, "btclog: error during critical "+
+		"exit: %v\n", err)
+}
+
+// goroutineDump returns the stack traces of all goroutines.
+func goroutineDump() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,256 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCriticalExit tests that a critical record causes the process to exit
+// once, after the shutdown hooks have run and the sinks have been closed.
+func TestCriticalExit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf   bytes.Buffer
+		codes []int
+	)
+	async := NewAsyncWriter(&buf)
+	exit := NewCriticalExit(
+		WithExitCode(3),
+		WithExitFunc(func(code int) {
+			codes = append(codes, code)
+		}),
+	)
+	exit.RegisterSink(async)
+
+	handler := NewDefaultHandler(
+		async, WithNoTimestamp(), WithCriticalExit(exit),
+	)
+	log := NewSLogger(handler)
+	ctx := context.Background()
+
+	exit.RegisterShutdownHook(func() error {
+		log.Info("First hook")
+		return nil
+	})
+	exit.RegisterShutdownHook(func() error {
+		log.Info("Second hook")
+
+		// A critical record written while exiting doesn't exit
+		// again.
+		log.Critical("Critical hook")
+
+		return nil
+	})
+
+	log.Error("Not fatal")
+	log.CriticalS(ctx, "Fatal", errors.New("boom"), "n", 1)
+
+	expectedLog := `[ERR]: Not fatal
+[CRT]: Fatal err=boom n=1
+[INF]: Second hook
+[CRT]: Critical hook
+[INF]: First hook
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+	if len(codes) != 1 || codes[0] != 3 {
+		t.Fatalf("Expected a single exit with code 3, got %v", codes)
+	}
+}
+
+// TestCriticalExitDisabled tests that a critical record causes the process to
+// exit even if the handler's level doesn't allow it to be written, and that
+// the goroutine dump and a shutdown timeout are reported.
+func TestCriticalExitDisabled(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf, dumpBuf, errBuf bytes.Buffer
+		codes                []int
+	)
+	exit := NewCriticalExit(
+		WithExitTimeout(10*time.Millisecond),
+		WithGoroutineDump(&dumpBuf),
+		WithExitErrorWriter(&errBuf),
+		WithExitFunc(func(code int) {
+			codes = append(codes, code)
+		}),
+	)
+
+	block := make(chan struct{})
+	defer close(block)
+	exit.RegisterShutdownHook(func() error {
+		<-block
+		return nil
+	})
+
+	handler := NewJSONHandler(&buf, WithCriticalExit(exit))
+	handler.SetLevel(LevelOff)
+	NewSLogger(handler).Critical("Hidden")
+
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", buf.Bytes())
+	}
+	if len(codes) != 1 || codes[0] != DefaultExitCode {
+		t.Fatalf("Expected a single exit with code %d, got %v",
+			DefaultExitCode, codes)
+	}
+	if !strings.Contains(dumpBuf.String(), "TestCriticalExitDisabled") {
+		t.Fatalf("Expected goroutine dump, got %q", dumpBuf.Bytes())
+	}
+
+	expected := "btclog: error during critical exit: shutdown timed out " +
+		"after 10ms\n"
+	if errBuf.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, errBuf.Bytes())
+	}
+}
+
+// TestCriticalExitMultiHandler tests that a MultiHandler whose children exit the
+// process exits once, after all children have handled the critical record, and
+// that it exits even if its own level doesn't allow the record to be written.
+func TestCriticalExitMultiHandler(t *testing.T) {
+	t.Parallel()
+
+	var (
+		textBuf, adapterBuf, jsonBuf bytes.Buffer
+		written                      []string
+	)
+	exit := NewCriticalExit(WithExitFunc(func(int) {
+		written = append(written, textBuf.String()+adapterBuf.String())
+	}))
+
+	handler := NewMultiHandler(
+		NewDefaultHandler(
+			&textBuf, WithNoTimestamp(), WithCriticalExit(exit),
+		),
+		NewHandlerAdapter(
+			newTestTextHandler(&adapterBuf),
+			WithAdapterCriticalExit(exit),
+		),
+		NewJSONHandler(&jsonBuf, WithNoTimestamp()),
+	)
+	NewSLogger(handler).Critical("Fatal")
+
+	expected := "[CRT]: Fatal\nlevel=ERROR+1 msg=Fatal\n"
+	if len(written) != 1 || written[0] != expected {
+		t.Fatalf("Expected a single exit after %q, got %q", expected,
+			written)
+	}
+	if jsonBuf.String() != `{"level":"CRT","msg":"Fatal"}`+"\n" {
+		t.Fatalf("Unexpected output %q", jsonBuf.Bytes())
+	}
+
+	// A MultiHandler whose level doesn't allow the record exits without
+	// writing it.
+	var codes []int
+	exit = NewCriticalExit(WithExitFunc(func(code int) {
+		codes = append(codes, code)
+	}))
+
+	textBuf.Reset()
+	handler = NewMultiHandler(NewDefaultHandler(
+		&textBuf, WithNoTimestamp(), WithCriticalExit(exit),
+	))
+	handler.SetLevel(LevelOff)
+	NewSLogger(handler).Critical("Hidden")
+
+	if textBuf.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", textBuf.Bytes())
+	}
+	if len(codes) != 1 || codes[0] != DefaultExitCode {
+		t.Fatalf("Expected a single exit with code %d, got %v",
+			DefaultExitCode, codes)
+	}
+}
+
+// TestCriticalExitNotSuppressed tests that the SamplingHandler and the
+// DedupHandler don't suppress records that cause the process to exit.
+func TestCriticalExitNotSuppressed(t *testing.T) {
+	t.Parallel()
+
+	wrap := map[string]func(h Handler) Handler{
+		"sampling": func(h Handler) Handler {
+			return NewSamplingHandler(
+				h, WithSampleFirst(1, 0, time.Hour),
+				WithSampleByMessage(),
+			)
+		},
+		"dedup": func(h Handler) Handler {
+			return NewDedupHandler(h, WithDedupWindow(time.Hour))
+		},
+	}
+
+	for name, fn := range wrap {
+		fn := fn
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			exit := NewCriticalExit(WithExitFunc(func(int) {}))
+			log := NewSLogger(fn(NewDefaultHandler(
+				&buf, WithNoTimestamp(), WithCriticalExit(exit),
+			)))
+			log.Critical("Fatal")
+			log.Critical("Fatal")
+
+			expectedLog := `[CRT]: Fatal
+[CRT]: Fatal
+`
+			if buf.String() != expectedLog {
+				t.Fatalf("Log result mismatch. Expected \n\"%s\", "+
+					"got \n\"%s\"", expectedLog, buf.Bytes())
+			}
+		})
+	}
+}
+
+// TestCriticalExitConcurrent tests that a critical record written by another
+// goroutine while the process is exiting blocks that goroutine until the
+// process has exited.
+func TestCriticalExitConcurrent(t *testing.T) {
+	t.Parallel()
+
+	var (
+		exiting = make(chan struct{})
+		release = make(chan struct{})
+	)
+	exit := NewCriticalExit(WithExitFunc(func(int) {
+		close(exiting)
+		<-release
+	}))
+	log := NewSLogger(NewDefaultHandler(
+		io.Discard, WithCriticalExit(exit),
+	))
+
+	go log.Critical("First")
+	<-exiting
+
+	second := make(chan struct{})
+	go func() {
+		log.Critical("Second")
+		close(second)
+	}()
+
+	select {
+	case <-second:
+		t.Fatal("Expected the second critical record to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-second:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the second critical record to return once " +
+			"the process exited")
+	}
+}
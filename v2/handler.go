@@ -6,8 +6,8 @@ import (
 	"io"
 	"log/slog"
 	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btclog"
@@ -15,7 +15,10 @@ import (
 
 // DefaultSkipDepth is the default number of stack frames to ascend when
 // determining the call site of a log. Users of this package may want to alter
-// this depth depending on if they wrap the logger at all.
+// this depth depending on if they wrap the logger at all. The call site of a
+// record is normally identified by its PC, which is that of the logging call,
+// and each frame that the depth exceeds this default by ascends one frame
+// further from it.
 const DefaultSkipDepth = 5
 
 // HandlerOption is the signature of a functional option that can be used to
@@ -52,6 +55,36 @@ type handlerOpts struct {
 	// styledKey is a call-back that can be used to determine how any key
 	// in an attributes key-value pair will appear when printed.
 	styledKey func(string) string
+
+	// errHandler is a call-back that is called with any error returned
+	// when writing a log line.
+	errHandler func(error)
+
+	// fallback is a writer that log lines are written to if writing them
+	// to the primary writer fails.
+	fallback io.Writer
+
+	// hashChain holds the options of the HashChainWriter that log lines
+	// are written through, if withHashChain is set.
+	withHashChain bool
+	hashChain     []HashChainOption
+
+	// hierarchical defines whether subsystem tags are nested and derived
+	// handlers inherit the level of their parent.
+	hierarchical bool
+
+	// criticalExit, if set, exits the process after a critical record is
+	// handled.
+	criticalExit *CriticalExit
+
+	// attrOverrides holds the attribute level overrides that apply to the
+	// structured log records written through the handler.
+	attrOverrides *AttrLevelOverrides
+
+	// backend, if set, holds the loggers of the v1 Backend that log lines
+	// are written via instead of the writer of the handler, see
+	// NewBackendHandler.
+	backend *backendLoggers
 }
 
 // defaultHandlerOpts constructs a handlerOpts with default settings.
@@ -116,23 +149,59 @@ func WithNoTimestamp() HandlerOption {
 	}
 }
 
+// WithErrorHandler sets a call-back that is called with any error returned by
+// the writer when writing a log line. The call-back may itself log.
+func WithErrorHandler(fn func(error)) HandlerOption {
+	return func(opts *handlerOpts) {
+		opts.errHandler = fn
+	}
+}
+
+// WithFallbackWriter sets a writer, such as os.Stderr, that log lines are
+// written to if writing them to the primary writer fails. Each log line is
+// first attempted on the primary writer so that logging returns to it as soon
+// as it recovers.
+func WithFallbackWriter(w io.Writer) HandlerOption {
+	return func(opts *handlerOpts) {
+		opts.fallback = w
+	}
+}
+
+// WithHashChain makes the log output tamper-evident by writing it through a
+// HashChainWriter, which appends a running hash to each log line and
+// periodically writes checkpoints that can be signed with an ed25519 key. The
+// output can be verified with VerifyHashChain. The handler's Checkpoint method
+// should be called before the writer is closed, unless it's a RotatingFile,
+// which is checkpointed whenever it's rotated or closed. Log lines written to a
+// fallback writer are not chained.
+func WithHashChain(options ...HashChainOption) HandlerOption {
+	return func(opts *handlerOpts) {
+		opts.withHashChain = true
+		opts.hashChain = options
+	}
+}
+
 // DefaultHandler is a Handler that can be used along with NewSLogger to
 // instantiate a structured logger.
 type DefaultHandler struct {
-	level *atomic.Int64
+	level *levelNode
 
 	opts *handlerOpts
 	buf  *buffer
 	mu   *sync.Mutex
-	w    io.Writer
+	sink *sink
 
 	tag    string
 	prefix string
 
+	// groupPrefix is the dotted path of any groups added via WithGroup,
+	// including a trailing dot. It is used to qualify the keys of any
+	// attributes added after the group.
+	groupPrefix string
+
 	fields []slog.Attr
 
-	flag            uint32
-	callstackOffset bool
+	flag uint32
 }
 
 // A compile-time check to ensure that DefaultHandler implements Handler.
@@ -162,64 +231,79 @@ func NewDefaultHandler(w io.Writer, options ...HandlerOption) *DefaultHandler {
 	}
 
 	handler := &DefaultHandler{
-		w:     w,
+		sink:  newSink(w, opts),
 		opts:  opts,
 		buf:   newBuffer(),
 		mu:    &sync.Mutex{},
-		level: &atomic.Int64{},
+		level: newLevelNode(int64(levelInfo)),
 	}
-	handler.level.Store(int64(levelInfo))
 
 	return handler
 }
 
-// Enabled reports whether the handler handles records at the given level.
+// Enabled reports whether the handler handles records at the given level. A
+// level override carried by the context, see WithLevelOverride, can lower the
+// level of the handler but not raise it.
 //
 // NOTE: this is part of the slog.Handler interface.
-func (d *DefaultHandler) Enabled(_ context.Context, level slog.Level) bool {
-	return d.level.Load() <= int64(level)
+func (d *DefaultHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if d.opts.exitsAt(level) {
+		return true
+	}
+
+	return enabledAt(ctx, d.level.Load(), level)
 }
 
 // Handle handles the Record. It will only be called if Enabled returns true.
 //
 // NOTE: this is part of the slog.Handler interface.
-func (d *DefaultHandler) Handle(_ context.Context, r slog.Record) error {
+func (d *DefaultHandler) Handle(ctx context.Context, r slog.Record) error {
+	if d.opts.exitsAt(r.Level) {
+		defer d.opts.criticalExit.handled(ctx)
+
+		if !enabledAt(ctx, d.level.Load(), r.Level) {
+			return nil
+		}
+	}
+
 	buf := newBuffer()
 	defer buf.free()
 
-	// Timestamp.
-	if d.opts.withTimestamp {
-		// First check if the options provided specified a different
-		// time source to use. Otherwise, use the provided record time.
-		if d.opts.timeSource != nil {
-			writeTimestamp(buf, d.opts.timeSource())
-		} else if !r.Time.IsZero() {
-			writeTimestamp(buf, r.Time)
+	// The header is written by the v1 logger if the handler writes via a
+	// v1 Backend.
+	if d.opts.backend == nil {
+		// Timestamp.
+		if d.opts.withTimestamp {
+			// First check if the options provided specified a
+			// different time source to use. Otherwise, use the
+			// provided record time.
+			if d.opts.timeSource != nil {
+				writeTimestamp(buf, d.opts.timeSource())
+			} else if !r.Time.IsZero() {
+				writeTimestamp(buf, r.Time)
+			}
 		}
-	}
 
-	// Level.
-	d.writeLevel(buf, r.Level)
+		// Level.
+		d.writeLevel(buf, r.Level)
 
-	// Sub-system tag.
-	if d.tag != "" {
-		buf.writeString(" " + d.tag)
-	}
+		// Sub-system tag.
+		if d.tag != "" {
+			buf.writeString(" " + d.tag)
+		}
 
-	// The call-site.
-	skipBase := d.opts.callSiteSkipDepth
-	if d.opts.flag&(Lshortfile|Llongfile) != 0 {
-		skip := skipBase
-		if d.callstackOffset && skip >= 2 {
-			skip -= 2
+		// The call-site.
+		if d.opts.flag&(Lshortfile|Llongfile) != 0 {
+			file, line := callsite(
+				d.opts.flag, r.PC, d.opts.callSiteSkipDepth,
+			)
+			d.writeCallSite(buf, file, line)
 		}
-		file, line := callsite(d.opts.flag, skip)
-		d.writeCallSite(buf, file, line)
-	}
 
-	// Finish off the header.
-	buf.writeByte(':')
-	buf.writeByte(' ')
+		// Finish off the header.
+		buf.writeByte(':')
+		buf.writeByte(' ')
+	}
 
 	// Maybe write a prefix if one has been specified.
 	if d.prefix != "" {
@@ -235,56 +319,137 @@ func (d *DefaultHandler) Handle(_ context.Context, r slog.Record) error {
 		buf.writeString(r.Message)
 	}
 
-	// Append logger fields.
+	// Append logger fields. These have already been qualified by any
+	// groups that were active when they were added.
 	for _, attr := range d.fields {
-		d.appendAttr(buf, attr)
+		d.appendAttr(buf, attr, "", 0)
 	}
 
 	// Append slog attributes.
 	r.Attrs(func(a slog.Attr) bool {
-		d.appendAttr(buf, a)
+		d.appendAttr(buf, a, d.groupPrefix, 0)
 		return true
 	})
+
+	if d.opts.backend != nil {
+		d.writeBackend(r.Level, string(*buf))
+
+		return nil
+	}
+
 	buf.writeByte('\n')
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	_, err := d.w.Write(*buf)
+	return d.sink.write(*buf)
+}
+
+// hierarchical returns true if the handler was created with
+// WithHierarchicalSubSystems.
+//
+// NOTE: this is part of the hierarchicalHandler interface.
+func (d *DefaultHandler) hierarchical() bool {
+	return d.opts.hierarchical
+}
+
+// levelInherited returns true if the handler inherits the level of its parent.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (d *DefaultHandler) levelInherited() bool {
+	return d.level.inherited()
+}
+
+// resetLevel makes the handler inherit the level of its parent again.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (d *DefaultHandler) resetLevel() {
+	d.level.reset()
+}
 
-	return err
+// FailedWrites returns the number of log lines that could not be written to
+// the primary writer. The count is shared by all handlers derived from the
+// same NewDefaultHandler call.
+func (d *DefaultHandler) FailedWrites() uint64 {
+	return d.sink.failed.Load()
+}
+
+// criticalExits returns the CriticalExits that are run after the handler has
+// handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (d *DefaultHandler) criticalExits(level slog.Level) []*CriticalExit {
+	return d.opts.criticalExit.exits(level)
+}
+
+// attrLevelOverrides returns the attribute level overrides of the handler, if
+// any.
+//
+// NOTE: this is part of the attrOverridesHandler interface.
+func (d *DefaultHandler) attrLevelOverrides() *AttrLevelOverrides {
+	return d.opts.attrOverrides
+}
+
+// Checkpoint writes a checkpoint of the hash chain of the handler's output if
+// the handler was created with WithHashChain. It does nothing otherwise.
+func (d *DefaultHandler) Checkpoint() error {
+	return d.sink.checkpoint()
 }
 
 // WithAttrs returns a new Handler with the given attributes added.
 //
 // NOTE: this is part of the slog.Handler interface.
 func (d *DefaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return d.with(d.tag, d.prefix, true, false, attrs...)
+	if len(attrs) == 0 {
+		return d
+	}
+
+	// If any groups are active, then the attributes are stored as a single
+	// group attribute so that their keys are qualified by the group path
+	// when written.
+	if d.groupPrefix != "" {
+		attrs = []slog.Attr{{
+			Key:   strings.TrimSuffix(d.groupPrefix, "."),
+			Value: slog.GroupValue(attrs...),
+		}}
+	}
+
+	return d.with(d.tag, d.prefix, true, attrs...)
 }
 
-// WithGroup returns a new Handler with the given group appended to
-// the receiver's existing groups. All this implementation does is that it adds
-// to the existing tag used for the logger.
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups. The keys of all attributes added after the group,
+// either via WithAttrs or on the record itself, are qualified with the group
+// name in dotted form, e.g. "group.key=value".
 //
 // NOTE: this is part of the slog.Handler interface.
 func (d *DefaultHandler) WithGroup(name string) slog.Handler {
-	if d.tag != "" {
-		name = d.tag + "." + name
+	if name == "" {
+		return d
 	}
-	return d.with(name, d.prefix, true, false)
+
+	sl := d.with(d.tag, d.prefix, true)
+	sl.groupPrefix += name + "."
+
+	return sl
 }
 
 // SubSystem returns a copy of the given handler but with the new tag. All
 // attributes added with WithAttrs will be kept but all groups added with
-// WithGroup are lost.
+// WithGroup are lost. This means that attributes added to the new handler
+// will not be qualified by any of the parent's groups.
 //
 // NOTE: this creates a new logger with an independent log level. This
 // means that SetLevel needs to be called on the new logger to change
 // the level as any changes to the parent logger's level after creation
-// will not be inherited by the new logger.
+// will not be inherited by the new logger. If the handler was created with
+// WithHierarchicalSubSystems, the new tag is nested under the current tag and
+// the new logger inherits the level of its parent instead.
 //
 // NOTE: this is part of the Handler interface.
 func (d *DefaultHandler) SubSystem(tag string) Handler {
-	return d.with(tag, d.prefix, false, false)
+	tag = subSystemTag(d.tag, tag, d.opts.hierarchical)
+	sl := d.with(tag, d.prefix, false)
+	sl.groupPrefix = ""
+
+	return sl
 }
 
 // WithPrefix returns a copy of the Handler but with the given string prefixed
@@ -297,16 +462,14 @@ func (d *DefaultHandler) SubSystem(tag string) Handler {
 //
 // NOTE: this is part of the Handler interface.
 func (d *DefaultHandler) WithPrefix(prefix string) Handler {
-	return d.with(d.tag, prefix, false, true)
+	return d.with(d.tag, prefix, true)
 }
 
-// with returns a new logger with the given attributes added.
-// withCallstackOffset should be false if the caller returns a concrete
-// DefaultHandler and true if the caller returns the Handler interface.
-// The shareLevel param determines whether the new handler shares the same
-// level reference or gets its own independent level.
-func (d *DefaultHandler) with(tag, prefix string, withCallstackOffset bool,
-	shareLevel bool, attrs ...slog.Attr) *DefaultHandler {
+// with returns a new logger with the given attributes added. The shareLevel
+// param determines whether the new handler shares the same level reference or
+// gets its own independent level.
+func (d *DefaultHandler) with(tag, prefix string, shareLevel bool,
+	attrs ...slog.Attr) *DefaultHandler {
 
 	d.mu.Lock()
 	sl := *d
@@ -318,24 +481,31 @@ func (d *DefaultHandler) with(tag, prefix string, withCallstackOffset bool,
 		make([]slog.Attr, 0, len(d.fields)+len(attrs)), d.fields...,
 	)
 	sl.fields = append(sl.fields, attrs...)
-	sl.callstackOffset = withCallstackOffset
 	sl.tag = tag
 	sl.prefix = prefix
 
-	// If shareLevel is false, create a new independent level. Otherwise,
-	// sl.level already points to d.level.
+	// If shareLevel is false, create a new level that either inherits
+	// d.level or is an independent copy of it. Otherwise, sl.level already
+	// points to d.level.
 	if !shareLevel {
-		newLevel := &atomic.Int64{}
-		newLevel.Store(d.level.Load())
-		sl.level = newLevel
+		sl.level = d.level.derive(d.opts.hierarchical)
 	}
 
 	return &sl
 }
 
+// maxAttrDepth is the maximum depth to which nested group attributes are
+// resolved and written. It protects against LogValuers that produce an
+// unbounded chain of nested groups.
+const maxAttrDepth = 16
+
 // appendAttr extracts a key-value pair from the slog.Attr and writes it to the
-// buffer.
-func (d *DefaultHandler) appendAttr(buf *buffer, a slog.Attr) {
+// buffer. The key is qualified with the given dotted group prefix. Group
+// attributes are flattened such that each of their members is written as its
+// own key-value pair with the group's key added to the prefix.
+func (d *DefaultHandler) appendAttr(buf *buffer, a slog.Attr, prefix string,
+	depth int) {
+
 	// Resolve the Attr's value before doing anything else.
 	a.Value = a.Value.Resolve()
 
@@ -344,8 +514,33 @@ func (d *DefaultHandler) appendAttr(buf *buffer, a slog.Attr) {
 		return
 	}
 
-	d.appendKey(buf, a.Key)
-	appendValue(buf, a.Value)
+	if a.Value.Kind() != slog.KindGroup {
+		d.appendKey(buf, prefix+a.Key)
+		appendValue(buf, a.Value)
+
+		return
+	}
+
+	// Ignore empty groups.
+	attrs := a.Value.Group()
+	if len(attrs) == 0 {
+		return
+	}
+
+	if depth >= maxAttrDepth {
+		d.appendKey(buf, prefix+a.Key)
+		appendString(buf, "!MAXDEPTH")
+
+		return
+	}
+
+	// A group with an empty key is inlined into the current group.
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range attrs {
+		d.appendAttr(buf, ga, prefix, depth+1)
+	}
 }
 
 // writeLevel writes the given slog.Level to the buffer in its string form.
@@ -358,7 +553,7 @@ func (d *DefaultHandler) writeLevel(buf *buffer, level slog.Level) {
 	}
 
 	buf.writeByte('[')
-	buf.writeString(lvl.String())
+	buf.writeString(LevelString(lvl))
 	buf.writeByte(']')
 }
 
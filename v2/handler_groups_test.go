@@ -0,0 +1,143 @@
+package btclog
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/slogtest"
+)
+
+// peerInfo is a slog.LogValuer used to test the resolution of nested values.
+type peerInfo struct {
+	addr string
+	id   int
+}
+
+// LogValue returns the peer as a group attribute value with a nested
+// LogValuer.
+func (p peerInfo) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("addr", p.addr),
+		slog.Any("id", Sprintf("%d", p.id)),
+		slog.Any("self", cyclicValuer{}),
+	)
+}
+
+// cyclicValuer is a slog.LogValuer that resolves to a group containing itself.
+type cyclicValuer struct{}
+
+// LogValue returns a group containing the cyclicValuer itself.
+func (c cyclicValuer) LogValue() slog.Value {
+	return slog.GroupValue(slog.Any("c", c))
+}
+
+// TestDefaultHandlerGroups tests that group attributes and groups added via
+// WithGroup are written as dotted keys by the DefaultHandler.
+func TestDefaultHandlerGroups(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := NewDefaultHandler(&buf, WithNoTimestamp())
+	logger := slog.New(handler)
+
+	logger.Info("Group", slog.Group("peer", "addr", "127.0.0.1", "id", 5))
+	logger.Info("Empty group", slog.Group("peer"), "key", "value")
+	logger.Info("Inline group", slog.Group("", "key", "value"))
+
+	logger.WithGroup("peer").With("addr", "127.0.0.1").WithGroup("conn").
+		Info("WithGroup", "id", 5)
+	logger.WithGroup("peer").Info("Empty WithGroup")
+
+	// A SubSystem handler should not carry over the parent's groups but
+	// should keep any attributes that were added under them.
+	grouped := handler.WithGroup("peer").WithAttrs([]slog.Attr{
+		slog.Int("id", 5),
+	})
+	slog.New(grouped.(*DefaultHandler).SubSystem("SUBS")).Info("SubSystem",
+		"key", "value")
+
+	// Nested LogValuers should be resolved, with any cyclic values cut off
+	// at the maximum depth.
+	logger.Info("LogValuer", "peer", peerInfo{addr: "127.0.0.1", id: 5})
+
+	cyclic := "c" + strings.Repeat(".c", maxAttrDepth-2)
+	expectedLog := `[INF]: Group peer.addr=127.0.0.1 peer.id=5
+[INF]: Empty group key=value
+[INF]: Inline group key=value
+[INF]: WithGroup peer.addr=127.0.0.1 peer.conn.id=5
+[INF]: Empty WithGroup
+[INF] SUBS: SubSystem peer.id=5 key=value
+[INF]: LogValuer peer.addr=127.0.0.1 peer.id=5 peer.self.` + cyclic +
+		`=!MAXDEPTH
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
+
+// TestDefaultHandlerSlogTest runs the DefaultHandler through the standard
+// library's slog.Handler conformance tests.
+func TestDefaultHandlerSlogTest(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := NewDefaultHandler(&buf, WithCallerFlags(0))
+
+	// parseLine converts a single log line of the form
+	// "YYYY-MM-DD hh:mm:ss.sss [LVL]: msg k=v a.b=c" into a map, nesting
+	// any dotted keys.
+	parseLine := func(line string) map[string]any {
+		m := make(map[string]any)
+
+		const timeLen = len("2006-01-02 15:04:05.000")
+		if len(line) > timeLen && line[0] != '[' {
+			m[slog.TimeKey] = line[:timeLen]
+			line = line[timeLen+1:]
+		}
+
+		header, rest, _ := strings.Cut(line, ": ")
+		m[slog.LevelKey] = header
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return m
+		}
+		m[slog.MessageKey] = fields[0]
+
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			keys := strings.Split(key, ".")
+
+			group := m
+			for _, k := range keys[:len(keys)-1] {
+				g, ok := group[k].(map[string]any)
+				if !ok {
+					g = make(map[string]any)
+					group[k] = g
+				}
+				group = g
+			}
+			group[keys[len(keys)-1]] = value
+		}
+
+		return m
+	}
+
+	results := func() []map[string]any {
+		var ms []map[string]any
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if line == "" {
+				continue
+			}
+			ms = append(ms, parseLine(line))
+		}
+
+		return ms
+	}
+
+	if err := slogtest.TestHandler(handler, results); err != nil {
+		t.Fatal(err)
+	}
+}
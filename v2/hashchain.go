@@ -0,0 +1,764 @@
+package btclog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// DefaultCheckpointInterval is the default number of records between the
+// signed checkpoints written by a HashChainWriter.
+const DefaultCheckpointInterval = 1000
+
+// chainNonceSize is the size of the random nonce that each chain starts with.
+const chainNonceSize = 16
+
+const (
+	// chainTextKey precedes the chain hash of a text record.
+	chainTextKey = " chain="
+
+	// chainJSONKey precedes the chain hash of a JSON record.
+	chainJSONKey = `"chain":"`
+
+	// checkpointText starts a text checkpoint line.
+	checkpointText = "CHECKPOINT "
+
+	// checkpointJSON starts a JSON checkpoint line.
+	checkpointJSON = `{"checkpoint":`
+)
+
+// HashChainOption is the signature of a functional option that can be used to
+// modify the behaviour of a HashChainWriter.
+type HashChainOption func(*hashChainOpts)
+
+// hashChainOpts holds options that can be modified by a HashChainOption.
+type hashChainOpts struct {
+	// key signs the checkpoints if set.
+	key ed25519.PrivateKey
+
+	// interval is the number of records between periodic checkpoints.
+	// Periodic checkpoints are disabled if it is zero.
+	interval uint64
+}
+
+// WithCheckpointKey causes the checkpoints of a HashChainWriter to be signed
+// with the given ed25519 private key. Checkpoints are not signed if no key is
+// set, in which case the chain can only detect accidental modifications.
+func WithCheckpointKey(key ed25519.PrivateKey) HashChainOption {
+	return func(opts *hashChainOpts) {
+		opts.key = key
+	}
+}
+
+// WithCheckpointInterval causes a HashChainWriter to write a checkpoint after
+// every n records rather than after every DefaultCheckpointInterval records.
+// Periodic checkpoints are disabled if n is zero.
+func WithCheckpointInterval(n uint64) HashChainOption {
+	return func(opts *hashChainOpts) {
+		opts.interval = n
+	}
+}
+
+// chainState is the state of the chain of a HashChainWriter.
+type chainState struct {
+	// prev is the chain hash of the last record and seq is the number of
+	// records in the chain.
+	prev [sha256.Size]byte
+	seq  uint64
+
+	// nonce is the random nonce that the chain starts from.
+	nonce []byte
+
+	// started is true once the checkpoint at the start of the chain has
+	// been written.
+	started bool
+
+	// json is true if the last record was a JSON object, in which case
+	// checkpoints are written as JSON objects as well.
+	json bool
+}
+
+// chainedWriter is implemented by writers, such as RotatingFile, that replace
+// the file that they write to. A HashChainWriter that writes to such a writer
+// has a checkpoint of its chain written to the end of each file before it is
+// closed and to the start of each new file.
+type chainedWriter interface {
+	// setCheckpointer sets the function that returns the checkpoint line
+	// to be written when a file is closed or opened, or nil if there is
+	// nothing to checkpoint.
+	setCheckpointer(fn func() []byte)
+
+	// writeCommit writes the record p and, if it was written in full,
+	// calls commit before any other record or checkpoint is written.
+	writeCommit(p []byte, commit func()) (int, error)
+}
+
+// HashChainWriter is an io.Writer that makes the log records written to it
+// tamper-evident. Each call to Write is treated as a single record, as is the
+// case for the writes of the handlers of this package and of a v1 Backend, so
+// it can also be used as the writer of a v1 Backend. The writer appends the
+// SHA-256 hash of the previous record's hash and the record to each record, so
+// that deleting or editing a record breaks the chain at that point. JSON
+// records have the hash added as a "chain" field and all other records have it
+// appended as " chain=<hash>".
+//
+// Since anyone can recompute the hashes of an edited chain, the writer also
+// writes a checkpoint line at the start of the chain, after every checkpoint
+// interval and on each call to Checkpoint, which states the number of records
+// and hash of the chain so far and is signed with an ed25519 key. Records up to
+// the last checkpoint can then only be modified by the holder of the key.
+//
+// If the writer is a RotatingFile, a checkpoint is also written to the end of
+// each file before it is rotated or closed and to the start of each new file,
+// so that each file can be verified on its own and all of its records are
+// covered by a signed checkpoint.
+//
+// Each HashChainWriter starts a new chain, so a log file that is appended to by
+// several processes in turn contains several chains. The hash of each chain
+// starts from a random nonce which is stated by the checkpoints of the chain
+// before its first record, its genesis checkpoints. This binds the signature of
+// a genesis checkpoint to its chain, so that it can't be copied to restart the
+// chain elsewhere in the log. The removal of a complete chain, from one start
+// of a chain to the next, can however not be detected.
+//
+// VerifyHashChain verifies a log written by a HashChainWriter, as does the
+// btclogverify command.
+type HashChainWriter struct {
+	w    io.Writer
+	opts *hashChainOpts
+
+	// mu serialises writes to w.
+	mu  sync.Mutex
+	buf []byte
+
+	// stateMu protects state. It is only held while state is read or
+	// updated, so that a checkpoint can be taken by a RotatingFile while a
+	// write to it is in progress.
+	stateMu sync.Mutex
+	state   chainState
+}
+
+// NewHashChainWriter creates a HashChainWriter that writes to w.
+func NewHashChainWriter(w io.Writer,
+	options ...HashChainOption) *HashChainWriter {
+
+	opts := &hashChainOpts{
+		interval: DefaultCheckpointInterval,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+
+	c := &HashChainWriter{
+		w:    w,
+		opts: opts,
+	}
+	if cw, ok := w.(chainedWriter); ok {
+		cw.setCheckpointer(c.checkpointLine)
+	}
+
+	return c
+}
+
+// Write appends the chain hash to the record p and writes it to the underlying
+// writer, followed by a checkpoint if one is due. The chain only advances if
+// the record is written successfully.
+//
+// NOTE: this is part of the io.Writer interface.
+func (c *HashChainWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record := bytes.TrimSuffix(p, []byte("\n"))
+	json := isJSONObject(record)
+
+	c.stateMu.Lock()
+	c.state.json = json
+	c.stateMu.Unlock()
+
+	if err := c.start(); err != nil {
+		return 0, err
+	}
+
+	state := c.getState()
+	hash := chainHash(state.prev, record)
+
+	c.buf = c.buf[:0]
+	if json {
+		c.buf = append(c.buf, record[:len(record)-1]...)
+		if len(record) > 2 {
+			c.buf = append(c.buf, ',')
+		}
+		c.buf = append(c.buf, chainJSONKey...)
+		c.buf = appendHex(c.buf, hash[:])
+		c.buf = append(c.buf, '"', '}', '\n')
+	} else {
+		c.buf = append(c.buf, record...)
+		c.buf = append(c.buf, chainTextKey...)
+		c.buf = appendHex(c.buf, hash[:])
+		c.buf = append(c.buf, '\n')
+	}
+	err := c.write(c.buf, func() {
+		c.stateMu.Lock()
+		c.state.prev = hash
+		c.state.seq++
+		c.stateMu.Unlock()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	seq := c.getState().seq
+	if c.opts.interval > 0 && seq%c.opts.interval == 0 {
+		if err := c.checkpoint(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Checkpoint writes a checkpoint of the chain so far. Records that follow the
+// last checkpoint are not covered by a signature, so it should be called before
+// the log is closed unless the writer is a RotatingFile, which is checkpointed
+// when it's closed.
+func (c *HashChainWriter) Checkpoint() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.getState().started {
+		return c.start()
+	}
+
+	return c.checkpoint()
+}
+
+// getState returns a copy of the state of the chain.
+func (c *HashChainWriter) getState() chainState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	return c.state
+}
+
+// start starts the chain from a new random nonce and writes its genesis
+// checkpoint unless the chain has already been started.
+//
+// NOTE: the caller must hold the mutex.
+func (c *HashChainWriter) start() error {
+	if c.getState().started {
+		return nil
+	}
+
+	nonce := make([]byte, chainNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	c.stateMu.Lock()
+	c.state.nonce = nonce
+	c.state.prev = genesisHash(nonce)
+	c.stateMu.Unlock()
+
+	c.buf = c.opts.appendCheckpoint(c.buf[:0], c.getState())
+
+	return c.write(c.buf, func() {
+		c.stateMu.Lock()
+		c.state.started = true
+		c.stateMu.Unlock()
+	})
+}
+
+// checkpoint writes a checkpoint of the chain so far.
+//
+// NOTE: the caller must hold the mutex.
+func (c *HashChainWriter) checkpoint() error {
+	c.buf = c.opts.appendCheckpoint(c.buf[:0], c.getState())
+	_, err := c.w.Write(c.buf)
+
+	return err
+}
+
+// write writes p to the underlying writer and calls commit if it was written
+// successfully. If the writer is a chainedWriter, commit is called before any
+// checkpoint is taken by it, so that the checkpoints it writes match the chain.
+//
+// NOTE: the caller must hold the mutex.
+func (c *HashChainWriter) write(p []byte, commit func()) error {
+	if cw, ok := c.w.(chainedWriter); ok {
+		_, err := cw.writeCommit(p, commit)
+		return err
+	}
+
+	if _, err := c.w.Write(p); err != nil {
+		return err
+	}
+	commit()
+
+	return nil
+}
+
+// checkpointLine returns a checkpoint line of the chain so far, or nil if the
+// chain hasn't been started. It is called by a RotatingFile before it closes a
+// file and after it opens a new one, possibly from within a call to Write.
+func (c *HashChainWriter) checkpointLine() []byte {
+	state := c.getState()
+	if !state.started {
+		return nil
+	}
+
+	return c.opts.appendCheckpoint(nil, state)
+}
+
+// appendCheckpoint appends a checkpoint line of a chain with the given state
+// to buf. The checkpoint includes the nonce of the chain if it has no records
+// yet.
+func (o *hashChainOpts) appendCheckpoint(buf []byte, state chainState) []byte {
+	var sig []byte
+	if o.key != nil {
+		sig = ed25519.Sign(o.key, checkpointMessage(state.seq, state.prev))
+	}
+
+	if state.json {
+		buf = append(buf, checkpointJSON...)
+		buf = strconv.AppendUint(buf, state.seq, 10)
+		buf = append(buf, ',')
+		buf = append(buf, chainJSONKey...)
+		buf = appendHex(buf, state.prev[:])
+		buf = append(buf, '"')
+		if state.seq == 0 {
+			buf = append(buf, `,"nonce":"`...)
+			buf = appendHex(buf, state.nonce)
+			buf = append(buf, '"')
+		}
+		if sig != nil {
+			buf = append(buf, `,"sig":"`...)
+			buf = appendHex(buf, sig)
+			buf = append(buf, '"')
+		}
+
+		return append(buf, '}', '\n')
+	}
+
+	buf = append(buf, checkpointText...)
+	buf = append(buf, "seq="...)
+	buf = strconv.AppendUint(buf, state.seq, 10)
+	buf = append(buf, chainTextKey...)
+	buf = appendHex(buf, state.prev[:])
+	if state.seq == 0 {
+		buf = append(buf, " nonce="...)
+		buf = appendHex(buf, state.nonce)
+	}
+	if sig != nil {
+		buf = append(buf, " sig="...)
+		buf = appendHex(buf, sig)
+	}
+
+	return append(buf, '\n')
+}
+
+// HashChainStats describes a log that was verified by VerifyHashChain.
+type HashChainStats struct {
+	// Records is the number of chained records.
+	Records uint64
+
+	// Checkpoints is the number of checkpoints.
+	Checkpoints uint64
+
+	// Unsigned is the number of records that are not covered by a signed
+	// checkpoint, either because they follow the last checkpoint of their
+	// chain or because no public key was given. These records could have
+	// been modified by anyone.
+	Unsigned uint64
+}
+
+// HashChainError describes the first broken link or bad signature found by
+// VerifyHashChain.
+type HashChainError struct {
+	// Line is the line number, starting at one, of the offending record
+	// or checkpoint.
+	Line int
+
+	// Reason describes the failure.
+	Reason string
+}
+
+// Error returns the error as a string.
+//
+// NOTE: this is part of the error interface.
+func (e *HashChainError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// VerifyHashChain reads a log written by a HashChainWriter from r and verifies
+// the chain hash of each record and the signature of each checkpoint against
+// the given public key. Signatures are not checked if pub is nil. Records that
+// span several lines are supported. A *HashChainError is returned for the first
+// broken link or bad signature.
+//
+// The log must start with a checkpoint, which is the case for each file written
+// by a RotatingFile. A new chain may start at any point, but only from a
+// genesis checkpoint whose nonce hasn't been seen before in the log.
+func VerifyHashChain(r io.Reader, pub ed25519.PublicKey) (HashChainStats,
+	error) {
+
+	var (
+		stats   HashChainStats
+		started bool
+		prev    [sha256.Size]byte
+		seq     uint64
+
+		// chainUnsigned is the number of records of the current chain
+		// that follow its last signed checkpoint.
+		chainUnsigned uint64
+
+		// nonces holds the nonces of the chains that have been seen.
+		nonces = make(map[string]struct{})
+
+		// pending holds the lines of a record that spans several
+		// lines and pendingLine is the number of its first line.
+		pending     []byte
+		pendingLine int
+	)
+
+	br := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return stats, err
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		if cp, ok := parseCheckpoint(line); ok {
+			if pending != nil {
+				return stats, &HashChainError{
+					Line:   pendingLine,
+					Reason: "record without chain hash",
+				}
+			}
+
+			// A checkpoint either matches the current chain or
+			// starts a new one, which is only possible from a
+			// genesis checkpoint of a chain that hasn't been seen.
+			// The first checkpoint of a log, which may have been
+			// rotated, starts the verification.
+			switch {
+			case started && cp.seq == seq && cp.hash == prev:
+				// The checkpoint matches the current chain.
+
+			case cp.seq == 0:
+				if cp.nonce == nil ||
+					genesisHash(cp.nonce) != cp.hash {
+
+					return stats, &HashChainError{
+						Line:   lineNum,
+						Reason: "bad genesis checkpoint",
+					}
+				}
+				if _, ok := nonces[string(cp.nonce)]; ok {
+					return stats, &HashChainError{
+						Line:   lineNum,
+						Reason: "replayed genesis checkpoint",
+					}
+				}
+				nonces[string(cp.nonce)] = struct{}{}
+
+				prev, seq = cp.hash, 0
+				chainUnsigned = 0
+
+			case !started:
+				prev, seq = cp.hash, cp.seq
+
+			default:
+				return stats, &HashChainError{
+					Line:   lineNum,
+					Reason: "checkpoint does not match chain",
+				}
+			}
+			started = true
+			stats.Checkpoints++
+
+			if pub == nil {
+				continue
+			}
+			if cp.sig == nil {
+				return stats, &HashChainError{
+					Line:   lineNum,
+					Reason: "unsigned checkpoint",
+				}
+			}
+			msg := checkpointMessage(cp.seq, cp.hash)
+			if !ed25519.Verify(pub, msg, cp.sig) {
+				return stats, &HashChainError{
+					Line:   lineNum,
+					Reason: "bad checkpoint signature",
+				}
+			}
+			stats.Unsigned -= chainUnsigned
+			chainUnsigned = 0
+
+			continue
+		}
+
+		record, hash, ok := splitChainHash(line)
+		if !ok {
+			// The line is part of a record that spans several
+			// lines.
+			if pending == nil {
+				pendingLine = lineNum
+			}
+			pending = append(pending, line...)
+			pending = append(pending, '\n')
+
+			if err == io.EOF {
+				break
+			}
+
+			continue
+		}
+
+		recordLine := lineNum
+		if pending != nil {
+			record = append(pending, record...)
+			recordLine = pendingLine
+			pending = nil
+		}
+
+		if !started {
+			return stats, &HashChainError{
+				Line:   recordLine,
+				Reason: "record before first checkpoint",
+			}
+		}
+
+		prev = chainHash(prev, record)
+		if prev != hash {
+			return stats, &HashChainError{
+				Line:   recordLine,
+				Reason: "chain hash mismatch",
+			}
+		}
+		seq++
+		stats.Records++
+		stats.Unsigned++
+		chainUnsigned++
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if pending != nil {
+		return stats, &HashChainError{
+			Line:   pendingLine,
+			Reason: "record without chain hash",
+		}
+	}
+
+	return stats, nil
+}
+
+// chainHash returns the chain hash of a record given the chain hash of the
+// previous record.
+func chainHash(prev [sha256.Size]byte, record []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(prev[:])
+	h.Write(record)
+
+	var hash [sha256.Size]byte
+	copy(hash[:], h.Sum(nil))
+
+	return hash
+}
+
+// genesisHash returns the chain hash that a chain with the given nonce starts
+// from.
+func genesisHash(nonce []byte) [sha256.Size]byte {
+	return sha256.Sum256(nonce)
+}
+
+// checkpointMessage returns the message that is signed by a checkpoint.
+func checkpointMessage(seq uint64, hash [sha256.Size]byte) []byte {
+	msg := []byte("btclog checkpoint ")
+	msg = strconv.AppendUint(msg, seq, 10)
+	msg = append(msg, ' ')
+
+	return append(msg, hash[:]...)
+}
+
+// isJSONObject returns true if the record looks like a JSON object.
+func isJSONObject(record []byte) bool {
+	return len(record) >= 2 && record[0] == '{' &&
+		record[len(record)-1] == '}'
+}
+
+// appendHex appends the hex encoding of b to buf.
+func appendHex(buf, b []byte) []byte {
+	n := len(buf)
+	buf = append(buf, make([]byte, hex.EncodedLen(len(b)))...)
+	hex.Encode(buf[n:], b)
+
+	return buf
+}
+
+// parseHash decodes a hex encoded chain hash.
+func parseHash(s []byte) ([sha256.Size]byte, bool) {
+	var hash [sha256.Size]byte
+	if len(s) != hex.EncodedLen(sha256.Size) {
+		return hash, false
+	}
+	_, err := hex.Decode(hash[:], s)
+
+	return hash, err == nil
+}
+
+// splitChainHash splits a line written by a HashChainWriter into the original
+// record and its chain hash. It returns false if the line has no chain hash.
+func splitChainHash(line []byte) ([]byte, [sha256.Size]byte, bool) {
+	hashLen := hex.EncodedLen(sha256.Size)
+
+	// JSON records end in "chain":"<hash>"} with the field separated from
+	// any preceding fields by a comma.
+	jsonSuffix := len(chainJSONKey) + hashLen + 2
+	if isJSONObject(line) && len(line) >= jsonSuffix+1 {
+		start := len(line) - jsonSuffix
+		field := line[start:]
+		if bytes.HasPrefix(field, []byte(chainJSONKey)) &&
+			bytes.HasSuffix(field, []byte(`"}`)) {
+
+			hash, ok := parseHash(field[len(chainJSONKey) : len(field)-2])
+			if ok {
+				record := append([]byte(nil), line[:start]...)
+				record = bytes.TrimSuffix(record, []byte(","))
+
+				return append(record, '}'), hash, true
+			}
+		}
+	}
+
+	textSuffix := len(chainTextKey) + hashLen
+	if len(line) < textSuffix {
+		return nil, [sha256.Size]byte{}, false
+	}
+	start := len(line) - textSuffix
+	if !bytes.HasPrefix(line[start:], []byte(chainTextKey)) {
+		return nil, [sha256.Size]byte{}, false
+	}
+	hash, ok := parseHash(line[start+len(chainTextKey):])
+	if !ok {
+		return nil, [sha256.Size]byte{}, false
+	}
+
+	return append([]byte(nil), line[:start]...), hash, true
+}
+
+// checkpoint is a checkpoint line written by a HashChainWriter.
+type checkpoint struct {
+	seq  uint64
+	hash [sha256.Size]byte
+
+	// nonce is the nonce of the chain, which is only stated by genesis
+	// checkpoints, and sig is nil if the checkpoint is not signed.
+	nonce []byte
+	sig   []byte
+}
+
+// parseCheckpoint parses a checkpoint line written by a HashChainWriter. It
+// returns false if the line is not a checkpoint.
+func parseCheckpoint(line []byte) (checkpoint, bool) {
+	var (
+		cp     checkpoint
+		fields = make(map[string]string)
+	)
+	switch {
+	case bytes.HasPrefix(line, []byte(checkpointText)):
+		rest := line[len(checkpointText):]
+		for _, f := range bytes.Fields(rest) {
+			kv := bytes.SplitN(f, []byte("="), 2)
+			if len(kv) != 2 {
+				return cp, false
+			}
+			fields[string(kv[0])] = string(kv[1])
+		}
+
+	case bytes.HasPrefix(line, []byte(checkpointJSON)):
+		rest := bytes.TrimSuffix(line[len(checkpointJSON):], []byte("}"))
+		for i, f := range bytes.Split(rest, []byte(",")) {
+			if i == 0 {
+				fields["seq"] = string(f)
+				continue
+			}
+			kv := bytes.SplitN(f, []byte(":"), 2)
+			if len(kv) != 2 {
+				return cp, false
+			}
+			key, err := strconv.Unquote(string(kv[0]))
+			if err != nil {
+				return cp, false
+			}
+			value, err := strconv.Unquote(string(kv[1]))
+			if err != nil {
+				return cp, false
+			}
+			fields[key] = value
+		}
+
+	default:
+		return cp, false
+	}
+
+	var (
+		err error
+		ok  bool
+	)
+	cp.seq, err = strconv.ParseUint(fields["seq"], 10, 64)
+	if err != nil {
+		return cp, false
+	}
+	cp.hash, ok = parseHash([]byte(fields["chain"]))
+	if !ok {
+		return cp, false
+	}
+
+	if s, ok := fields["nonce"]; ok {
+		cp.nonce, err = hex.DecodeString(s)
+		if err != nil || len(cp.nonce) != chainNonceSize {
+			return cp, false
+		}
+	}
+
+	if s, ok := fields["sig"]; ok {
+		cp.sig, err = hex.DecodeString(s)
+		if err != nil || len(cp.sig) != ed25519.SignatureSize {
+			return cp, false
+		}
+	}
+
+	return cp, true
+}
+
+// ErrNoPublicKey is returned by ParsePublicKey if the given string is not a hex
+// encoded ed25519 public key.
+var ErrNoPublicKey = errors.New("not a hex encoded ed25519 public key")
+
+// ParsePublicKey decodes a hex encoded ed25519 public key, such as the key that
+// verifies the checkpoints of a HashChainWriter.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, ErrNoPublicKey
+	}
+
+	return ed25519.PublicKey(key), nil
+}
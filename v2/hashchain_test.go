@@ -0,0 +1,386 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// testKey returns a deterministic ed25519 key pair.
+func testKey(seed byte) (ed25519.PublicKey, ed25519.PrivateKey) {
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, 32))
+	return priv.Public().(ed25519.PublicKey), priv
+}
+
+// TestHashChain tests that the output of handlers and v1 backends written with
+// a hash chain verifies and that modifications are detected.
+func TestHashChain(t *testing.T) {
+	t.Parallel()
+
+	pub, priv := testKey(1)
+	otherPub, _ := testKey(2)
+	chainOpts := []HashChainOption{
+		WithCheckpointKey(priv),
+		WithCheckpointInterval(2),
+	}
+
+	write := map[string]func() string{
+		"text handler": func() string {
+			var buf bytes.Buffer
+			log := NewSLogger(NewDefaultHandler(
+				&buf, WithNoTimestamp(), WithHashChain(chainOpts...),
+			))
+			for _, msg := range []string{"one", "two", "three"} {
+				log.InfoS(context.Background(), msg, "k", "v")
+			}
+
+			return buf.String()
+		},
+		"json handler": func() string {
+			var buf bytes.Buffer
+			log := NewSLogger(NewJSONHandler(
+				&buf, WithNoTimestamp(), WithHashChain(chainOpts...),
+			))
+			for _, msg := range []string{"one", "two", "three"} {
+				log.InfoS(context.Background(), msg, "k", "v")
+			}
+
+			return buf.String()
+		},
+		"v1 backend": func() string {
+			var buf bytes.Buffer
+			backend := btclog.NewBackend(
+				NewHashChainWriter(&buf, chainOpts...),
+			)
+			log := backend.Logger("TEST")
+			log.Info("one")
+			log.Info("two")
+			log.Info("three\nspans lines")
+
+			return buf.String()
+		},
+	}
+
+	for name, fn := range write {
+		fn := fn
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out := fn()
+			lines := strings.SplitAfter(out, "\n")
+
+			assertChainStats(t, out, pub, HashChainStats{
+				Records:     3,
+				Checkpoints: 2,
+				Unsigned:    1,
+			})
+
+			// Signatures are not checked without a key but must
+			// match the key if one is given.
+			assertChainStats(t, out, nil, HashChainStats{
+				Records:     3,
+				Checkpoints: 2,
+				Unsigned:    3,
+			})
+			assertChainErr(
+				t, out, otherPub, 1, "bad checkpoint signature",
+			)
+
+			// Editing or deleting a record breaks the link of that
+			// record or the next one.
+			edited := strings.Replace(out, "two", "TWO", 1)
+			assertChainErr(t, edited, pub, 3, "chain hash mismatch")
+
+			deleted := lines[0] + lines[2] + strings.Join(lines[3:], "")
+			assertChainErr(t, deleted, pub, 2, "chain hash mismatch")
+
+			// A log that was rotated must start at a checkpoint.
+			rotated := strings.Join(lines[4:], "")
+			assertChainErr(
+				t, rotated, pub, 1, "record before first checkpoint",
+			)
+			rotated = strings.Join(lines[3:], "")
+			assertChainStats(t, rotated, pub, HashChainStats{
+				Records:     1,
+				Checkpoints: 1,
+				Unsigned:    1,
+			})
+		})
+	}
+}
+
+// assertChainErr asserts that verifying the given log fails at the given line
+// for the given reason.
+func assertChainErr(t *testing.T, log string, pub ed25519.PublicKey, line int,
+	reason string) {
+
+	t.Helper()
+
+	_, err := VerifyHashChain(strings.NewReader(log), pub)
+
+	var chainErr *HashChainError
+	if !errors.As(err, &chainErr) {
+		t.Fatalf("Expected a HashChainError, got %v", err)
+	}
+	if chainErr.Line != line || chainErr.Reason != reason {
+		t.Fatalf("Expected error at line %d: %s, got %v", line, reason,
+			err)
+	}
+}
+
+// assertChainStats asserts that the given log verifies with the given stats.
+func assertChainStats(t *testing.T, log string, pub ed25519.PublicKey,
+	expected HashChainStats) {
+
+	t.Helper()
+
+	stats, err := VerifyHashChain(strings.NewReader(log), pub)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, log)
+	}
+	if stats != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+// TestHashChainCheckpoint tests that the Checkpoint method of a handler signs
+// the records written so far and that a genesis checkpoint can't be used to
+// restart the chain elsewhere in the log.
+func TestHashChainCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	pub, priv := testKey(1)
+
+	var buf bytes.Buffer
+	handler := NewJSONHandler(
+		&buf, WithNoTimestamp(),
+		WithHashChain(WithCheckpointKey(priv), WithCheckpointInterval(0)),
+	)
+	log := NewSLogger(handler)
+	log.Info("one")
+	log.Info("two")
+
+	out := buf.String()
+	assertChainStats(t, out, pub, HashChainStats{
+		Records:     2,
+		Checkpoints: 1,
+		Unsigned:    2,
+	})
+
+	if err := handler.Checkpoint(); err != nil {
+		t.Fatalf("Unable to checkpoint: %v", err)
+	}
+	out = buf.String()
+	assertChainStats(t, out, pub, HashChainStats{
+		Records:     2,
+		Checkpoints: 2,
+		Unsigned:    0,
+	})
+
+	lines := strings.SplitAfter(out, "\n")
+	if !strings.Contains(lines[0], `"nonce":"`) ||
+		strings.Contains(lines[3], `"nonce":"`) {
+
+		t.Fatalf("Expected a nonce in the genesis checkpoint only:\n%s",
+			out)
+	}
+	replayed := lines[0] + lines[1] + lines[0] + lines[2] + lines[3]
+	assertChainErr(t, replayed, pub, 3, "replayed genesis checkpoint")
+
+	// A handler without a hash chain has nothing to checkpoint.
+	buf.Reset()
+	if err := NewDefaultHandler(&buf).Checkpoint(); err != nil {
+		t.Fatalf("Unable to checkpoint: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", buf.Bytes())
+	}
+}
+
+// TestHashChainGenesis tests that a log may contain several chains, that each
+// starts from a genesis checkpoint bound to its nonce and that a genesis
+// checkpoint can't be used to restart a chain elsewhere in the log.
+func TestHashChainGenesis(t *testing.T) {
+	t.Parallel()
+
+	pub, priv := testKey(1)
+
+	// Two processes append to the same log in turn. The first doesn't
+	// write a checkpoint after its last record while the second writes
+	// its genesis checkpoint before logging anything and checkpoints its
+	// last record.
+	var buf bytes.Buffer
+	first := btclog.NewBackend(NewHashChainWriter(
+		&buf, WithCheckpointKey(priv), WithCheckpointInterval(2),
+	)).Logger("TEST")
+	first.Info("one")
+	first.Info("two")
+	first.Info("three")
+
+	second := NewHashChainWriter(&buf, WithCheckpointKey(priv))
+	if err := second.Checkpoint(); err != nil {
+		t.Fatalf("Unable to checkpoint: %v", err)
+	}
+	if err := second.Checkpoint(); err != nil {
+		t.Fatalf("Unable to checkpoint: %v", err)
+	}
+	btclog.NewBackend(second).Logger("TEST").Info("four")
+	if err := second.Checkpoint(); err != nil {
+		t.Fatalf("Unable to checkpoint: %v", err)
+	}
+
+	out := buf.String()
+	lines := strings.SplitAfter(out, "\n")
+	if !strings.Contains(lines[0], " nonce=") ||
+		!strings.Contains(lines[5], " nonce=") ||
+		!strings.Contains(lines[6], " nonce=") ||
+		strings.Contains(lines[3], " nonce=") {
+
+		t.Fatalf("Expected nonces in genesis checkpoints only:\n%s", out)
+	}
+
+	// The record after the last checkpoint of the first chain remains
+	// unsigned.
+	assertChainStats(t, out, pub, HashChainStats{
+		Records:     4,
+		Checkpoints: 5,
+		Unsigned:    1,
+	})
+
+	// A genesis checkpoint that is copied to restart the chain is
+	// detected, as is one whose nonce doesn't match its hash.
+	replayed := strings.Join(lines[:4], "") + lines[0] +
+		strings.Join(lines[4:], "")
+	assertChainErr(t, replayed, pub, 5, "replayed genesis checkpoint")
+
+	nonce := lines[0][strings.Index(lines[0], "nonce=")+len("nonce="):]
+	badNonce := strings.Replace(out, nonce[:8], "00000000", 1)
+	assertChainErr(t, badNonce, pub, 1, "bad genesis checkpoint")
+
+	// A checkpoint of an empty chain without a nonce can't restart the
+	// chain, even if it's signed.
+	var zero [sha256.Size]byte
+	sig := ed25519.Sign(priv, checkpointMessage(0, zero))
+	forged := "CHECKPOINT seq=0 chain=" + string(appendHex(nil, zero[:])) +
+		" sig=" + string(appendHex(nil, sig)) + "\n"
+	assertChainErr(
+		t, lines[0]+lines[1]+forged+strings.Join(lines[2:], ""), pub, 3,
+		"bad genesis checkpoint",
+	)
+}
+
+// TestHashChainRotation tests that a RotatingFile written through a hash chain
+// is checkpointed whenever it's rotated or closed, so that each file verifies
+// on its own and all records are signed.
+func TestHashChainRotation(t *testing.T) {
+	t.Parallel()
+
+	pub, priv := testKey(1)
+
+	var (
+		now  = timeSource()
+		path = filepath.Join(t.TempDir(), "test.log")
+	)
+	r, err := NewRotatingFile(
+		path, WithMaxSize(300),
+		WithRotatorTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create rotating file: %v", err)
+	}
+
+	log := NewSLogger(NewDefaultHandler(
+		r, WithNoTimestamp(),
+		WithHashChain(WithCheckpointKey(priv), WithCheckpointInterval(0)),
+	))
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		log.Infof("record %d", i)
+	}
+	if err := r.Rotate(); err != nil {
+		t.Fatalf("Unable to rotate: %v", err)
+	}
+	log.Info("last")
+	if err := r.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+
+	files := append(rotatedFiles(t, path), filepath.Base(path))
+	if len(files) < 3 {
+		t.Fatalf("Expected at least 3 files, got %v", files)
+	}
+
+	var records uint64
+	for _, name := range files {
+		contents, err := os.ReadFile(
+			filepath.Join(filepath.Dir(path), name),
+		)
+		if err != nil {
+			t.Fatalf("Unable to read %s: %v", name, err)
+		}
+
+		stats, err := VerifyHashChain(bytes.NewReader(contents), pub)
+		if err != nil {
+			t.Fatalf("Unable to verify %s: %v\n%s", name, err,
+				contents)
+		}
+		if stats.Unsigned != 0 {
+			t.Fatalf("Expected all records of %s to be signed, "+
+				"got %+v", name, stats)
+		}
+		records += stats.Records
+	}
+	if records != 6 {
+		t.Fatalf("Expected 6 records, got %d", records)
+	}
+}
+
+// TestHashChainRotationEmpty tests that a file that only holds the checkpoint
+// written when it was opened isn't rotated once the rotation interval has
+// passed.
+func TestHashChainRotationEmpty(t *testing.T) {
+	t.Parallel()
+
+	_, priv := testKey(1)
+
+	var (
+		now  = timeSource()
+		path = filepath.Join(t.TempDir(), "test.log")
+	)
+	r, err := NewRotatingFile(
+		path, WithRotationInterval(time.Hour),
+		WithRotatorTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create rotating file: %v", err)
+	}
+	defer r.Close()
+
+	log := NewSLogger(NewDefaultHandler(
+		r, WithNoTimestamp(), WithHashChain(WithCheckpointKey(priv)),
+	))
+	log.Info("first")
+	if err := r.Rotate(); err != nil {
+		t.Fatalf("Unable to rotate: %v", err)
+	}
+
+	now = now.Add(90 * time.Minute)
+	log.Info("second")
+
+	if files := rotatedFiles(t, path); len(files) != 1 {
+		t.Fatalf("Expected 1 rotated file, got %v", files)
+	}
+}
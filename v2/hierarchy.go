@@ -0,0 +1,134 @@
+package btclog
+
+import (
+	"math"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// SubSystemSeparator separates the tags of nested subsystems when hierarchical
+// subsystems are enabled, e.g. "PEER.CONN".
+const SubSystemSeparator = "."
+
+// WithHierarchicalSubSystems enables hierarchical subsystems for the
+// DefaultHandler and JSONHandler, see WithSubSystemHierarchy for the
+// HandlerAdapter. The tag of a subsystem created with SubSystem from a handler
+// that already has a tag is then the parent's tag and the new tag joined by
+// SubSystemSeparator, and the handlers created with SubSystem, WithAttrs and
+// WithGroup inherit the level of their parent until SetLevel is called on them.
+// A level change is therefore propagated to all descendants of a handler that
+// haven't had their own level set. Without this option, these handlers get an
+// independent copy of their parent's level.
+//
+// A MultiHandler has hierarchical subsystems if any of its children has. A
+// Registry created with NewHandlerRegistry from a handler with hierarchical
+// subsystems creates the logger of a nested subsystem from that of its parent,
+// and the levels of subsystems can be set by glob pattern, such as
+// "PEER.*=debug".
+func WithHierarchicalSubSystems() HandlerOption {
+	return func(opts *handlerOpts) {
+		opts.hierarchical = true
+	}
+}
+
+// hierarchicalHandler is implemented by the handlers of this package that
+// support hierarchical subsystems.
+type hierarchicalHandler interface {
+	// hierarchical returns true if the handler was created with
+	// hierarchical subsystems enabled.
+	hierarchical() bool
+}
+
+// isHierarchical returns true if the given handler has hierarchical subsystems
+// enabled.
+func isHierarchical(h Handler) bool {
+	hh, ok := h.(hierarchicalHandler)
+
+	return ok && hh.hierarchical()
+}
+
+// inheritLevel is the value of a levelNode that inherits its parent's level.
+const inheritLevel = math.MinInt64
+
+// levelNode holds the slog level of a handler. A node either has its own level
+// or inherits the level of its parent, which allows level changes to propagate
+// down a tree of handlers without the parents having to track their children.
+type levelNode struct {
+	parent *levelNode
+	level  atomic.Int64
+}
+
+// newLevelNode creates a new levelNode with the given level.
+func newLevelNode(level int64) *levelNode {
+	n := &levelNode{}
+	n.level.Store(level)
+
+	return n
+}
+
+// Load returns the level of the node, which is the level of its closest
+// ancestor if it doesn't have its own level.
+func (n *levelNode) Load() int64 {
+	for ; n != nil; n = n.parent {
+		if level := n.level.Load(); level != inheritLevel {
+			return level
+		}
+	}
+
+	return int64(levelInfo)
+}
+
+// Store sets the node's own level.
+func (n *levelNode) Store(level int64) {
+	n.level.Store(level)
+}
+
+// inherited returns true if the node inherits the level of its parent.
+func (n *levelNode) inherited() bool {
+	return n.parent != nil && n.level.Load() == inheritLevel
+}
+
+// reset makes the node inherit the level of its parent again, if it has one.
+func (n *levelNode) reset() {
+	if n.parent != nil {
+		n.level.Store(inheritLevel)
+	}
+}
+
+// derive returns the level of a derived handler. If inherit is true, the new
+// node inherits the level of n. Otherwise, it has a copy of the current level
+// of n.
+func (n *levelNode) derive(inherit bool) *levelNode {
+	if inherit {
+		child := &levelNode{parent: n}
+		child.level.Store(inheritLevel)
+
+		return child
+	}
+
+	return newLevelNode(n.Load())
+}
+
+// subSystemTag returns the tag of a subsystem created from a handler with the
+// given tag.
+func subSystemTag(parent, tag string, hierarchical bool) string {
+	if !hierarchical || parent == "" {
+		return tag
+	}
+
+	return parent + SubSystemSeparator + tag
+}
+
+// isTagPattern returns true if the given subsystem tag is a glob pattern.
+func isTagPattern(tag string) bool {
+	return strings.ContainsAny(tag, `*?[\`)
+}
+
+// matchTag reports whether the given subsystem tag matches the glob pattern,
+// which uses the syntax of path.Match. The pattern must be valid.
+func matchTag(pattern, tag string) bool {
+	matched, _ := path.Match(pattern, tag)
+
+	return matched
+}
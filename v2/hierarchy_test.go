@@ -0,0 +1,106 @@
+package btclog
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+// TestHierarchicalSubSystems tests that hierarchical subsystems have nested
+// tags and inherit the level of their parent until their own level is set.
+func TestHierarchicalSubSystems(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]func(*bytes.Buffer) Handler{
+		"default": func(buf *bytes.Buffer) Handler {
+			return NewDefaultHandler(
+				buf, WithNoTimestamp(), WithHierarchicalSubSystems(),
+			)
+		},
+		"json": func(buf *bytes.Buffer) Handler {
+			return NewJSONHandler(
+				buf, WithNoTimestamp(), WithHierarchicalSubSystems(),
+			)
+		},
+		"adapter": func(buf *bytes.Buffer) Handler {
+			return NewHandlerAdapter(
+				slog.NewTextHandler(buf, &slog.HandlerOptions{
+					Level: toSlogLevel(LevelTrace),
+				}),
+				WithSubSystemHierarchy(),
+			)
+		},
+		"multi": func(buf *bytes.Buffer) Handler {
+			// The child captures all records so that only the
+			// level of the MultiHandler applies.
+			child := NewDefaultHandler(
+				buf, WithNoTimestamp(), WithHierarchicalSubSystems(),
+			)
+			child.SetLevel(LevelTrace)
+
+			m := NewMultiHandler(child)
+			m.SetLevel(LevelInfo)
+
+			return m
+		},
+	}
+
+	for name, newHandler := range handlers {
+		newHandler := newHandler
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			rootHandler := newHandler(&buf)
+			peerHandler := rootHandler.SubSystem("PEER")
+
+			root := NewSLogger(rootHandler)
+			peerLog := NewSLogger(peerHandler)
+			connLog := peerLog.SubSystem("CONN")
+			groupLog := NewSLogger(
+				withGroup(peerHandler, "conn"),
+			)
+
+			if connLog.Level() != LevelInfo {
+				t.Fatalf("Expected level info, got %s",
+					connLog.Level())
+			}
+
+			// A level change propagates down the tree.
+			peerLog.SetLevel(LevelDebug)
+			if connLog.Level() != LevelDebug {
+				t.Fatalf("Expected level debug, got %s",
+					connLog.Level())
+			}
+			if root.Level() != LevelInfo {
+				t.Fatalf("Expected root level info, got %s",
+					root.Level())
+			}
+
+			// A child with its own level is no longer affected by
+			// its parent, while its own children are.
+			connLog.SetLevel(LevelTrace)
+			peerLog.SetLevel(LevelWarn)
+			if connLog.Level() != LevelTrace {
+				t.Fatalf("Expected level trace, got %s",
+					connLog.Level())
+			}
+			if l := connLog.SubSystem("X").Level(); l != LevelTrace {
+				t.Fatalf("Expected level trace, got %s", l)
+			}
+
+			// Handlers derived with WithGroup inherit as well.
+			if groupLog.Level() != LevelWarn {
+				t.Fatalf("Expected level warn, got %s",
+					groupLog.Level())
+			}
+
+			buf.Reset()
+			connLog.Trace("Nested")
+			if !bytes.Contains(buf.Bytes(), []byte("PEER.CONN")) {
+				t.Fatalf("Expected nested tag, got %s",
+					buf.String())
+			}
+		})
+	}
+}
@@ -111,6 +111,28 @@ type Logger interface {
 	// means that if SetLevel is called on the parent logger, then this new
 	// level will be inherited by the new logger
 	WithPrefix(prefix string) Logger
+
+	// With returns a copy of the logger with the given key-value pair
+	// attributes added to each log message, including those written with
+	// the non-structured methods such as Infof. The attributes are bound
+	// to the handler with WithAttrs, so as with slog.Logger.With they are
+	// written before the attributes of each log call, even if a key is
+	// repeated.
+	//
+	// NOTE: this creates a new logger with an inherited log level. This
+	// means that if SetLevel is called on the parent logger, then this new
+	// level will be inherited by the new logger
+	With(attrs ...any) Logger
+
+	// WithGroup returns a copy of the logger with the given group appended
+	// to the logger's existing groups. The keys of all attributes added
+	// after the group, either via With or on the log call itself, are
+	// qualified by the group name.
+	//
+	// NOTE: this creates a new logger with an inherited log level. This
+	// means that if SetLevel is called on the parent logger, then this new
+	// level will be inherited by the new logger
+	WithGroup(name string) Logger
 }
 
 // Ensure that the Logger implements the btclog.Logger interface so that an
@@ -0,0 +1,535 @@
+package btclog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btclog"
+)
+
+// jsonTimeFormat is the layout used for the time field of a JSON log line. It
+// is RFC 3339 with millisecond precision so that it carries the same amount of
+// information as the timestamp written by the DefaultHandler.
+const jsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Keys used for the built-in fields of a JSON log line.
+const (
+	jsonTimeKey      = slog.TimeKey
+	jsonLevelKey     = slog.LevelKey
+	jsonSubSystemKey = "subsystem"
+	jsonPrefixKey    = "prefix"
+	jsonSourceKey    = slog.SourceKey
+	jsonMessageKey   = slog.MessageKey
+)
+
+// groupOrAttrs holds either a group name or a list of attributes that were
+// added to a handler via WithGroup or WithAttrs respectively.
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+// JSONHandler is a Handler that writes each log record as a single line JSON
+// object. It can be used along with NewSLogger as a drop-in replacement for
+// the DefaultHandler when the log output is consumed by a machine rather than
+// a human.
+//
+// The time, level, subsystem, prefix, source and msg fields are written first
+// followed by any attributes. Attributes added via WithGroup or slog.Group are
+// written as nested JSON objects.
+//
+// NOTE: the styling options (WithStyledLevel, WithStyledCallSite and
+// WithStyledKeys) are ignored by the JSONHandler since they would produce
+// invalid JSON.
+type JSONHandler struct {
+	level *levelNode
+
+	opts *handlerOpts
+	mu   *sync.Mutex
+	sink *sink
+
+	tag    string
+	prefix string
+
+	goas []groupOrAttrs
+}
+
+// A compile-time check to ensure that JSONHandler implements Handler.
+var _ Handler = (*JSONHandler)(nil)
+
+// NewJSONHandler creates a new Handler that writes JSON formatted log lines to
+// the given writer. It accepts the same options as NewDefaultHandler.
+func NewJSONHandler(w io.Writer, options ...HandlerOption) *JSONHandler {
+	opts := defaultHandlerOpts()
+	for _, o := range options {
+		o(opts)
+	}
+
+	handler := &JSONHandler{
+		sink:  newSink(w, opts),
+		opts:  opts,
+		mu:    &sync.Mutex{},
+		level: newLevelNode(int64(levelInfo)),
+	}
+
+	return handler
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the Handler interface.
+func (j *JSONHandler) Level() btclog.Level {
+	return fromSlogLevel(slog.Level(j.level.Load()))
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the Handler interface.
+func (j *JSONHandler) SetLevel(level btclog.Level) {
+	j.level.Store(int64(toSlogLevel(level)))
+}
+
+// Enabled reports whether the handler handles records at the given level. A
+// level override carried by the context, see WithLevelOverride, can lower the
+// level of the handler but not raise it.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (j *JSONHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if j.opts.exitsAt(level) {
+		return true
+	}
+
+	return enabledAt(ctx, j.level.Load(), level)
+}
+
+// Handle handles the Record. It will only be called if Enabled returns true.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (j *JSONHandler) Handle(ctx context.Context, r slog.Record) error {
+	if j.opts.exitsAt(r.Level) {
+		defer j.opts.criticalExit.handled(ctx)
+
+		if !enabledAt(ctx, j.level.Load(), r.Level) {
+			return nil
+		}
+	}
+
+	buf := newBuffer()
+	defer buf.free()
+
+	buf.writeByte('{')
+
+	// Timestamp.
+	if j.opts.withTimestamp {
+		// First check if the options provided specified a different
+		// time source to use. Otherwise, use the provided record time.
+		t := r.Time
+		if j.opts.timeSource != nil {
+			t = j.opts.timeSource()
+		}
+		if !t.IsZero() {
+			appendJSONKey(buf, jsonTimeKey)
+			appendJSONString(buf, t.Format(jsonTimeFormat))
+		}
+	}
+
+	// Level.
+	appendJSONKey(buf, jsonLevelKey)
+	appendJSONString(buf, LevelString(fromSlogLevel(r.Level)))
+
+	// Sub-system tag.
+	if j.tag != "" {
+		appendJSONKey(buf, jsonSubSystemKey)
+		appendJSONString(buf, j.tag)
+	}
+
+	// Prefix.
+	if j.prefix != "" {
+		appendJSONKey(buf, jsonPrefixKey)
+		appendJSONString(buf, j.prefix)
+	}
+
+	// The call-site.
+	if j.opts.flag&(Lshortfile|Llongfile) != 0 {
+		file, line := callsite(
+			j.opts.flag, r.PC, j.opts.callSiteSkipDepth,
+		)
+		if file != "" {
+			appendJSONKey(buf, jsonSourceKey)
+			appendJSONString(buf, file+":"+strconv.Itoa(line))
+		}
+	}
+
+	// The log message itself.
+	appendJSONKey(buf, jsonMessageKey)
+	appendJSONString(buf, r.Message)
+
+	// If the record has no attributes of its own, then any trailing groups
+	// would be empty and so should not be written at all.
+	goas := j.goas
+	if r.NumAttrs() == 0 {
+		for len(goas) > 0 && goas[len(goas)-1].group != "" {
+			goas = goas[:len(goas)-1]
+		}
+	}
+
+	// Append logger fields, opening a nested object for each group.
+	var openGroups int
+	for _, goa := range goas {
+		if goa.group != "" {
+			appendJSONKey(buf, goa.group)
+			buf.writeByte('{')
+			openGroups++
+
+			continue
+		}
+
+		for _, attr := range goa.attrs {
+			appendJSONAttr(buf, attr, 0)
+		}
+	}
+
+	// Append slog attributes.
+	r.Attrs(func(a slog.Attr) bool {
+		appendJSONAttr(buf, a, 0)
+		return true
+	})
+
+	for i := 0; i < openGroups; i++ {
+		buf.writeByte('}')
+	}
+	buf.writeString("}\n")
+
+	return j.sink.write(*buf)
+}
+
+// hierarchical returns true if the handler was created with
+// WithHierarchicalSubSystems.
+//
+// NOTE: this is part of the hierarchicalHandler interface.
+func (j *JSONHandler) hierarchical() bool {
+	return j.opts.hierarchical
+}
+
+// levelInherited returns true if the handler inherits the level of its parent.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (j *JSONHandler) levelInherited() bool {
+	return j.level.inherited()
+}
+
+// resetLevel makes the handler inherit the level of its parent again.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (j *JSONHandler) resetLevel() {
+	j.level.reset()
+}
+
+// FailedWrites returns the number of log lines that could not be written to
+// the primary writer. The count is shared by all handlers derived from the
+// same NewJSONHandler call.
+func (j *JSONHandler) FailedWrites() uint64 {
+	return j.sink.failed.Load()
+}
+
+// criticalExits returns the CriticalExits that are run after the handler has
+// handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (j *JSONHandler) criticalExits(level slog.Level) []*CriticalExit {
+	return j.opts.criticalExit.exits(level)
+}
+
+// attrLevelOverrides returns the attribute level overrides of the handler, if
+// any.
+//
+// NOTE: this is part of the attrOverridesHandler interface.
+func (j *JSONHandler) attrLevelOverrides() *AttrLevelOverrides {
+	return j.opts.attrOverrides
+}
+
+// Checkpoint writes a checkpoint of the hash chain of the handler's output if
+// the handler was created with WithHashChain. It does nothing otherwise.
+func (j *JSONHandler) Checkpoint() error {
+	return j.sink.checkpoint()
+}
+
+// WithAttrs returns a new Handler with the given attributes added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (j *JSONHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return j
+	}
+
+	return j.with(j.tag, j.prefix, true, groupOrAttrs{attrs: attrs})
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups. All attributes added after the group, either via
+// WithAttrs or on the record itself, are nested under the group's key.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (j *JSONHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return j
+	}
+
+	return j.with(j.tag, j.prefix, true, groupOrAttrs{group: name})
+}
+
+// SubSystem returns a copy of the given handler but with the new tag. All
+// attributes and groups added with WithAttrs and WithGroup are kept.
+//
+// NOTE: this creates a new logger with an independent log level. This
+// means that SetLevel needs to be called on the new logger to change
+// the level as any changes to the parent logger's level after creation
+// will not be inherited by the new logger. If the handler was created with
+// WithHierarchicalSubSystems, the new tag is nested under the current tag and
+// the new logger inherits the level of its parent instead.
+//
+// NOTE: this is part of the Handler interface.
+func (j *JSONHandler) SubSystem(tag string) Handler {
+	tag = subSystemTag(j.tag, tag, j.opts.hierarchical)
+	return j.with(tag, j.prefix, false)
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message. Note that the subsystem of the original logger is kept
+// but any existing prefix is overridden.
+//
+// NOTE: this creates a new logger with an inherited log level. This
+// means that if SetLevel is called on the parent logger, then this new
+// level will be inherited by the new logger
+//
+// NOTE: this is part of the Handler interface.
+func (j *JSONHandler) WithPrefix(prefix string) Handler {
+	return j.with(j.tag, prefix, true)
+}
+
+// with returns a new handler with the given group or attributes added. See
+// DefaultHandler.with for the meaning of shareLevel.
+func (j *JSONHandler) with(tag, prefix string, shareLevel bool,
+	goas ...groupOrAttrs) *JSONHandler {
+
+	j.mu.Lock()
+	sl := *j
+	j.mu.Unlock()
+
+	sl.mu = &sync.Mutex{}
+	sl.goas = append(
+		make([]groupOrAttrs, 0, len(j.goas)+len(goas)), j.goas...,
+	)
+	sl.goas = append(sl.goas, goas...)
+	sl.tag = tag
+	sl.prefix = prefix
+
+	// If shareLevel is false, create a new level that either inherits
+	// j.level or is an independent copy of it. Otherwise, sl.level already
+	// points to j.level.
+	if !shareLevel {
+		sl.level = j.level.derive(j.opts.hierarchical)
+	}
+
+	return &sl
+}
+
+// appendJSONKey writes the given key to the buffer as a JSON object key,
+// preceded by a comma if it is not the first member of the current object.
+func appendJSONKey(buf *buffer, key string) {
+	if len(*buf) > 0 && (*buf)[len(*buf)-1] != '{' {
+		buf.writeByte(',')
+	}
+	appendJSONString(buf, key)
+	buf.writeByte(':')
+}
+
+// appendJSONAttr writes the given attribute to the buffer as a JSON object
+// member. Group attributes are written as nested objects, or inlined if their
+// key is empty. Groups nested deeper than maxAttrDepth are not expanded.
+func appendJSONAttr(buf *buffer, a slog.Attr, depth int) {
+	// Resolve the Attr's value before doing anything else.
+	a.Value = a.Value.Resolve()
+
+	// Ignore empty Attrs.
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		appendJSONKey(buf, a.Key)
+		appendJSONValue(buf, a.Value)
+
+		return
+	}
+
+	// Ignore empty groups.
+	attrs := a.Value.Group()
+	if len(attrs) == 0 {
+		return
+	}
+
+	if depth >= maxAttrDepth {
+		appendJSONKey(buf, a.Key)
+		appendJSONString(buf, "!MAXDEPTH")
+
+		return
+	}
+
+	// A group with an empty key is inlined into the current object.
+	if a.Key == "" {
+		for _, ga := range attrs {
+			appendJSONAttr(buf, ga, depth+1)
+		}
+
+		return
+	}
+
+	appendJSONKey(buf, a.Key)
+	buf.writeByte('{')
+	for _, ga := range attrs {
+		appendJSONAttr(buf, ga, depth+1)
+	}
+	buf.writeByte('}')
+}
+
+// appendJSONValue writes the given slog.Value to the buffer as a JSON value.
+func appendJSONValue(buf *buffer, v slog.Value) {
+	defer func() {
+		// Recovery in case of nil pointer dereferences.
+		if r := recover(); r != nil {
+			// Catch any panics that are most likely due to nil
+			// pointers.
+			appendJSONString(buf, fmt.Sprintf("!PANIC: %v", r))
+		}
+	}()
+
+	switch v.Kind() {
+	case slog.KindString:
+		appendJSONString(buf, v.String())
+	case slog.KindInt64:
+		*buf = strconv.AppendInt(*buf, v.Int64(), 10)
+	case slog.KindUint64:
+		*buf = strconv.AppendUint(*buf, v.Uint64(), 10)
+	case slog.KindFloat64:
+		// NaN and infinities can't be represented as JSON numbers.
+		f := v.Float64()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			appendJSONString(buf, strconv.FormatFloat(f, 'g', -1, 64))
+		} else {
+			*buf = strconv.AppendFloat(*buf, f, 'g', -1, 64)
+		}
+	case slog.KindBool:
+		*buf = strconv.AppendBool(*buf, v.Bool())
+	case slog.KindDuration:
+		appendJSONString(buf, v.Duration().String())
+	case slog.KindTime:
+		appendJSONString(buf, v.Time().Format(time.RFC3339Nano))
+	case slog.KindAny:
+		appendJSONAny(buf, v.Any())
+	default:
+		appendJSONString(buf, v.String())
+	}
+}
+
+// appendJSONAny writes an arbitrary value to the buffer. Errors and
+// fmt.Stringers (such as the lazily evaluated Closure) are written as strings
+// and all other values are encoded using encoding/json, falling back to their
+// default string formatting if they can't be marshalled.
+func appendJSONAny(buf *buffer, a any) {
+	switch v := a.(type) {
+	case nil:
+		buf.writeString("null")
+
+		return
+	case json.Marshaler:
+	case error:
+		appendJSONString(buf, v.Error())
+
+		return
+	case fmt.Stringer:
+		appendJSONString(buf, v.String())
+
+		return
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		appendJSONString(buf, fmt.Sprintf("%+v", a))
+
+		return
+	}
+	buf.writeBytes(b)
+}
+
+// Adapted from encoding/json/encode.go.
+//
+// appendJSONString writes the given string to the buffer as a quoted JSON
+// string, escaping any characters as required.
+func appendJSONString(buf *buffer, s string) {
+	const hexDigits = "0123456789abcdef"
+
+	buf.writeByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if safeSet[b] {
+				i++
+				continue
+			}
+			buf.writeString(s[start:i])
+			switch b {
+			case '\\', '"':
+				buf.writeByte('\\')
+				buf.writeByte(b)
+			case '\n':
+				buf.writeString(`\n`)
+			case '\r':
+				buf.writeString(`\r`)
+			case '\t':
+				buf.writeString(`\t`)
+			default:
+				// This encodes bytes < 0x20 except for \t, \n
+				// and \r.
+				buf.writeString(`\u00`)
+				buf.writeByte(hexDigits[b>>4])
+				buf.writeByte(hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			buf.writeString(s[start:i])
+			buf.writeString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+
+		// U+2028 is LINE SEPARATOR and U+2029 is PARAGRAPH SEPARATOR.
+		// They are both technically valid characters in JSON strings,
+		// but don't work in JSONP, so they are escaped.
+		if c == '\u2028' || c == '\u2029' {
+			buf.writeString(s[start:i])
+			buf.writeString(`\u202`)
+			buf.writeByte(hexDigits[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf.writeString(s[start:])
+	buf.writeByte('"')
+}
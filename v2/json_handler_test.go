@@ -0,0 +1,164 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"testing/slogtest"
+)
+
+// TestJSONHandler tests that the JSONHandler's output looks as expected.
+func TestJSONHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		handlerOpts []HandlerOption
+		logFunc     func(log Logger)
+		expectedLog string
+	}{
+		{
+			name:        "Basic calls and levels",
+			handlerOpts: []HandlerOption{WithTimeSource(timeSource)},
+			logFunc: func(log Logger) {
+				log.Info("Test Basic Log")
+				log.Debugf("Test basic log with %s", "format")
+				log.Trace("Log should not appear due to level")
+			},
+			expectedLog: `{"time":"2009-01-03T12:00:00.000Z","level":"INF","msg":"Test Basic Log"}
+{"time":"2009-01-03T12:00:00.000Z","level":"DBG","msg":"Test basic log with format"}
+`,
+		},
+		{
+			name: "Call site",
+			handlerOpts: []HandlerOption{
+				WithNoTimestamp(),
+				WithCallSiteSkipDepth(5),
+				WithCallerFlags(Lshortfile),
+			},
+			logFunc: func(log Logger) {
+				log.Info("Test Basic Log")
+			},
+			expectedLog: `{"level":"INF","source":"json_handler_test.go:43","msg":"Test Basic Log"}
+`,
+		},
+		{
+			name:        "Sub-system and prefix",
+			handlerOpts: []HandlerOption{WithNoTimestamp()},
+			logFunc: func(log Logger) {
+				subLog := log.SubSystem("SUBS")
+				subLog.SetLevel(LevelDebug)
+				subLog.Debug("Test Basic Log")
+
+				pLog := subLog.WithPrefix("(Client)")
+				pLog.Debugf("Test Basic Log")
+			},
+			expectedLog: `{"level":"DBG","subsystem":"SUBS","msg":"Test Basic Log"}
+{"level":"DBG","subsystem":"SUBS","prefix":"(Client)","msg":"Test Basic Log"}
+`,
+		},
+		{
+			name:        "Structured Logs",
+			handlerOpts: []HandlerOption{WithNoTimestamp()},
+			logFunc: func(log Logger) {
+				ctx := context.Background()
+				log.InfoS(ctx, "Single word attribute", "key", "value")
+				log.InfoS(ctx, "Number attribute", "key", 5,
+					"float", 1.5, "bool", true)
+				log.InfoS(ctx, "Bad key", "key")
+				log.InfoS(ctx, "Escaped \"msg\"", "key",
+					"value\nvalue")
+				log.InfoS(ctx, "Group", slog.Group("peer",
+					"addr", "127.0.0.1", "id", 5))
+
+				type b struct {
+					Name string
+					Age  int
+				}
+				log.InfoS(ctx, "Struct values", "key", b{"Bob", 5})
+
+				ctx = WithCtx(ctx, "request_id", 5)
+				log.ErrorS(ctx, "Test context attributes",
+					errors.New("oh no"), "key", "value")
+			},
+			expectedLog: `{"level":"INF","msg":"Single word attribute","key":"value"}
+{"level":"INF","msg":"Number attribute","key":5,"float":1.5,"bool":true}
+{"level":"INF","msg":"Bad key","!BADKEY":"key"}
+{"level":"INF","msg":"Escaped \"msg\"","key":"value\nvalue"}
+{"level":"INF","msg":"Group","peer":{"addr":"127.0.0.1","id":5}}
+{"level":"INF","msg":"Struct values","key":{"Name":"Bob","Age":5}}
+{"level":"ERR","msg":"Test context attributes","request_id":5,"err":"oh no","key":"value"}
+`,
+		},
+		{
+			name:        "Slog Helpers",
+			handlerOpts: []HandlerOption{WithNoTimestamp()},
+			logFunc: func(log Logger) {
+				ctx := context.Background()
+				log.InfoS(ctx, "msg", Hex6("hex_val", []byte{
+					0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07,
+				}))
+				log.InfoS(ctx, "msg", Fmt("key", "%.3f", 3.241))
+				log.InfoS(ctx, "msg", ClosureAttr("key",
+					func() string {
+						return "lazy compute"
+					},
+				))
+			},
+			expectedLog: `{"level":"INF","msg":"msg","hex_val":"010203040506"}
+{"level":"INF","msg":"msg","key":"3.241"}
+{"level":"INF","msg":"msg","key":"lazy compute"}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler := NewJSONHandler(&buf, test.handlerOpts...)
+			logger := NewSLogger(handler)
+			logger.SetLevel(LevelDebug)
+
+			test.logFunc(logger)
+
+			if buf.String() != test.expectedLog {
+				t.Fatalf("Log result mismatch. Expected "+
+					"\n\"%s\", got \n\"%s\"",
+					test.expectedLog, buf.Bytes())
+			}
+		})
+	}
+}
+
+// TestJSONHandlerSlogTest runs the JSONHandler through the standard library's
+// slog.Handler conformance tests.
+func TestJSONHandlerSlogTest(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := NewJSONHandler(&buf, WithCallerFlags(0))
+
+	results := func() []map[string]any {
+		var ms []map[string]any
+		for _, line := range bytes.Split(buf.Bytes(), []byte{'\n'}) {
+			if len(line) == 0 {
+				continue
+			}
+
+			var m map[string]any
+			if err := json.Unmarshal(line, &m); err != nil {
+				t.Fatalf("Invalid JSON line %q: %v", line, err)
+			}
+			ms = append(ms, m)
+		}
+
+		return ms
+	}
+
+	if err := slogtest.TestHandler(handler, results); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,8 +1,13 @@
 package btclog
 
 import (
+	"fmt"
 	"log/slog"
+	"math"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/btcsuite/btclog"
 )
@@ -19,9 +24,9 @@ const (
 	LevelOff      = btclog.LevelOff
 )
 
-// LevelFromString returns a level based on the input string s.  If the input
-// can't be interpreted as a valid log level, the info level and false is
-// returned.
+// LevelFromString returns a level based on the input string s, which may also
+// be either name of a level registered with RegisterLevel.  If the input can't
+// be interpreted as a valid log level, the info level and false is returned.
 func LevelFromString(s string) (l btclog.Level, ok bool) {
 	switch strings.ToLower(s) {
 	case "trace", "trc":
@@ -39,8 +44,197 @@ func LevelFromString(s string) (l btclog.Level, ok bool) {
 	case "off":
 		return LevelOff, true
 	default:
+		return lookupLevel(strings.ToLower(s))
+	}
+}
+
+// customLevel describes a level registered with RegisterLevel.
+type customLevel struct {
+	name  string
+	short string
+	level slog.Level
+}
+
+// levelTable holds the levels registered with RegisterLevel. It is replaced as
+// a whole whenever a level is registered so that it can be read without
+// locking.
+type levelTable struct {
+	custom map[btclog.Level]customLevel
+	byName map[string]btclog.Level
+
+	// ordered holds all levels that records can be logged at in order of
+	// increasing slog level, and slogLevels holds their slog levels.
+	ordered    []btclog.Level
+	slogLevels []slog.Level
+}
+
+var (
+	// registerMtx serializes calls to RegisterLevel.
+	registerMtx sync.Mutex
+
+	// registered holds the table of registered levels.
+	registered atomic.Pointer[levelTable]
+)
+
+// builtinLevels holds the built-in levels that records can be logged at in
+// order of increasing slog level.
+var builtinLevels = &levelTable{
+	ordered: []btclog.Level{
+		LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError,
+		LevelCritical,
+	},
+	slogLevels: []slog.Level{
+		levelTrace, levelDebug, levelInfo, levelWarn, levelError,
+		levelCritical,
+	},
+}
+
+// loadLevels returns the table of registered levels, which only holds the
+// built-in levels if no levels have been registered.
+func loadLevels() *levelTable {
+	if t := registered.Load(); t != nil {
+		return t
+	}
+
+	return builtinLevels
+}
+
+// RegisterLevel registers an additional named level, such as a notice level
+// between info and warn or a fatal level above critical, which is mapped to the
+// given slog level. The new level can be used with the level-control APIs,
+// such as SetLevel and a Registry, and records logged at its slog level, e.g.
+// with the Log method of an slog.Logger using one of the handlers of this
+// package, are written with its short name. Records logged at slog levels that
+// are not mapped to any level are written with the name of the closest level
+// below them.
+//
+// Registered levels are only known to this package, so LevelString rather than
+// the String method of the level should be used to print them, and they can't
+// be used with the loggers of the btclog v1 package. A Registry and a
+// LevelHTTPHandler reject them for such loggers.
+//
+// The slog level must not be used by another level, and the names must not be
+// accepted by LevelFromString already. Levels should be registered during
+// initialization, before loggers are configured to use them.
+func RegisterLevel(name, short string, level slog.Level) (btclog.Level,
+	error) {
+
+	registerMtx.Lock()
+	defer registerMtx.Unlock()
+
+	if name == "" || short == "" {
+		return LevelOff, fmt.Errorf("level names must not be empty")
+	}
+	if level >= levelOff {
+		return LevelOff, fmt.Errorf("level %d is not below the off level",
+			level)
+	}
+	for _, n := range []string{name, short} {
+		if l, ok := LevelFromString(n); ok {
+			return LevelOff, fmt.Errorf("level name %q is already "+
+				"used by level %s", n, LevelString(l))
+		}
+	}
+
+	prev := loadLevels()
+	for i, l := range prev.slogLevels {
+		if l == level {
+			return LevelOff, fmt.Errorf("level %d is already used by "+
+				"level %s", level, LevelString(prev.ordered[i]))
+		}
+	}
+
+	next := &levelTable{
+		custom: make(map[btclog.Level]customLevel, len(prev.custom)+1),
+		byName: make(map[string]btclog.Level, len(prev.byName)+2),
+	}
+	for l, c := range prev.custom {
+		next.custom[l] = c
+	}
+	for n, l := range prev.byName {
+		next.byName[n] = l
+	}
+
+	lvl := LevelOff + 1 + btclog.Level(len(prev.custom))
+	next.custom[lvl] = customLevel{
+		name:  name,
+		short: short,
+		level: level,
+	}
+	next.byName[strings.ToLower(name)] = lvl
+	next.byName[strings.ToLower(short)] = lvl
+
+	// Insert the new level in order, copying the slices since they may
+	// still be used by readers of the previous table.
+	i := sort.Search(len(prev.slogLevels), func(i int) bool {
+		return prev.slogLevels[i] > level
+	})
+	next.ordered = make([]btclog.Level, 0, len(prev.ordered)+1)
+	next.ordered = append(next.ordered, prev.ordered[:i]...)
+	next.ordered = append(next.ordered, lvl)
+	next.ordered = append(next.ordered, prev.ordered[i:]...)
+	next.slogLevels = make([]slog.Level, 0, len(prev.slogLevels)+1)
+	next.slogLevels = append(next.slogLevels, prev.slogLevels[:i]...)
+	next.slogLevels = append(next.slogLevels, level)
+	next.slogLevels = append(next.slogLevels, prev.slogLevels[i:]...)
+
+	registered.Store(next)
+
+	return lvl, nil
+}
+
+// lookupLevel returns the registered level with the given lowercase name or
+// short name.
+func lookupLevel(name string) (btclog.Level, bool) {
+	l, ok := loadLevels().byName[name]
+	if !ok {
 		return LevelInfo, false
 	}
+
+	return l, true
+}
+
+// LevelString returns the tag of the given level used in log messages, or
+// "OFF" if the level will not produce any log output. Unlike the String method
+// of the level, it returns the short name of levels registered with
+// RegisterLevel.
+func LevelString(l btclog.Level) string {
+	if c, ok := loadLevels().custom[l]; ok {
+		return c.short
+	}
+
+	return l.String()
+}
+
+// SlogLevel returns the slog.Level that the given level is mapped to. This is
+// the level that its records are passed to slog.Handler implementations with.
+func SlogLevel(l btclog.Level) slog.Level {
+	return toSlogLevel(l)
+}
+
+// LevelForSlog returns the level of the records that are logged at the given
+// slog.Level, which is the closest level at or below it.
+func LevelForSlog(l slog.Level) btclog.Level {
+	return fromSlogLevel(l)
+}
+
+// checkLevel returns an error wrapping ErrInvalidLevel if the given level
+// was registered with RegisterLevel and the given logger of a subsystem is not
+// a Logger or Handler of this package. Registered levels are unknown to other
+// loggers, such as those of a v1 Backend, which would stop writing all output
+// if they were set to one.
+func checkLevel(tag string, l Leveler, level btclog.Level) error {
+	if _, ok := loadLevels().custom[level]; !ok {
+		return nil
+	}
+
+	switch l.(type) {
+	case Logger, Handler:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s is not supported by subsystem %s",
+		ErrInvalidLevel, LevelString(level), tag)
 }
 
 // slog uses some pre-defined level integers. So we will need to sometimes map
@@ -53,7 +247,10 @@ const (
 	levelWarn                = slog.LevelWarn
 	levelError               = slog.LevelError
 	levelCritical slog.Level = 9
-	levelOff      slog.Level = 10
+
+	// levelOff is above any slog level that a record could be logged at
+	// and matches the severity of btclog.LevelOff.
+	levelOff slog.Level = math.MaxInt32
 )
 
 // toSlogLevel converts a btclog.Level to the associated slog.Level type.
@@ -72,12 +269,18 @@ func toSlogLevel(l btclog.Level) slog.Level {
 	case LevelCritical:
 		return levelCritical
 	default:
+		if c, ok := loadLevels().custom[l]; ok {
+			return c.level
+		}
+
 		return levelOff
 	}
 }
 
 // fromSlogLevel converts an slog.Level type to the associated btclog.Level
-// type.
+// type. An slog.Level that isn't mapped to a level exactly is converted to the
+// closest level below it, so that records logged through an slog.Logger at
+// levels such as slog.LevelInfo+2 are still written with a sensible level.
 func fromSlogLevel(l slog.Level) btclog.Level {
 	switch l {
 	case levelTrace:
@@ -93,6 +296,39 @@ func fromSlogLevel(l slog.Level) btclog.Level {
 	case levelCritical:
 		return LevelCritical
 	default:
-		return LevelOff
+		if l >= levelOff {
+			return LevelOff
+		}
+
+		t := loadLevels()
+		i := sort.Search(len(t.slogLevels), func(i int) bool {
+			return t.slogLevels[i] > l
+		})
+		if i == 0 {
+			return t.ordered[0]
+		}
+
+		return t.ordered[i-1]
+	}
+}
+
+// builtinLevel converts an slog.Level type to the closest built-in level at or
+// below it, or to the trace level if it is below all of them. Unlike
+// fromSlogLevel, levels registered with RegisterLevel are ignored and the
+// result is never the off level.
+func builtinLevel(l slog.Level) btclog.Level {
+	switch {
+	case l < levelDebug:
+		return LevelTrace
+	case l < levelInfo:
+		return LevelDebug
+	case l < levelWarn:
+		return LevelInfo
+	case l < levelError:
+		return LevelWarn
+	case l < levelCritical:
+		return LevelError
+	default:
+		return LevelCritical
 	}
 }
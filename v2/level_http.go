@@ -0,0 +1,278 @@
+package btclog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// Leveler is implemented by any type that has a logging level which can be
+// changed at runtime. This includes both v1 and v2 Loggers along with all
+// Handlers.
+type Leveler interface {
+	// Level returns the current logging level.
+	Level() btclog.Level
+
+	// SetLevel changes the logging level to the passed level.
+	SetLevel(level btclog.Level)
+}
+
+// Levelers returns the loggers of all registered subsystems keyed by tag so
+// that they can be passed to NewLevelHTTPHandler.
+func (r *Registry[L]) Levelers() map[string]Leveler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	levelers := make(map[string]Leveler, len(r.loggers))
+	for tag, l := range r.loggers {
+		levelers[tag] = l
+	}
+
+	return levelers
+}
+
+// LevelRequest is the body of a PUT or POST request to a LevelHTTPHandler.
+type LevelRequest struct {
+	// Global is the level that is applied to all subsystems, if set. It is
+	// applied before the per-subsystem levels.
+	Global string `json:"global,omitempty"`
+
+	// SubSystems maps subsystem tags to the level to apply to them.
+	SubSystems map[string]string `json:"subsystems,omitempty"`
+
+	// TTL is the duration, in the format accepted by time.ParseDuration,
+	// for which the levels are elevated. If empty, the change is
+	// permanent.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// LevelResponse is the body of the response of a LevelHTTPHandler.
+type LevelResponse struct {
+	// SubSystems maps subsystem tags to their current level.
+	SubSystems map[string]string `json:"subsystems,omitempty"`
+
+	// Error describes why a request failed.
+	Error string `json:"error,omitempty"`
+}
+
+// LevelHTTPHandler is an http.Handler that allows the levels of subsystem
+// loggers to be inspected and changed at runtime. It is intended to be served
+// on a local admin endpoint.
+//
+// A GET request returns the current level of each subsystem. A PUT or POST
+// request with a LevelRequest body changes the global or per-subsystem levels,
+// which are named as accepted by LevelFromString, and returns the resulting
+// levels. Levels registered with RegisterLevel are rejected for subsystems that
+// are not loggers of this package.
+//
+// If the request contains a TTL, the levels are elevated for its duration
+// instead, see LevelElevator, so a level only applies while it is more verbose
+// than the subsystem's own level. Overlapping elevations are combined such that
+// the most verbose one applies, and a subsystem that inherits the level of its
+// parent inherits it again once they have all expired. Loggers that don't
+// implement LevelElevator, such as v1 loggers, are elevated in the same way by
+// the handler.
+//
+// Example usage:
+//
+//	mux.Handle("/debug/loglevel", NewLevelHTTPHandler(registry.Levelers))
+type LevelHTTPHandler struct {
+	levelers func() map[string]Leveler
+
+	// mu serialises level changes so that they are applied atomically with
+	// respect to each other.
+	mu sync.Mutex
+
+	// elevations holds the level elevations of the subsystems whose
+	// loggers don't implement LevelElevator.
+	elevations map[string]*levelElevations
+}
+
+// A compile-time check to ensure that LevelHTTPHandler implements
+// http.Handler.
+var _ http.Handler = (*LevelHTTPHandler)(nil)
+
+// NewLevelHTTPHandler creates a new LevelHTTPHandler that exposes the loggers
+// returned by the given function. The function is called for each request so
+// that subsystems added later are included.
+func NewLevelHTTPHandler(
+	levelers func() map[string]Leveler) *LevelHTTPHandler {
+
+	return &LevelHTTPHandler{
+		levelers:   levelers,
+		elevations: make(map[string]*levelElevations),
+	}
+}
+
+// ServeHTTP handles a request to inspect or change the levels.
+//
+// NOTE: this is part of the http.Handler interface.
+func (h *LevelHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.writeResponse(w, http.StatusOK, h.levels(), nil)
+
+	case http.MethodPut, http.MethodPost:
+		var req LevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeResponse(w, http.StatusBadRequest, nil,
+				fmt.Errorf("%w: %v", ErrInvalidLevelSpec, err))
+			return
+		}
+
+		if err := h.apply(&req); err != nil {
+			h.writeResponse(w, http.StatusBadRequest, nil, err)
+			return
+		}
+
+		h.writeResponse(w, http.StatusOK, h.levels(), nil)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		h.writeResponse(w, http.StatusMethodNotAllowed, nil,
+			fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// levels returns the current level of each subsystem.
+func (h *LevelHTTPHandler) levels() map[string]string {
+	levelers := h.levelers()
+
+	levels := make(map[string]string, len(levelers))
+	for tag, l := range levelers {
+		levels[tag] = LevelString(l.Level())
+	}
+
+	return levels
+}
+
+// apply validates the given request in full and then applies it. If it
+// contains a TTL, the reversion of the change is scheduled.
+func (h *LevelHTTPHandler) apply(req *LevelRequest) error {
+	var (
+		global    btclog.Level
+		hasGlobal = req.Global != ""
+		ttl       time.Duration
+		err       error
+		ok        bool
+	)
+	if hasGlobal {
+		global, ok = LevelFromString(req.Global)
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrInvalidLevel, req.Global)
+		}
+	}
+
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("%w: invalid ttl %q",
+				ErrInvalidLevelSpec, req.TTL)
+		}
+	}
+
+	levelers := h.levelers()
+	levels := make(map[string]btclog.Level, len(req.SubSystems))
+	for tag, lvlStr := range req.SubSystems {
+		if _, ok := levelers[tag]; !ok {
+			return fmt.Errorf("%w %q, supported subsystems: %s",
+				ErrUnknownSubSystem, tag, sortedTags(levelers))
+		}
+
+		lvl, ok := LevelFromString(lvlStr)
+		if !ok {
+			return fmt.Errorf("%w: %q for subsystem %s",
+				ErrInvalidLevel, lvlStr, tag)
+		}
+		if err := checkLevel(tag, levelers[tag], lvl); err != nil {
+			return err
+		}
+		levels[tag] = lvl
+	}
+	if hasGlobal {
+		for tag, l := range levelers {
+			if err := checkLevel(tag, l, global); err != nil {
+				return err
+			}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	set := func(tag string, lvl btclog.Level) {
+		if ttl > 0 {
+			h.elevator(tag, levelers[tag]).SetLevelFor(lvl, ttl)
+			return
+		}
+
+		levelers[tag].SetLevel(lvl)
+	}
+
+	// The level of a subsystem given in the request takes precedence over
+	// the global one.
+	if hasGlobal {
+		for tag := range levelers {
+			if _, ok := levels[tag]; !ok {
+				set(tag, global)
+			}
+		}
+	}
+	for tag, lvl := range levels {
+		set(tag, lvl)
+	}
+
+	return nil
+}
+
+// elevator returns the LevelElevator of the given logger of a subsystem. If the
+// logger doesn't implement it, the level elevations of the subsystem that are
+// kept by the handler are returned.
+//
+// NOTE: the caller must hold the mutex.
+func (h *LevelHTTPHandler) elevator(tag string, l Leveler) LevelElevator {
+	if e, ok := l.(LevelElevator); ok {
+		return e
+	}
+
+	e, ok := h.elevations[tag]
+	if !ok {
+		e = newLevelElevations(l)
+		h.elevations[tag] = e
+	}
+
+	return e
+}
+
+// writeResponse writes a LevelResponse with the given status code, levels and
+// error.
+func (h *LevelHTTPHandler) writeResponse(w http.ResponseWriter, status int,
+	levels map[string]string, err error) {
+
+	resp := LevelResponse{SubSystems: levels}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// sortedTags returns the sorted tags of the given loggers as a comma separated
+// list.
+func sortedTags(levelers map[string]Leveler) string {
+	tags := make([]string, 0, len(levelers))
+	for tag := range levelers {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	return strings.Join(tags, ", ")
+}
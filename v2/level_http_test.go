@@ -0,0 +1,166 @@
+package btclog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// TestLevelHTTPHandler tests that levels can be listed and changed through the
+// LevelHTTPHandler for both v1 and v2 loggers and that changes with a TTL are
+// reverted.
+func TestLevelHTTPHandler(t *testing.T) {
+	t.Parallel()
+
+	v1Logger := btclog.NewBackend(io.Discard).Logger("PEER")
+	registry := NewHandlerRegistry(NewDefaultHandler(io.Discard))
+	registry.Logger("SRVR")
+
+	levelers := func() map[string]Leveler {
+		l := registry.Levelers()
+		l["PEER"] = v1Logger
+		return l
+	}
+
+	handler := NewLevelHTTPHandler(levelers)
+
+	do := func(method, body string) (int, LevelResponse) {
+		req := httptest.NewRequest(
+			method, "/loglevel", strings.NewReader(body),
+		)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		var resp LevelResponse
+		err := json.NewDecoder(rec.Body).Decode(&resp)
+		if err != nil {
+			t.Fatalf("Unable to decode response: %v", err)
+		}
+
+		return rec.Code, resp
+	}
+
+	expect := func(method, body string, code int,
+		levels map[string]string) {
+
+		t.Helper()
+
+		gotCode, resp := do(method, body)
+		if gotCode != code {
+			t.Fatalf("Expected status %d, got %d: %s", code,
+				gotCode, resp.Error)
+		}
+		if !reflect.DeepEqual(resp.SubSystems, levels) {
+			t.Fatalf("Expected levels %v, got %v", levels,
+				resp.SubSystems)
+		}
+	}
+
+	expect(http.MethodGet, "", http.StatusOK,
+		map[string]string{"PEER": "INF", "SRVR": "INF"})
+
+	expect(http.MethodPut, `{"global":"debug","subsystems":{"PEER":"trc"}}`,
+		http.StatusOK, map[string]string{"PEER": "TRC", "SRVR": "DBG"})
+
+	// A change with a TTL only applies to the subsystems whose own level
+	// is less verbose, and the level of a subsystem given in the request
+	// takes precedence over the global one.
+	expect(http.MethodPost,
+		`{"global":"trace","subsystems":{"PEER":"warn"},"ttl":"1m"}`,
+		http.StatusOK, map[string]string{"PEER": "TRC", "SRVR": "TRC"})
+	expect(http.MethodPut, `{"global":"warn","subsystems":{"PEER":"trc"}}`,
+		http.StatusOK, map[string]string{"PEER": "TRC", "SRVR": "WRN"})
+
+	// Invalid requests must not change any level.
+	invalid := []string{
+		`{"global":"loud"}`,
+		`{"global":"off","subsystems":{"NOPE":"info"}}`,
+		`{"global":"off","subsystems":{"PEER":"loud"}}`,
+		`{"global":"off","ttl":"soon"}`,
+		`{"global":"notice"}`,
+		`{"subsystems":{"PEER":"notice"}}`,
+		`not json`,
+	}
+	for _, body := range invalid {
+		code, resp := do(http.MethodPut, body)
+		if code != http.StatusBadRequest || resp.Error == "" {
+			t.Fatalf("Expected bad request for %s, got %d", body,
+				code)
+		}
+	}
+	expect(http.MethodGet, "", http.StatusOK,
+		map[string]string{"PEER": "TRC", "SRVR": "WRN"})
+
+	expect(http.MethodDelete, "", http.StatusMethodNotAllowed, nil)
+}
+
+// TestLevelHTTPHandlerTTL tests that changes with a TTL are reverted once the
+// TTL has passed, also if they overlap, and that nested subsystems inherit the
+// level of their parents again.
+func TestLevelHTTPHandlerTTL(t *testing.T) {
+	t.Parallel()
+
+	v1Logger := btclog.NewBackend(io.Discard).Logger("PEER")
+	registry := NewHandlerRegistry(NewDefaultHandler(
+		io.Discard, WithHierarchicalSubSystems(),
+	))
+	connLog := registry.Logger("SRVR.CONN")
+	srvrLog, _ := registry.Get("SRVR")
+
+	handler := NewLevelHTTPHandler(func() map[string]Leveler {
+		l := registry.Levelers()
+		l["PEER"] = v1Logger
+		return l
+	})
+
+	put := func(body string) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			http.MethodPut, "/", bytes.NewBufferString(body),
+		)
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+	}
+
+	loggers := []Leveler{v1Logger, srvrLog, connLog}
+	waitFor := func(level btclog.Level) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for _, l := range loggers {
+			for l.Level() != level {
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected level %s, got %s",
+						level, l.Level())
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+	}
+
+	// The most verbose of the overlapping changes applies until it
+	// expires, after which the other one applies until it expires too.
+	put(`{"global":"trace","ttl":"500ms"}`)
+	put(`{"global":"debug","ttl":"3s"}`)
+	waitFor(LevelTrace)
+	waitFor(LevelDebug)
+	waitFor(LevelInfo)
+
+	srvrLog.SetLevel(LevelWarn)
+	if connLog.Level() != LevelWarn {
+		t.Fatalf("Expected SRVR.CONN to inherit level warn, got %s",
+			connLog.Level())
+	}
+}
@@ -0,0 +1,121 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+// The levels registered for the tests. Registered levels are global and can
+// only be registered once, so this is done during initialization.
+var (
+	levelNotice = mustRegisterLevel("notice", "NTC", slog.LevelInfo+2)
+	levelFatal  = mustRegisterLevel("fatal", "FTL", levelCritical+3)
+)
+
+// mustRegisterLevel registers a level and panics if that fails.
+func mustRegisterLevel(name, short string, level slog.Level) btclog.Level {
+	l, err := RegisterLevel(name, short, level)
+	if err != nil {
+		panic(err)
+	}
+
+	return l
+}
+
+// TestFromSlogLevel tests that slog levels that aren't mapped to a level
+// exactly are converted to the closest level below them.
+func TestFromSlogLevel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		level    slog.Level
+		expected btclog.Level
+	}{
+		{level: -10, expected: LevelTrace},
+		{level: levelTrace, expected: LevelTrace},
+		{level: slog.LevelDebug + 1, expected: LevelDebug},
+		{level: slog.LevelInfo + 1, expected: LevelInfo},
+		{level: slog.LevelInfo + 2, expected: levelNotice},
+		{level: slog.LevelInfo + 3, expected: levelNotice},
+		{level: slog.LevelWarn + 2, expected: LevelWarn},
+		{level: slog.LevelError, expected: LevelError},
+		{level: slog.LevelError + 2, expected: LevelCritical},
+		{level: levelCritical + 3, expected: levelFatal},
+		{level: 100, expected: levelFatal},
+		{level: levelOff, expected: LevelOff},
+	}
+
+	for _, test := range tests {
+		if l := fromSlogLevel(test.level); l != test.expected {
+			t.Fatalf("Level mismatch for %d. Expected %s, got %s",
+				test.level, LevelString(test.expected),
+				LevelString(l))
+		}
+	}
+}
+
+// TestRegisterLevel tests that registered levels can be parsed, used as the
+// level of loggers and are written by the handlers.
+func TestRegisterLevel(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"notice", "NTC", "Notice"} {
+		if l, ok := LevelFromString(s); !ok || l != levelNotice {
+			t.Fatalf("Expected notice level for %q, got %s", s,
+				LevelString(l))
+		}
+	}
+	if s := LevelString(levelFatal); s != "FTL" {
+		t.Fatalf("Expected FTL, got %s", s)
+	}
+	if l := LevelForSlog(SlogLevel(levelNotice)); l != levelNotice {
+		t.Fatalf("Expected notice level, got %s", LevelString(l))
+	}
+
+	if _, err := RegisterLevel("info", "NEW", 1); err == nil {
+		t.Fatalf("Expected error for a name that is in use")
+	}
+	if _, err := RegisterLevel("new", "NEW", levelWarn); err == nil {
+		t.Fatalf("Expected error for a level that is in use")
+	}
+
+	var textBuf, jsonBuf bytes.Buffer
+	textHandler := NewDefaultHandler(&textBuf, WithNoTimestamp())
+	jsonHandler := NewJSONHandler(&jsonBuf, WithNoTimestamp())
+	ctx := context.Background()
+
+	textHandler.SetLevel(levelNotice)
+	jsonHandler.SetLevel(levelFatal)
+	if textHandler.Level() != levelNotice {
+		t.Fatalf("Expected notice level, got %s",
+			LevelString(textHandler.Level()))
+	}
+
+	log := NewSLogger(textHandler)
+	log.Info("Hidden")
+	slog.New(textHandler).Log(ctx, slog.LevelInfo+2, "Notice")
+	log.Warn("Warning")
+
+	jsonLog := slog.New(jsonHandler)
+	jsonLog.Log(ctx, levelCritical, "Hidden")
+	jsonLog.Log(ctx, levelCritical+3, "Fatal")
+
+	expectedLog := `[NTC]: Notice
+[WRN]: Warning
+`
+	if textBuf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, textBuf.Bytes())
+	}
+
+	expectedLog = `{"level":"FTL","msg":"Fatal"}
+`
+	if jsonBuf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, jsonBuf.Bytes())
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"runtime"
+	"time"
 
 	"github.com/btcsuite/btclog"
 )
@@ -14,6 +16,10 @@ var Disabled Logger
 
 // Handler wraps the slog.Handler interface with a few more methods that we
 // need in order to satisfy the Logger interface.
+//
+// NOTE: the slog.Handler returned by the WithAttrs and WithGroup methods of a
+// Handler implementation must itself be a Handler that shares the level of the
+// receiver, since the With and WithGroup methods of a Logger are built on them.
 type Handler interface {
 	slog.Handler
 
@@ -42,10 +48,38 @@ type Handler interface {
 	WithPrefix(prefix string) Handler
 }
 
+// withAttrs returns the Handler returned by the WithAttrs method of the given
+// Handler for the given attributes, see toHandler.
+func withAttrs(h Handler, attrs []slog.Attr) Handler {
+	return toHandler(h, h.WithAttrs(attrs))
+}
+
+// withGroup returns the Handler returned by the WithGroup method of the given
+// Handler for the given group, see toHandler.
+func withGroup(h Handler, name string) Handler {
+	return toHandler(h, h.WithGroup(name))
+}
+
+// toHandler converts the slog.Handler returned by the WithAttrs or WithGroup
+// method of the given parent Handler back into a Handler. The handlers of this
+// package always return a Handler, but other implementations may return a
+// plain slog.Handler, which is then adapted with a HandlerAdapter at the level
+// of the parent. Such a handler has a level of its own, and the HandlerAdapter
+// adds the subsystem tags and prefixes of the handlers derived from it.
+func toHandler(parent Handler, h slog.Handler) Handler {
+	if handler, ok := h.(Handler); ok {
+		return handler
+	}
+
+	adapter := NewHandlerAdapter(h)
+	adapter.SetLevel(parent.Level())
+
+	return adapter
+}
+
 // sLogger is an implementation of Logger backed by a structured sLogger.
 type sLogger struct {
 	handler Handler
-	logger  *slog.Logger
 
 	// unusedCtx is a context that will be passed to the non-structured
 	// logging calls for backwards compatibility with the old v1 Logger
@@ -56,15 +90,24 @@ type sLogger struct {
 	// context for cancellation or deadlines. It purely uses it to extract
 	// any slog attributes that have been added as values to the context.
 	unusedCtx context.Context
+
+	// bound holds the attributes bound to the logger with With, which are
+	// added to the handler with WithAttrs but also kept so that they can
+	// be matched against attribute level overrides.
+	bound []slog.Attr
+
+	// elevations tracks the temporary level elevations of the logger. It
+	// is shared by all loggers that share the logger's level.
+	elevations *levelElevations
 }
 
 // NewSLogger constructs a new structured logger from the given Handler.
 func NewSLogger(handler Handler) Logger {
 	l := &sLogger{
 		handler:   handler,
-		logger:    slog.New(handler),
 		unusedCtx: context.Background(),
 	}
+	l.elevations = newLevelElevations(l)
 
 	return l
 }
@@ -74,11 +117,12 @@ func NewSLogger(handler Handler) Logger {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Tracef(format string, params ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelTrace) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelTrace) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelTrace, fmt.Sprintf(format, params...))
+	l.logf(ctx, levelTrace, lazyMessage{format: format, params: params})
 }
 
 // Debugf creates a formatted message from the to format specifier along with
@@ -86,11 +130,12 @@ func (l *sLogger) Tracef(format string, params ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Debugf(format string, params ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelDebug) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelDebug) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelDebug, fmt.Sprintf(format, params...))
+	l.logf(ctx, levelDebug, lazyMessage{format: format, params: params})
 }
 
 // Infof creates a formatted message from the to format specifier along with
@@ -98,11 +143,12 @@ func (l *sLogger) Debugf(format string, params ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Infof(format string, params ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelInfo) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelInfo) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelInfo, fmt.Sprintf(format, params...))
+	l.logf(ctx, levelInfo, lazyMessage{format: format, params: params})
 }
 
 // Warnf creates a formatted message from the to format specifier along with
@@ -110,11 +156,12 @@ func (l *sLogger) Infof(format string, params ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Warnf(format string, params ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelWarn) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelWarn) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelWarn, fmt.Sprintf(format, params...))
+	l.logf(ctx, levelWarn, lazyMessage{format: format, params: params})
 }
 
 // Errorf creates a formatted message from the to format specifier along with
@@ -122,11 +169,12 @@ func (l *sLogger) Warnf(format string, params ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Errorf(format string, params ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelError) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelError) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelError, fmt.Sprintf(format, params...))
+	l.logf(ctx, levelError, lazyMessage{format: format, params: params})
 }
 
 // Criticalf creates a formatted message from the to format specifier along
@@ -134,11 +182,12 @@ func (l *sLogger) Errorf(format string, params ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Criticalf(format string, params ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelCritical) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelCritical) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelCritical, fmt.Sprintf(format, params...))
+	l.logf(ctx, levelCritical, lazyMessage{format: format, params: params})
 }
 
 // Trace formats a message using the default formats for its operands, prepends
@@ -146,11 +195,12 @@ func (l *sLogger) Criticalf(format string, params ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Trace(v ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelTrace) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelTrace) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelTrace, fmt.Sprint(v...))
+	l.logf(ctx, levelTrace, lazyMessage{params: v, sprint: true})
 }
 
 // Debug formats a message using the default formats for its operands, prepends
@@ -158,11 +208,12 @@ func (l *sLogger) Trace(v ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Debug(v ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelDebug) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelDebug) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelDebug, fmt.Sprint(v...))
+	l.logf(ctx, levelDebug, lazyMessage{params: v, sprint: true})
 }
 
 // Info formats a message using the default formats for its operands, prepends
@@ -170,11 +221,12 @@ func (l *sLogger) Debug(v ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Info(v ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelInfo) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelInfo) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelInfo, fmt.Sprint(v...))
+	l.logf(ctx, levelInfo, lazyMessage{params: v, sprint: true})
 }
 
 // Warn formats a message using the default formats for its operands, prepends
@@ -182,11 +234,12 @@ func (l *sLogger) Info(v ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Warn(v ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelWarn) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelWarn) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelWarn, fmt.Sprint(v...))
+	l.logf(ctx, levelWarn, lazyMessage{params: v, sprint: true})
 }
 
 // Error formats a message using the default formats for its operands, prepends
@@ -194,11 +247,12 @@ func (l *sLogger) Warn(v ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Error(v ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelError) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelError) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelError, fmt.Sprint(v...))
+	l.logf(ctx, levelError, lazyMessage{params: v, sprint: true})
 }
 
 // Critical formats a message using the default formats for its operands,
@@ -206,11 +260,12 @@ func (l *sLogger) Error(v ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) Critical(v ...any) {
-	if !l.handler.Enabled(l.unusedCtx, levelCritical) {
+	ctx := l.withAttrLevelOverride(l.unusedCtx, nil)
+	if !l.handler.Enabled(ctx, levelCritical) {
 		return
 	}
 
-	l.logger.Log(l.unusedCtx, levelCritical, fmt.Sprint(v...))
+	l.logf(ctx, levelCritical, lazyMessage{params: v, sprint: true})
 }
 
 // TraceS writes a structured log with the given message and key-value pair
@@ -218,11 +273,12 @@ func (l *sLogger) Critical(v ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) TraceS(ctx context.Context, msg string, attrs ...any) {
+	ctx = l.withAttrLevelOverride(ctx, attrs)
 	if !l.handler.Enabled(ctx, levelTrace) {
 		return
 	}
 
-	l.logger.Log(ctx, levelTrace, msg, mergeAttrs(ctx, attrs)...)
+	l.log(ctx, levelTrace, msg, mergeAttrs(ctx, attrs)...)
 }
 
 // DebugS writes a structured log with the given message and key-value pair
@@ -230,11 +286,12 @@ func (l *sLogger) TraceS(ctx context.Context, msg string, attrs ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) DebugS(ctx context.Context, msg string, attrs ...any) {
+	ctx = l.withAttrLevelOverride(ctx, attrs)
 	if !l.handler.Enabled(ctx, levelDebug) {
 		return
 	}
 
-	l.logger.Log(ctx, levelDebug, msg, mergeAttrs(ctx, attrs)...)
+	l.log(ctx, levelDebug, msg, mergeAttrs(ctx, attrs)...)
 }
 
 // InfoS writes a structured log with the given message and key-value pair
@@ -242,11 +299,12 @@ func (l *sLogger) DebugS(ctx context.Context, msg string, attrs ...any) {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) InfoS(ctx context.Context, msg string, attrs ...any) {
+	ctx = l.withAttrLevelOverride(ctx, attrs)
 	if !l.handler.Enabled(ctx, levelInfo) {
 		return
 	}
 
-	l.logger.Log(ctx, levelInfo, msg, mergeAttrs(ctx, attrs)...)
+	l.log(ctx, levelInfo, msg, mergeAttrs(ctx, attrs)...)
 }
 
 // WarnS writes a structured log with the given message and key-value pair
@@ -256,6 +314,7 @@ func (l *sLogger) InfoS(ctx context.Context, msg string, attrs ...any) {
 func (l *sLogger) WarnS(ctx context.Context, msg string, err error,
 	attrs ...any) {
 
+	ctx = l.withAttrLevelOverride(ctx, attrs)
 	if !l.handler.Enabled(ctx, levelWarn) {
 		return
 	}
@@ -264,7 +323,7 @@ func (l *sLogger) WarnS(ctx context.Context, msg string, err error,
 		attrs = append([]any{slog.String("err", err.Error())}, attrs...)
 	}
 
-	l.logger.Log(ctx, levelWarn, msg, mergeAttrs(ctx, attrs)...)
+	l.log(ctx, levelWarn, msg, mergeAttrs(ctx, attrs)...)
 }
 
 // ErrorS writes a structured log with the given message and key-value pair
@@ -274,6 +333,7 @@ func (l *sLogger) WarnS(ctx context.Context, msg string, err error,
 func (l *sLogger) ErrorS(ctx context.Context, msg string, err error,
 	attrs ...any) {
 
+	ctx = l.withAttrLevelOverride(ctx, attrs)
 	if !l.handler.Enabled(ctx, levelError) {
 		return
 	}
@@ -282,7 +342,7 @@ func (l *sLogger) ErrorS(ctx context.Context, msg string, err error,
 		attrs = append([]any{slog.String("err", err.Error())}, attrs...)
 	}
 
-	l.logger.Log(ctx, levelError, msg, mergeAttrs(ctx, attrs)...)
+	l.log(ctx, levelError, msg, mergeAttrs(ctx, attrs)...)
 }
 
 // CriticalS writes a structured log with the given message and key-value pair
@@ -292,6 +352,7 @@ func (l *sLogger) ErrorS(ctx context.Context, msg string, err error,
 func (l *sLogger) CriticalS(ctx context.Context, msg string, err error,
 	attrs ...any) {
 
+	ctx = l.withAttrLevelOverride(ctx, attrs)
 	if !l.handler.Enabled(ctx, levelCritical) {
 		return
 	}
@@ -300,7 +361,106 @@ func (l *sLogger) CriticalS(ctx context.Context, msg string, err error,
 		attrs = append([]any{slog.String("err", err.Error())}, attrs...)
 	}
 
-	l.logger.Log(ctx, levelCritical, msg, mergeAttrs(ctx, attrs)...)
+	l.log(ctx, levelCritical, msg, mergeAttrs(ctx, attrs)...)
+}
+
+// log creates a record with the given level, message and attributes whose PC
+// is that of the call-site of the logging method, so that handlers can use the
+// record's PC to identify the call-site, and passes it to the handler.
+func (l *sLogger) log(ctx context.Context, level slog.Level, msg string,
+	attrs ...any) {
+
+	// Skip runtime.Callers, this function and the logging method.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(attrs...)
+
+	l.handle(ctx, r)
+}
+
+// logf is like log for the non-structured logging methods. If the handler is a
+// deferredHandler that doesn't write the record right away, and the parameters
+// of the message can be copied, see lazyMessage.snapshot, the message is only
+// formatted once the record is written.
+func (l *sLogger) logf(ctx context.Context, level slog.Level,
+	msg lazyMessage) {
+
+	// Skip runtime.Callers, this function and the logging method.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	d, ok := l.handler.(deferredHandler)
+	if ok && !d.writes(ctx, level) {
+		if deferred, ok := msg.snapshot(); ok {
+			r := slog.NewRecord(time.Now(), level, "", pcs[0])
+			r.AddAttrs(slog.Any(deferredMsgKey, deferred))
+			l.handle(ctx, r)
+
+			return
+		}
+	}
+
+	r := slog.NewRecord(time.Now(), level, msg.String(), pcs[0])
+	l.handle(ctx, r)
+}
+
+// lazyMessage is the message of a non-structured log call, which is formatted
+// with fmt.Sprint if sprint is set and with fmt.Sprintf otherwise.
+type lazyMessage struct {
+	format string
+	params []any
+	sprint bool
+}
+
+// snapshot returns a copy of the message that can be formatted later, and on
+// another goroutine, without being affected by changes that the caller makes
+// after the log call. This is only possible if all parameters are values of
+// basic types, such as integers and strings, or of time.Time and time.Duration,
+// since other values, such as pointers, slices and any value with a String
+// method, may refer to state that the caller changes. False is returned if
+// that is not the case, in which case the message must be formatted right
+// away.
+func (m *lazyMessage) snapshot() (*lazyMessage, bool) {
+	for _, p := range m.params {
+		switch p.(type) {
+		case nil, bool, string, int, int8, int16, int32, int64, uint,
+			uint8, uint16, uint32, uint64, uintptr, float32, float64,
+			complex64, complex128, time.Time, time.Duration:
+
+		default:
+			return nil, false
+		}
+	}
+
+	return &lazyMessage{
+		format: m.format,
+		params: append([]any(nil), m.params...),
+		sprint: m.sprint,
+	}, true
+}
+
+// String formats the message.
+//
+// NOTE: This is part of the fmt.Stringer interface.
+func (m *lazyMessage) String() string {
+	if m.sprint {
+		return fmt.Sprint(m.params...)
+	}
+
+	return fmt.Sprintf(m.format, m.params...)
+}
+
+// handle passes the given record to the handler. It is kept separate from log
+// so that a handler is called at the same stack depth below a logging method
+// as it would be by slog.Logger.Log, which DefaultSkipDepth is based on.
+func (l *sLogger) handle(ctx context.Context, r slog.Record) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	_ = l.handler.Handle(ctx, r)
 }
 
 // Level returns the current logging level of the Handler.
@@ -317,11 +477,50 @@ func (l *sLogger) SetLevel(level btclog.Level) {
 	l.handler.SetLevel(level)
 }
 
+// levelInherited returns true if the logger inherits the level of its parent.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (l *sLogger) levelInherited() bool {
+	li, ok := l.handler.(levelInheritor)
+
+	return ok && li.levelInherited()
+}
+
+// resetLevel makes the logger inherit the level of its parent again.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (l *sLogger) resetLevel() {
+	if li, ok := l.handler.(levelInheritor); ok {
+		li.resetLevel()
+	}
+}
+
+// ElevateLevel lowers the logging level to the passed level, if it is more
+// verbose than the current level, until the returned restore function is
+// called.
+//
+// This is part of the LevelElevator interface implementation.
+func (l *sLogger) ElevateLevel(level btclog.Level) func() {
+	return l.elevations.elevate(level)
+}
+
+// SetLevelFor lowers the logging level to the passed level, if it is more
+// verbose than the current level, for the given duration or until the returned
+// restore function is called.
+//
+// This is part of the LevelElevator interface implementation.
+func (l *sLogger) SetLevelFor(level btclog.Level, d time.Duration) func() {
+	return l.elevations.elevateFor(level, d)
+}
+
 // SubSystem returns a copy of the logger but with the new subsystem tag.
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) SubSystem(tag string) Logger {
-	return NewSLogger(l.handler.SubSystem(tag))
+	logger := l.withHandler(l.handler.SubSystem(tag), l.bound)
+	logger.elevations = newLevelElevations(logger)
+
+	return logger
 }
 
 // WithPrefix returns a copy of the logger but with the given string prefixed to
@@ -330,11 +529,54 @@ func (l *sLogger) SubSystem(tag string) Logger {
 //
 // This is part of the Logger interface implementation.
 func (l *sLogger) WithPrefix(prefix string) Logger {
-	return NewSLogger(l.handler.WithPrefix(prefix))
+	return l.withHandler(l.handler.WithPrefix(prefix), l.bound)
+}
+
+// With returns a copy of the logger with the given key-value pair attributes
+// added to each log message.
+//
+// This is part of the Logger interface implementation.
+func (l *sLogger) With(attrs ...any) Logger {
+	if len(attrs) == 0 {
+		return l
+	}
+
+	bound := argsToAttrs(attrs)
+	handler := withAttrs(l.handler, bound)
+
+	return l.withHandler(
+		handler, append(l.bound[:len(l.bound):len(l.bound)], bound...),
+	)
+}
+
+// WithGroup returns a copy of the logger with the given group appended to the
+// logger's existing groups.
+//
+// This is part of the Logger interface implementation.
+func (l *sLogger) WithGroup(name string) Logger {
+	if name == "" {
+		return l
+	}
+
+	return l.withHandler(withGroup(l.handler, name), l.bound)
+}
+
+// withHandler returns a new sLogger that writes to the given handler, which
+// holds the given bound attributes, and shares the level elevations of the
+// receiver.
+func (l *sLogger) withHandler(handler Handler, bound []slog.Attr) *sLogger {
+	logger := NewSLogger(handler).(*sLogger)
+	logger.bound = bound
+	logger.elevations = l.elevations
+
+	return logger
 }
 
 var _ Logger = (*sLogger)(nil)
 
+// A compile-time check to ensure that sLogger implements LevelElevator.
+var _ LevelElevator = (*sLogger)(nil)
+
 func init() {
 	// Initialise the Disabled logger.
 	Disabled = NewSLogger(NewDefaultHandler(io.Discard))
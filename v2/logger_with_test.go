@@ -0,0 +1,121 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestLoggerWith tests that attributes and groups bound to a logger with With
+// and WithGroup are added to every log message and that the child loggers share
+// the level of their parent.
+func TestLoggerWith(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(&buf, WithNoTimestamp()))
+	log = log.SubSystem("PEER")
+	ctx := context.Background()
+
+	peerLog := log.With("peer", "1.2.3.4")
+	peerLog.Infof("Connected %d", 1)
+	peerLog.Debug("Hidden")
+	peerLog.InfoS(ctx, "Structured", "height", 5)
+
+	// Bound attributes are bound to the handler once, so as with
+	// slog.Logger.With they are written before those of the log call even
+	// if the keys repeat.
+	peerLog.InfoS(ctx, "Repeated", "peer", "5.6.7.8")
+
+	// Bound attributes are kept by derived loggers.
+	prefixLog := peerLog.WithPrefix("(inbound)")
+	prefixLog.Info("Prefixed")
+
+	groupLog := peerLog.WithGroup("conn").With("id", 7)
+	groupLog.Info("Grouped")
+	groupLog.InfoS(ctx, "Grouped", "bytes", 10)
+	groupLog.WithGroup("empty").Info("Empty group")
+
+	// The child loggers share the level of their parent.
+	log.SetLevel(LevelDebug)
+	peerLog.Debug("Visible")
+	groupLog.Debug("Visible")
+
+	expectedLog := `[INF] PEER: Connected 1 peer=1.2.3.4
+[INF] PEER: Structured peer=1.2.3.4 height=5
+[INF] PEER: Repeated peer=1.2.3.4 peer=5.6.7.8
+[INF] PEER: (inbound) Prefixed peer=1.2.3.4
+[INF] PEER: Grouped peer=1.2.3.4 conn.id=7
+[INF] PEER: Grouped peer=1.2.3.4 conn.id=7 conn.bytes=10
+[INF] PEER: Empty group peer=1.2.3.4 conn.id=7
+[DBG] PEER: Visible peer=1.2.3.4
+[DBG] PEER: Visible peer=1.2.3.4 conn.id=7
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
+
+// TestLoggerWithCallSite tests that the call-site of a logger created with
+// With is reported correctly.
+func TestLoggerWithCallSite(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(
+		&buf, WithNoTimestamp(), WithCallerFlags(Lshortfile),
+	))
+
+	log.With("peer", "1.2.3.4").Info("Connected")
+
+	if !strings.HasPrefix(buf.String(), "[INF] logger_with_test.go:") {
+		t.Fatalf("Unexpected call-site: %s", buf.String())
+	}
+}
+
+// plainHandler is a Handler whose WithAttrs and WithGroup methods return a
+// plain slog.Handler rather than a Handler.
+type plainHandler struct {
+	Handler
+}
+
+// WithAttrs returns the wrapped handler with the given attributes added as a
+// plain slog.Handler.
+func (p *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return struct{ slog.Handler }{p.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns the wrapped handler with the given group added as a plain
+// slog.Handler.
+func (p *plainHandler) WithGroup(name string) slog.Handler {
+	return struct{ slog.Handler }{p.Handler.WithGroup(name)}
+}
+
+// TestLoggerWithPlainHandler tests that With and WithGroup can be used with a
+// Handler whose WithAttrs and WithGroup methods return a plain slog.Handler,
+// and that the derived loggers start at the level of their parent.
+func TestLoggerWithPlainHandler(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := NewDefaultHandler(&buf, WithNoTimestamp()).SubSystem("PEER")
+	handler.SetLevel(LevelDebug)
+	log := NewSLogger(&plainHandler{Handler: handler})
+	ctx := context.Background()
+
+	peerLog := log.With("peer", "1.2.3.4")
+	peerLog.Debugf("Connected %d", 1)
+	peerLog.Trace("Hidden")
+	peerLog.WithGroup("conn").InfoS(ctx, "Grouped", "id", 7)
+
+	expectedLog := `[DBG] PEER: Connected 1 peer=1.2.3.4
+[INF] PEER: Grouped peer=1.2.3.4 conn.id=7
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
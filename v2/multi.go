@@ -0,0 +1,277 @@
+package btclog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/btcsuite/btclog"
+)
+
+// MultiHandler is a Handler that dispatches each record to several child
+// handlers, for example to write trace level logs to a debug file while only
+// writing info level logs and above to stdout. The level of each child is its
+// own threshold so each child only receives the records that it is enabled
+// for, in its own format.
+//
+// The MultiHandler additionally has its own level, which is the level that is
+// changed by SetLevel and which applies to all children. A record is only
+// handled if it is enabled by this level and by at least one child, so that
+// expensive attributes are only computed if the record will be written.
+//
+// SubSystem, WithPrefix, WithAttrs and WithGroup are propagated to all
+// children, with the same level-sharing semantics as the DefaultHandler. The
+// MultiHandler has hierarchical subsystems, see WithHierarchicalSubSystems, if
+// any of its children has.
+type MultiHandler struct {
+	handlers []Handler
+	level    *levelNode
+
+	// hierarchy is true if any of the children has hierarchical
+	// subsystems.
+	hierarchy bool
+}
+
+// A compile-time check to ensure that MultiHandler implements Handler.
+var _ Handler = (*MultiHandler)(nil)
+
+// NewMultiHandler creates a new MultiHandler that dispatches records to the
+// given handlers. The level of the MultiHandler is initialised to the lowest
+// level of the handlers so that each handler initially receives all records
+// that it is enabled for.
+//
+// Example usage:
+//
+//	debugFile := NewDefaultHandler(file)
+//	debugFile.SetLevel(LevelTrace)
+//	stdout := NewDefaultHandler(os.Stdout)
+//	alerts := NewJSONHandler(alertWriter)
+//	alerts.SetLevel(LevelError)
+//	handler := NewMultiHandler(debugFile, stdout, alerts)
+func NewMultiHandler(handlers ...Handler) *MultiHandler {
+	lowest := LevelOff
+	for _, h := range handlers {
+		if toSlogLevel(h.Level()) < toSlogLevel(lowest) {
+			lowest = h.Level()
+		}
+	}
+
+	m := &MultiHandler{
+		handlers: handlers,
+		level:    newLevelNode(int64(toSlogLevel(lowest))),
+	}
+	for _, h := range handlers {
+		m.hierarchy = m.hierarchy || isHierarchical(h)
+	}
+
+	return m
+}
+
+// Handlers returns the child handlers of the MultiHandler.
+func (m *MultiHandler) Handlers() []Handler {
+	return append([]Handler(nil), m.handlers...)
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the Handler interface.
+func (m *MultiHandler) Level() btclog.Level {
+	return fromSlogLevel(slog.Level(m.level.Load()))
+}
+
+// SetLevel changes the logging level of the Handler to the passed level. The
+// levels of the child handlers are not changed.
+//
+// NOTE: This is part of the Handler interface.
+func (m *MultiHandler) SetLevel(level btclog.Level) {
+	m.level.Store(int64(toSlogLevel(level)))
+}
+
+// Enabled reports whether the handler handles records at the given level. This
+// is the case if the level is enabled by the MultiHandler and by at least one of
+// its children, or if any child exits the process at the level. A level
+// override carried by the context, see WithLevelOverride, can lower the level
+// of the MultiHandler and is passed on to the children.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (m *MultiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if !enabledAt(ctx, m.level.Load(), level) {
+		return len(m.criticalExits(level)) != 0
+	}
+
+	for _, h := range m.handlers {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Handle passes the record on to each child handler that is enabled for its
+// level. All children are called even if one of them returns an error. If any
+// child exits the process after handling the record, see WithCriticalExit, the
+// process exits once all children have handled it, even if the record is not
+// enabled by the level of the MultiHandler.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (m *MultiHandler) Handle(ctx context.Context, r slog.Record) error {
+	if exits := m.criticalExits(r.Level); len(exits) != 0 {
+		if !exitDeferred(ctx) {
+			defer func() {
+				for _, c := range exits {
+					c.Exit()
+				}
+			}()
+		}
+		ctx = withDeferredExit(ctx)
+
+		if !enabledAt(ctx, m.level.Load(), r.Level) {
+			return nil
+		}
+	}
+
+	var errs []error
+	for _, h := range m.handlers {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+
+		if err := h.Handle(ctx, r.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// WithAttrs returns a new Handler with the given attributes added to all
+// children.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (m *MultiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return m.with(true, func(h Handler) Handler {
+		return withAttrs(h, attrs)
+	})
+}
+
+// WithGroup returns a new Handler with the given group appended to the existing
+// groups of all children.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (m *MultiHandler) WithGroup(name string) slog.Handler {
+	return m.with(true, func(h Handler) Handler {
+		return withGroup(h, name)
+	})
+}
+
+// SubSystem returns a copy of the given handler but with the new tag.
+//
+// NOTE: this creates a new logger with an independent log level. This
+// means that SetLevel needs to be called on the new logger to change
+// the level as any changes to the parent logger's level after creation
+// will not be inherited by the new logger, unless the MultiHandler has
+// hierarchical subsystems.
+//
+// NOTE: this is part of the Handler interface.
+func (m *MultiHandler) SubSystem(tag string) Handler {
+	return m.with(false, func(h Handler) Handler {
+		return h.SubSystem(tag)
+	})
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message.
+//
+// NOTE: this creates a new logger with an inherited log level. This means
+// that if SetLevel is called on the parent logger, then this new level will be
+// inherited by the new logger
+//
+// NOTE: this is part of the Handler interface.
+func (m *MultiHandler) WithPrefix(prefix string) Handler {
+	return m.with(true, func(h Handler) Handler {
+		return h.WithPrefix(prefix)
+	})
+}
+
+// hierarchical returns true if any of the children has hierarchical subsystems.
+//
+// NOTE: this is part of the hierarchicalHandler interface.
+func (m *MultiHandler) hierarchical() bool {
+	return m.hierarchy
+}
+
+// levelInherited returns true if the handler inherits the level of its parent.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (m *MultiHandler) levelInherited() bool {
+	return m.level.inherited()
+}
+
+// resetLevel makes the handler inherit the level of its parent again.
+//
+// NOTE: this is part of the levelInheritor interface.
+func (m *MultiHandler) resetLevel() {
+	m.level.reset()
+}
+
+// criticalExits returns the distinct CriticalExits of the children that are run
+// after they have handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (m *MultiHandler) criticalExits(level slog.Level) []*CriticalExit {
+	var exits []*CriticalExit
+	for _, h := range m.handlers {
+		for _, c := range criticalExitsOf(h, level) {
+			if !slices.Contains(exits, c) {
+				exits = append(exits, c)
+			}
+		}
+	}
+
+	return exits
+}
+
+// attrLevelOverrides returns the attribute level overrides of the first child
+// that has any, so that they also apply to records written through the
+// MultiHandler.
+//
+// NOTE: this is part of the attrOverridesHandler interface.
+func (m *MultiHandler) attrLevelOverrides() *AttrLevelOverrides {
+	for _, h := range m.handlers {
+		o, ok := h.(attrOverridesHandler)
+		if !ok {
+			continue
+		}
+		if overrides := o.attrLevelOverrides(); overrides != nil {
+			return overrides
+		}
+	}
+
+	return nil
+}
+
+// with returns a new MultiHandler with the given function applied to each of
+// the children. If shareLevel is false, the new handler has a level that either
+// inherits the level of the MultiHandler, if it has hierarchical subsystems, or
+// is an independent copy of it.
+func (m *MultiHandler) with(shareLevel bool,
+	fn func(h Handler) Handler) *MultiHandler {
+
+	handlers := make([]Handler, len(m.handlers))
+	for i, h := range m.handlers {
+		handlers[i] = fn(h)
+	}
+
+	level := m.level
+	if !shareLevel {
+		level = m.level.derive(m.hierarchy)
+	}
+
+	return &MultiHandler{
+		handlers:  handlers,
+		level:     level,
+		hierarchy: m.hierarchy,
+	}
+}
@@ -0,0 +1,112 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// TestMultiHandler tests that records are dispatched to each child handler
+// according to its level and that derived handlers are propagated to all
+// children.
+func TestMultiHandler(t *testing.T) {
+	t.Parallel()
+
+	var debugBuf, stdoutBuf, alertBuf bytes.Buffer
+	debugFile := NewDefaultHandler(&debugBuf, WithNoTimestamp())
+	debugFile.SetLevel(LevelTrace)
+	stdout := NewDefaultHandler(&stdoutBuf, WithNoTimestamp())
+	alerts := NewJSONHandler(&alertBuf, WithNoTimestamp())
+	alerts.SetLevel(LevelError)
+
+	handler := NewMultiHandler(debugFile, stdout, alerts)
+	if handler.Level() != LevelTrace {
+		t.Fatalf("Expected level %v, got %v", LevelTrace,
+			handler.Level())
+	}
+
+	log := NewSLogger(handler.SubSystem("PEER")).With("id", 1)
+	prefixLog := log.WithPrefix("(inbound)")
+	ctx := context.Background()
+
+	// A closure should only be computed if at least one child wants the
+	// record.
+	var computed int
+	lazy := ClosureAttr("lazy", func() string {
+		computed++
+		return "value"
+	})
+
+	log.TraceS(ctx, "Trace", lazy)
+	log.InfoS(ctx, "Info")
+	prefixLog.ErrorS(ctx, "Error", errors.New("boom"))
+
+	// Raising the level of the MultiHandler affects all children.
+	log.SetLevel(LevelOff)
+	log.TraceS(ctx, "Hidden", lazy)
+	prefixLog.CriticalS(ctx, "Hidden", nil)
+
+	if computed != 1 {
+		t.Fatalf("Expected closure to be computed once, got %d",
+			computed)
+	}
+
+	expectedDebug := `[TRC] PEER: Trace id=1 lazy=value
+[INF] PEER: Info id=1
+[ERR] PEER: (inbound) Error id=1 err=boom
+`
+	expectedStdout := `[INF] PEER: Info id=1
+[ERR] PEER: (inbound) Error id=1 err=boom
+`
+	expectedAlerts := `{"level":"ERR","subsystem":"PEER","prefix":"(inbound)","msg":"Error","id":1,"err":"boom"}
+`
+	for _, b := range []struct {
+		buf      *bytes.Buffer
+		expected string
+	}{
+		{&debugBuf, expectedDebug},
+		{&stdoutBuf, expectedStdout},
+		{&alertBuf, expectedAlerts},
+	} {
+		if b.buf.String() != b.expected {
+			t.Fatalf("Log result mismatch. Expected \n\"%s\", "+
+				"got \n\"%s\"", b.expected, b.buf.String())
+		}
+	}
+}
+
+// TestWrapperCallSite tests that the call-site of a record is that of the
+// logging call regardless of the handlers that wrap the handler writing it,
+// including for records that a FlightRecorder writes retroactively.
+func TestWrapperCallSite(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := NewDefaultHandler(
+		&buf, WithNoTimestamp(), WithCallerFlags(Lshortfile),
+	)
+	recorder := NewFlightRecorder(handler)
+	multi := NewMultiHandler(NewRedactingHandler(
+		NewSamplingHandler(recorder),
+	))
+	multi.SetLevel(LevelTrace)
+	log := NewSLogger(multi)
+
+	_, _, line, _ := runtime.Caller(0)
+	log.Infof("Written %d", 1)
+	log.Debug("Recorded")
+	if err := recorder.Dump(context.Background()); err != nil {
+		t.Fatalf("Unable to dump: %v", err)
+	}
+
+	expectedLog := fmt.Sprintf("[INF] multi_test.go:%d: Written 1\n"+
+		"[DBG] multi_test.go:%d: Recorded retro=true\n", line+1,
+		line+2)
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
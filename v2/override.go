@@ -0,0 +1,203 @@
+package btclog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btclog"
+)
+
+type levelOverrideKey struct{}
+
+// WithLevelOverride returns a copy of the context which overrides the level of
+// the handlers that records written with it are passed to. Such records are
+// enabled if they are at or above the given level, even if the level of the
+// handler is higher, which allows trace logs to be written for a single request
+// or peer without lowering the level of the whole subsystem. An override only
+// ever lowers the level of a handler, so records that the handler would write
+// anyway are never suppressed by it.
+//
+// The override is honoured by the structured logging methods of a Logger, such
+// as InfoS, and by the Enabled method of the handlers of this package.
+func WithLevelOverride(ctx context.Context, level btclog.Level) context.Context {
+	return context.WithValue(ctx, levelOverrideKey{}, level)
+}
+
+// LevelOverride returns the level override carried by the context, if any.
+func LevelOverride(ctx context.Context) (btclog.Level, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+
+	level, ok := ctx.Value(levelOverrideKey{}).(btclog.Level)
+
+	return level, ok
+}
+
+// enabledAt reports whether a record at the given level is enabled by a handler
+// with the given slog level, or by a level override carried by the context
+// which can only lower the level of the handler.
+func enabledAt(ctx context.Context, handlerLevel int64, level slog.Level) bool {
+	if handlerLevel <= int64(level) {
+		return true
+	}
+
+	override, ok := LevelOverride(ctx)
+
+	return ok && toSlogLevel(override) <= level
+}
+
+// attrOverridesHandler is implemented by handlers that were created with
+// WithAttrLevelOverrides.
+type attrOverridesHandler interface {
+	// attrLevelOverrides returns the attribute level overrides of the
+	// handler, if any.
+	attrLevelOverrides() *AttrLevelOverrides
+}
+
+// WithAttrLevelOverrides causes the log records written through the handler
+// that carry an attribute with one of the keys and values of the given
+// overrides to be written as if their context carried the level override of
+// the matching attribute. The same overrides may be used by several handlers.
+func WithAttrLevelOverrides(overrides *AttrLevelOverrides) HandlerOption {
+	return func(opts *handlerOpts) {
+		opts.attrOverrides = overrides
+	}
+}
+
+// AttrLevelOverrides is a set of attribute level overrides. Each overrides the
+// level of the log records that carry an attribute with a given key and value,
+// such as "peer" and the peer's public key, as if they were written with a
+// context returned by WithLevelOverride. The attribute may be passed to a
+// structured logging call, bound to the Logger with With or associated with the
+// context using WithCtx or a registered ContextExtractor. Since the
+// non-structured logging methods, such as Tracef, have neither attributes nor a
+// context, only the attributes bound to the Logger apply to them. Values are
+// compared in their string form, and only the values of attributes with an
+// overridden key are resolved.
+//
+// If a record matches several overrides, or also carries an override in its
+// context, the most verbose level applies. The overrides apply to the handlers
+// created with WithAttrLevelOverrides and may be changed while they are in use.
+type AttrLevelOverrides struct {
+	mu sync.RWMutex
+
+	// levels holds the level of each overridden value by attribute key.
+	levels map[string]map[string]btclog.Level
+
+	// count is the number of overrides, which allows the overrides to be
+	// skipped without locking if there are none.
+	count atomic.Int64
+}
+
+// NewAttrLevelOverrides creates a new, empty set of attribute level overrides.
+func NewAttrLevelOverrides() *AttrLevelOverrides {
+	return &AttrLevelOverrides{
+		levels: make(map[string]map[string]btclog.Level),
+	}
+}
+
+// Set overrides the level of the records that carry an attribute with the
+// given key and value.
+func (o *AttrLevelOverrides) Set(key, value string, level btclog.Level) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	values, ok := o.levels[key]
+	if !ok {
+		values = make(map[string]btclog.Level)
+		o.levels[key] = values
+	}
+	if _, ok := values[value]; !ok {
+		o.count.Add(1)
+	}
+	values[value] = level
+}
+
+// Remove removes the override for the given attribute key and value.
+func (o *AttrLevelOverrides) Remove(key, value string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	values, ok := o.levels[key]
+	if !ok {
+		return
+	}
+	if _, ok := values[value]; !ok {
+		return
+	}
+
+	o.count.Add(-1)
+	delete(values, value)
+	if len(values) == 0 {
+		delete(o.levels, key)
+	}
+}
+
+// match returns the most verbose level of the overrides that the given
+// attributes match, if any. Only the values of attributes whose key has an
+// override are resolved.
+func (o *AttrLevelOverrides) match(attrs []slog.Attr) (btclog.Level, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var (
+		level   btclog.Level
+		matched bool
+	)
+	for _, a := range attrs {
+		values, ok := o.levels[a.Key]
+		if !ok {
+			continue
+		}
+
+		override, ok := values[a.Value.Resolve().String()]
+		if !ok {
+			continue
+		}
+
+		if !matched || toSlogLevel(override) < toSlogLevel(level) {
+			level = override
+		}
+		matched = true
+	}
+
+	return level, matched
+}
+
+// withAttrLevelOverride returns a copy of the context with a level override if
+// any of the attributes of a log call with the given context and attributes, or
+// the attributes bound to the logger, match an attribute override of the
+// handler. The context is returned as is otherwise.
+func (l *sLogger) withAttrLevelOverride(ctx context.Context,
+	attrs []any) context.Context {
+
+	h, ok := l.handler.(attrOverridesHandler)
+	if !ok {
+		return ctx
+	}
+	overrides := h.attrLevelOverrides()
+	if overrides == nil || overrides.count.Load() == 0 {
+		return ctx
+	}
+
+	candidates := extractAttrs(ctx)
+	candidates = append(candidates, argsToAttrs(ctxAttrs(ctx))...)
+	candidates = append(candidates, l.bound...)
+	candidates = append(candidates, argsToAttrs(attrs)...)
+
+	level, matched := overrides.match(candidates)
+	if !matched {
+		return ctx
+	}
+
+	if ctxLevel, ok := LevelOverride(ctx); ok &&
+		toSlogLevel(ctxLevel) < toSlogLevel(level) {
+
+		return ctx
+	}
+
+	return WithLevelOverride(ctx, level)
+}
@@ -0,0 +1,124 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+// TestLevelOverride tests that a level override carried by the context lowers
+// the level of the handler for structured log calls but doesn't raise it.
+func TestLevelOverride(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(&buf, WithNoTimestamp()))
+
+	var debugBuf bytes.Buffer
+	multiLog := NewSLogger(NewMultiHandler(
+		NewDefaultHandler(&debugBuf, WithNoTimestamp()),
+	))
+
+	ctx := context.Background()
+	traceCtx := WithLevelOverride(ctx, LevelTrace)
+	errorCtx := WithLevelOverride(ctx, LevelError)
+
+	log.TraceS(traceCtx, "Visible", "n", 1)
+	log.TraceS(ctx, "Hidden")
+	log.InfoS(errorCtx, "Not suppressed")
+	log.Trace("Hidden")
+	multiLog.DebugS(traceCtx, "Visible", "n", 2)
+
+	expectedLog := `[TRC]: Visible n=1
+[INF]: Not suppressed
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+
+	expectedLog = `[DBG]: Visible n=2
+`
+	if debugBuf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, debugBuf.Bytes())
+	}
+
+	if level, ok := LevelOverride(traceCtx); !ok || level != LevelTrace {
+		t.Fatalf("Expected trace override, got %s", level)
+	}
+	if _, ok := LevelOverride(ctx); ok {
+		t.Fatalf("Expected no override")
+	}
+}
+
+// countingValuer is a slog.LogValuer that counts how often it's resolved.
+type countingValuer struct {
+	resolved *int
+}
+
+// LogValue increments the count and returns a constant value.
+func (c countingValuer) LogValue() slog.Value {
+	*c.resolved++
+	return slog.StringValue("03ab")
+}
+
+// TestAttrLevelOverride tests that an attribute override applies to the
+// records that carry the attribute, wherever it was added, and only to the
+// handlers created with it.
+func TestAttrLevelOverride(t *testing.T) {
+	t.Parallel()
+
+	overrides := NewAttrLevelOverrides()
+
+	var buf, otherBuf bytes.Buffer
+	log := NewSLogger(NewDefaultHandler(
+		&buf, WithNoTimestamp(), WithAttrLevelOverrides(overrides),
+	))
+	otherLog := NewSLogger(NewDefaultHandler(&otherBuf, WithNoTimestamp()))
+	ctx := context.Background()
+
+	overrides.Set("peer", "03ab", LevelDebug)
+	overrides.Set("peer", "02cd", LevelTrace)
+
+	log.DebugS(ctx, "Call attribute", "peer", "03ab")
+	log.With("peer", "03ab").WithGroup("g").DebugS(ctx, "Bound attribute")
+	log.With("peer", "02cd").Tracef("Non-structured %d", 1)
+	log.With("peer", "03ab").Trace("Hidden")
+	log.DebugS(WithCtx(ctx, "peer", "03ab"), "Context attribute")
+	log.TraceS(ctx, "Trace", "peer", "02cd")
+	log.TraceS(ctx, "Hidden", "peer", "03ab")
+	log.DebugS(ctx, "Hidden", "peer", "0000")
+	otherLog.DebugS(ctx, "Hidden", "peer", "03ab")
+
+	// Only the values of attributes with an overridden key are resolved.
+	var resolved int
+	log.DebugS(ctx, "Hidden", "other", countingValuer{&resolved})
+	if resolved != 0 {
+		t.Fatalf("Expected no resolved values, got %d", resolved)
+	}
+	log.DebugS(ctx, "Resolved", "peer", countingValuer{&resolved})
+	if resolved == 0 {
+		t.Fatalf("Expected the overridden value to be resolved")
+	}
+
+	overrides.Remove("peer", "03ab")
+	overrides.Remove("peer", "02cd")
+	log.DebugS(ctx, "Hidden", "peer", "03ab")
+
+	expectedLog := `[DBG]: Call attribute peer=03ab
+[DBG]: Bound attribute peer=03ab
+[TRC]: Non-structured 1 peer=02cd
+[DBG]: Context attribute peer=03ab
+[TRC]: Trace peer=02cd
+[DBG]: Resolved peer=03ab
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+	if otherBuf.Len() != 0 {
+		t.Fatalf("Expected no output, got %q", otherBuf.Bytes())
+	}
+}
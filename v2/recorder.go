@@ -0,0 +1,378 @@
+package btclog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// Default settings of a FlightRecorder.
+const (
+	// DefaultRecorderSize is the default maximum number of records that
+	// are kept per subsystem.
+	DefaultRecorderSize = 1000
+
+	// RetroKey is the key of the attribute that marks records that are
+	// written retroactively by a FlightRecorder.
+	RetroKey = "retro"
+)
+
+// RecorderOption is the signature of a functional option that can be used to
+// modify the behaviour of a FlightRecorder.
+type RecorderOption func(*recorderOpts)
+
+// recorderOpts holds options that can be modified by a RecorderOption.
+type recorderOpts struct {
+	// size is the maximum number of records kept per subsystem.
+	size int
+
+	// window is the maximum age of the records that are dumped. It is
+	// unlimited if zero.
+	window time.Duration
+
+	// dumpLevel is the level at and above which records trigger a dump.
+	dumpLevel slog.Level
+
+	// timeSource is used to obtain the current time.
+	timeSource func() time.Time
+}
+
+// WithRecorderSize sets the maximum number of records that are kept per
+// subsystem and so the maximum number of records that are dumped.
+func WithRecorderSize(size int) RecorderOption {
+	return func(opts *recorderOpts) {
+		opts.size = size
+	}
+}
+
+// WithRecorderWindow limits the records that are dumped to those that were
+// logged within the given duration before the dump.
+func WithRecorderWindow(window time.Duration) RecorderOption {
+	return func(opts *recorderOpts) {
+		opts.window = window
+	}
+}
+
+// WithDumpLevel sets the level at and above which a record triggers a dump of
+// the recorded records of its subsystem. It defaults to LevelError.
+func WithDumpLevel(level btclog.Level) RecorderOption {
+	return func(opts *recorderOpts) {
+		opts.dumpLevel = toSlogLevel(level)
+	}
+}
+
+// WithRecorderTimeSource can be used to overwrite the time source used to
+// determine the age of recorded records.
+func WithRecorderTimeSource(fn func() time.Time) RecorderOption {
+	return func(opts *recorderOpts) {
+		opts.timeSource = fn
+	}
+}
+
+// deferredMsgKey is the key of the attribute that holds the unformatted
+// message of a record that was passed to a deferredHandler.
+const deferredMsgKey = "!DEFERRED"
+
+// deferredHandler is implemented by handlers that are enabled for records that
+// they don't write right away, such as a FlightRecorder. The message of a
+// record that is passed to such a handler by a non-structured logging method,
+// such as Tracef, is only formatted if the record is written, provided that its
+// parameters can be copied. Until then, the
+// message of the record is empty and it carries a single attribute with the
+// deferredMsgKey key and the unformatted message as its value.
+type deferredHandler interface {
+	// writes reports whether a record at the given level is written right
+	// away.
+	writes(ctx context.Context, level slog.Level) bool
+}
+
+// formatDeferred returns the given record with its deferred message, if any,
+// formatted.
+func formatDeferred(r slog.Record) slog.Record {
+	if r.Message != "" || r.NumAttrs() != 1 {
+		return r
+	}
+
+	var msg *lazyMessage
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == deferredMsgKey {
+			msg, _ = a.Value.Any().(*lazyMessage)
+		}
+
+		return false
+	})
+	if msg == nil {
+		return r
+	}
+
+	return slog.NewRecord(r.Time, r.Level, msg.String(), r.PC)
+}
+
+// recordedEntry is a record held by a FlightRecorder.
+type recordedEntry struct {
+	record slog.Record
+
+	// handler is the wrapped handler that the record would be written to.
+	handler Handler
+
+	// recorded is the time at which the record was recorded.
+	recorded time.Time
+
+	// written is true if the record was written when it was logged.
+	written bool
+}
+
+// recorderRing is a ring buffer of the most recent records of a subsystem.
+type recorderRing struct {
+	mu      sync.Mutex
+	entries []recordedEntry
+
+	// next is the index at which the next entry is stored and full is
+	// true once the ring has wrapped around.
+	next int
+	full bool
+}
+
+// add stores the given entry, overwriting the oldest entry if the ring is full.
+func (r *recorderRing) add(e recordedEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// take removes and returns all stored entries in the order in which they were
+// added.
+func (r *recorderRing) take() []recordedEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []recordedEntry
+	if r.full {
+		entries = append(entries, r.entries[r.next:]...)
+	}
+	entries = append(entries, r.entries[:r.next]...)
+
+	for i := range r.entries {
+		r.entries[i] = recordedEntry{}
+	}
+	r.next = 0
+	r.full = false
+
+	return entries
+}
+
+// FlightRecorder is a Handler that wraps another Handler and keeps the most
+// recent records of each subsystem, at all levels, in memory. Records at or
+// above the level of the wrapped handler are written as usual. Once a record
+// at or above the dump level is logged, or Dump is called, the recorded
+// records of the subsystem that were not written are written retroactively,
+// marked with a RetroKey attribute, so that the context leading up to an error
+// is available without logging at the trace level permanently.
+//
+// Records are kept unformatted so that attributes such as closures are only
+// computed if the records are dumped. The values of attributes are kept as they
+// are, so a value that refers to state that the caller changes after the log
+// call, such as a pointer or a slice, is dumped with the changed state and must
+// be safe to read from another goroutine. The message of a non-structured
+// logging call, such as Tracef, is only formatted when its record is dumped if
+// all of its parameters are of basic types, such as integers and strings, which
+// are copied when the record is captured. Otherwise, it is formatted right away. Each handler created with SubSystem has its own
+// buffer, while handlers created with WithPrefix, WithAttrs and WithGroup share
+// the buffer of their parent.
+//
+// Retroactive records are below the level of the wrapped handler, so they are
+// passed to it with a context that carries a level override, see
+// WithLevelOverride. The handlers of this package, including those that check
+// the level of a record again in their Handle method such as MultiHandler,
+// honour it. Any other wrapped handler must do the same, or write the records
+// that are passed to its Handle method regardless of its level.
+type FlightRecorder struct {
+	handler Handler
+	opts    *recorderOpts
+	ring    *recorderRing
+}
+
+// A compile-time check to ensure that FlightRecorder implements Handler.
+var _ Handler = (*FlightRecorder)(nil)
+
+// A compile-time check to ensure that FlightRecorder implements
+// deferredHandler.
+var _ deferredHandler = (*FlightRecorder)(nil)
+
+// NewFlightRecorder creates a new FlightRecorder that wraps the given handler.
+func NewFlightRecorder(handler Handler,
+	options ...RecorderOption) *FlightRecorder {
+
+	opts := &recorderOpts{
+		size:       DefaultRecorderSize,
+		dumpLevel:  levelError,
+		timeSource: time.Now,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+	if opts.size < 1 {
+		opts.size = 1
+	}
+
+	return &FlightRecorder{
+		handler: handler,
+		opts:    opts,
+		ring:    newRecorderRing(opts.size),
+	}
+}
+
+// newRecorderRing creates a new recorderRing that holds up to size entries.
+func newRecorderRing(size int) *recorderRing {
+	return &recorderRing{
+		entries: make([]recordedEntry, size),
+	}
+}
+
+// Dump writes the recorded records of this handler's subsystem that were not
+// written when they were logged and clears the buffer.
+func (f *FlightRecorder) Dump(ctx context.Context) error {
+	now := f.opts.timeSource()
+
+	var errs []error
+	for _, e := range f.ring.take() {
+		if e.written {
+			continue
+		}
+
+		if f.opts.window > 0 && now.Sub(e.recorded) > f.opts.window {
+			continue
+		}
+
+		r := formatDeferred(e.record)
+		r.AddAttrs(slog.Bool(RetroKey, true))
+
+		// The record is below the level of the wrapped handler, so the
+		// level is overridden for it.
+		retroCtx := WithLevelOverride(ctx, fromSlogLevel(r.Level))
+		if err := e.handler.Handle(retroCtx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Level returns the current logging level of the Handler, which is the level
+// at and above which records are written when they are logged.
+//
+// NOTE: This is part of the Handler interface.
+func (f *FlightRecorder) Level() btclog.Level {
+	return f.handler.Level()
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the Handler interface.
+func (f *FlightRecorder) SetLevel(level btclog.Level) {
+	f.handler.SetLevel(level)
+}
+
+// Enabled reports whether the handler handles records at the given level. This
+// is always the case since records at all levels are recorded.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (f *FlightRecorder) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// writes reports whether a record at the given level is written right away,
+// which is the case if it's enabled by the wrapped handler.
+//
+// NOTE: this is part of the deferredHandler interface.
+func (f *FlightRecorder) writes(ctx context.Context, level slog.Level) bool {
+	return f.handler.Enabled(ctx, level)
+}
+
+// criticalExits returns the CriticalExits that are run after the wrapped
+// handler has handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (f *FlightRecorder) criticalExits(level slog.Level) []*CriticalExit {
+	return criticalExitsOf(f.handler, level)
+}
+
+// Handle records the record and writes it if it is enabled by the wrapped
+// handler. If the record is at or above the dump level, the recorded records
+// are dumped first.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (f *FlightRecorder) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= f.opts.dumpLevel {
+		if err := f.Dump(ctx); err != nil {
+			return err
+		}
+	}
+
+	written := f.handler.Enabled(ctx, r.Level)
+	f.ring.add(recordedEntry{
+		record:   r.Clone(),
+		handler:  f.handler,
+		recorded: f.opts.timeSource(),
+		written:  written,
+	})
+
+	if !written {
+		return nil
+	}
+
+	return f.handler.Handle(ctx, formatDeferred(r))
+}
+
+// WithAttrs returns a new Handler with the given attributes added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (f *FlightRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return f.with(withAttrs(f.handler, attrs), f.ring)
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (f *FlightRecorder) WithGroup(name string) slog.Handler {
+	return f.with(withGroup(f.handler, name), f.ring)
+}
+
+// SubSystem returns a copy of the given handler but with the new tag and its
+// own buffer.
+//
+// NOTE: this is part of the Handler interface.
+func (f *FlightRecorder) SubSystem(tag string) Handler {
+	return f.with(f.handler.SubSystem(tag), newRecorderRing(f.opts.size))
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message. The new handler shares the buffer of its parent.
+//
+// NOTE: this is part of the Handler interface.
+func (f *FlightRecorder) WithPrefix(prefix string) Handler {
+	return f.with(f.handler.WithPrefix(prefix), f.ring)
+}
+
+// with returns a new FlightRecorder that wraps the given handler.
+func (f *FlightRecorder) with(handler Handler,
+	ring *recorderRing) *FlightRecorder {
+
+	return &FlightRecorder{
+		handler: handler,
+		opts:    f.opts,
+		ring:    ring,
+	}
+}
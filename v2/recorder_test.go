@@ -0,0 +1,157 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestFlightRecorder tests that records below the level of the wrapped handler
+// are dumped retroactively on an error record or an explicit dump.
+func TestFlightRecorder(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf bytes.Buffer
+		now = timeSource()
+		ctx = context.Background()
+	)
+	recorder := NewFlightRecorder(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithRecorderSize(3),
+		WithRecorderWindow(time.Minute),
+		WithRecorderTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	peerHandler := recorder.SubSystem("PEER").(*FlightRecorder)
+	log := NewSLogger(peerHandler)
+	srvrLog := NewSLogger(recorder.SubSystem("SRVR"))
+
+	// A closure should only be computed if its record is written.
+	var computed int
+	lazy := ClosureAttr("lazy", func() string {
+		computed++
+		return "value"
+	})
+
+	log.TraceS(ctx, "Dropped from ring", lazy)
+	log.DebugS(ctx, "Handshake", "step", 1)
+	log.Info("Connected")
+	log.WithPrefix("(inbound)").TraceS(ctx, "Ping", lazy)
+	srvrLog.Debug("Other subsystem")
+
+	if computed != 0 {
+		t.Fatalf("Expected closure not to be computed, got %d",
+			computed)
+	}
+
+	log.ErrorS(ctx, "Disconnected", errors.New("eof"))
+
+	// Records older than the window are not dumped.
+	log.Debug("Too old")
+	now = now.Add(2 * time.Minute)
+	log.Debug("Recent")
+	if err := peerHandler.Dump(ctx); err != nil {
+		t.Fatalf("Unable to dump: %v", err)
+	}
+
+	expectedLog := `[INF] PEER: Connected
+[DBG] PEER: Handshake step=1 retro=true
+[TRC] PEER: (inbound) Ping lazy=value retro=true
+[ERR] PEER: Disconnected err=eof
+[DBG] PEER: Recent retro=true
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+
+	if computed != 1 {
+		t.Fatalf("Expected closure to be computed once, got %d",
+			computed)
+	}
+}
+
+// countingStringer is a fmt.Stringer that counts how often it is formatted.
+type countingStringer struct {
+	count int
+}
+
+// String returns a fixed string and increments the count.
+func (c *countingStringer) String() string {
+	c.count++
+	return "formatted"
+}
+
+// TestFlightRecorderLazyMessage tests that the messages of non-structured log
+// calls with parameters of basic types are only formatted once their records
+// are written, that other messages are formatted when they are logged, and that
+// dumped records are written by a wrapped handler that checks the level of each
+// record in its Handle method.
+func TestFlightRecorderLazyMessage(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf1, buf2 bytes.Buffer
+		param      countingStringer
+	)
+	recorder := NewFlightRecorder(NewMultiHandler(
+		NewDefaultHandler(&buf1, WithNoTimestamp()),
+		NewDefaultHandler(&buf2, WithNoTimestamp()),
+	))
+	log := NewSLogger(recorder)
+
+	// A Stringer may refer to state that changes after the log call, so
+	// the message is formatted right away.
+	log.Tracef("Trace %v", &param)
+	if param.count != 1 {
+		t.Fatalf("Expected message to be formatted once, got %d",
+			param.count)
+	}
+
+	// A slice that is changed after the log call is dumped as it was.
+	params := []int{1, 2}
+	log.Debug("Debug ", params)
+	params[0] = 3
+
+	// Parameters of basic types are copied and formatted once the
+	// record is written.
+	args := []any{"1.2.3.4", 8333}
+	log.With("peer", "1.2.3.4").Tracef("Attrs %v:%d", args...)
+	args[1] = 0
+
+	deferred := recorder.ring.entries[2].record
+	if deferred.Message != "" || deferred.NumAttrs() != 1 {
+		t.Fatalf("Expected message to be deferred, got %q",
+			deferred.Message)
+	}
+
+	log.Infof("Info %v", &param)
+	if param.count != 2 {
+		t.Fatalf("Expected message to be formatted twice, got %d",
+			param.count)
+	}
+
+	if err := recorder.Dump(context.Background()); err != nil {
+		t.Fatalf("Unable to dump: %v", err)
+	}
+	if param.count != 2 {
+		t.Fatalf("Expected messages to be formatted twice, got %d",
+			param.count)
+	}
+
+	expectedLog := `[INF]: Info formatted
+[TRC]: Trace formatted retro=true
+[DBG]: Debug [1 2] retro=true
+[TRC]: Attrs 1.2.3.4:8333 peer=1.2.3.4 retro=true
+`
+	for _, buf := range []*bytes.Buffer{&buf1, &buf2} {
+		if buf.String() != expectedLog {
+			t.Fatalf("Log result mismatch. Expected \n\"%s\", "+
+				"got \n\"%s\"", expectedLog, buf.Bytes())
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package btclog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/btcsuite/btclog"
+)
+
+// RedactedValue is the value that redacted attribute values are replaced with.
+const RedactedValue = "[REDACTED]"
+
+// redactedHashPrefix is the prefix of a redacted value when values are
+// replaced by a short hash.
+const redactedHashPrefix = "sha256:"
+
+// Secret wraps a sensitive value so that it is never written to a log in the
+// clear. A Secret always renders as RedactedValue, both as a structured log
+// attribute and when formatted with the fmt package, regardless of the handler
+// in use. A RedactingHandler configured with WithRedactHash can be used to
+// replace it with a short hash of the underlying value instead.
+//
+// Example usage:
+//
+//	log.InfoS(ctx, "Created wallet", "seed", NewSecret(seed))
+type Secret struct {
+	value any
+}
+
+// NewSecret wraps the given value in a Secret.
+func NewSecret(value any) Secret {
+	return Secret{value: value}
+}
+
+// Value returns the underlying value of the Secret.
+func (s Secret) Value() any {
+	return s.value
+}
+
+// String returns RedactedValue.
+//
+// NOTE: this is part of the fmt.Stringer interface.
+func (s Secret) String() string {
+	return RedactedValue
+}
+
+// GoString returns RedactedValue wrapped in the type name.
+//
+// NOTE: this is part of the fmt.GoStringer interface.
+func (s Secret) GoString() string {
+	return "btclog.Secret(" + RedactedValue + ")"
+}
+
+// LogValue returns RedactedValue as a string value.
+//
+// NOTE: this is part of the slog.LogValuer interface.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(RedactedValue)
+}
+
+// RedactOption is the signature of a functional option that can be used to
+// modify the behaviour of a RedactingHandler.
+type RedactOption func(*redactOpts)
+
+// redactOpts holds options that can be modified by a RedactOption.
+type redactOpts struct {
+	// keys holds lower-case glob patterns that are matched against
+	// attribute keys.
+	keys []string
+
+	// types holds the types of values that are redacted.
+	types []reflect.Type
+
+	// predicates holds custom functions that decide whether an attribute
+	// should be redacted.
+	predicates []func(groups []string, a slog.Attr) bool
+
+	// hash defines whether values are replaced with a short hash rather
+	// than RedactedValue.
+	hash bool
+}
+
+// WithRedactedKeys redacts the values of all attributes with a key that
+// matches one of the given patterns. Patterns use the syntax of path.Match and
+// are matched case-insensitively against both the attribute key and its
+// dotted path including any groups, e.g. "peer.macaroon". Invalid patterns
+// never match.
+func WithRedactedKeys(patterns ...string) RedactOption {
+	return func(opts *redactOpts) {
+		for _, p := range patterns {
+			opts.keys = append(opts.keys, strings.ToLower(p))
+		}
+	}
+}
+
+// WithRedactedTypes redacts the values of all attributes whose value has the
+// same type as one of the given sample values.
+func WithRedactedTypes(samples ...any) RedactOption {
+	return func(opts *redactOpts) {
+		for _, s := range samples {
+			opts.types = append(opts.types, reflect.TypeOf(s))
+		}
+	}
+}
+
+// WithRedactFunc redacts the values of all attributes for which the given
+// function returns true. The function is passed the groups that the attribute
+// is nested in and the attribute with its value resolved.
+func WithRedactFunc(fn func(groups []string, a slog.Attr) bool) RedactOption {
+	return func(opts *redactOpts) {
+		opts.predicates = append(opts.predicates, fn)
+	}
+}
+
+// WithRedactHash causes redacted values to be replaced with a short SHA-256
+// hash of the value, e.g. "sha256:1a2b3c4d", rather than RedactedValue. This
+// allows records that refer to the same value to be correlated without
+// revealing the value.
+func WithRedactHash() RedactOption {
+	return func(opts *redactOpts) {
+		opts.hash = true
+	}
+}
+
+// RedactingHandler is a Handler that wraps another Handler and redacts the
+// values of sensitive attributes before they reach it. This applies to
+// attributes of the record, including those carried by the context via
+// WithCtx, and to those added with WithAttrs. Values wrapped in a Secret are
+// always redacted.
+type RedactingHandler struct {
+	handler Handler
+	opts    *redactOpts
+
+	// groups holds the groups added via WithGroup.
+	groups []string
+}
+
+// A compile-time check to ensure that RedactingHandler implements Handler.
+var _ Handler = (*RedactingHandler)(nil)
+
+// NewRedactingHandler creates a new RedactingHandler that wraps the given
+// handler.
+func NewRedactingHandler(handler Handler,
+	options ...RedactOption) *RedactingHandler {
+
+	opts := &redactOpts{}
+	for _, o := range options {
+		o(opts)
+	}
+
+	return &RedactingHandler{
+		handler: handler,
+		opts:    opts,
+	}
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the Handler interface.
+func (h *RedactingHandler) Level() btclog.Level {
+	return h.handler.Level()
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the Handler interface.
+func (h *RedactingHandler) SetLevel(level btclog.Level) {
+	h.handler.SetLevel(level)
+}
+
+// Enabled reports whether the handler handles records at the given level.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// criticalExits returns the CriticalExits that are run after the wrapped
+// handler has handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (h *RedactingHandler) criticalExits(level slog.Level) []*CriticalExit {
+	return criticalExitsOf(h.handler, level)
+}
+
+// Handle redacts the attributes of the record and passes it on to the wrapped
+// handler.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(h.groups, a, 0))
+		return true
+	})
+
+	return h.handler.Handle(ctx, redacted)
+}
+
+// WithAttrs returns a new Handler with the given attributes redacted and
+// added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redacted = append(redacted, h.redactAttr(h.groups, a, 0))
+	}
+
+	return h.with(withAttrs(h.handler, redacted), h.groups)
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	groups := h.groups
+	if name != "" {
+		groups = append(groups[:len(groups):len(groups)], name)
+	}
+
+	return h.with(withGroup(h.handler, name), groups)
+}
+
+// SubSystem returns a copy of the given handler but with the new tag.
+//
+// NOTE: this is part of the Handler interface.
+func (h *RedactingHandler) SubSystem(tag string) Handler {
+	return h.with(h.handler.SubSystem(tag), nil)
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message.
+//
+// NOTE: this is part of the Handler interface.
+func (h *RedactingHandler) WithPrefix(prefix string) Handler {
+	return h.with(h.handler.WithPrefix(prefix), h.groups)
+}
+
+// with returns a new RedactingHandler that wraps the given handler.
+func (h *RedactingHandler) with(handler Handler,
+	groups []string) *RedactingHandler {
+
+	return &RedactingHandler{
+		handler: handler,
+		opts:    h.opts,
+		groups:  groups,
+	}
+}
+
+// redactAttr returns the given attribute with its value redacted if required.
+// The members of group attributes are redacted individually.
+func (h *RedactingHandler) redactAttr(groups []string, a slog.Attr,
+	depth int) slog.Attr {
+
+	// A Secret is checked for before the value is resolved so that the
+	// underlying value is available to be hashed.
+	if a.Value.Kind() == slog.KindLogValuer {
+		if s, ok := a.Value.Any().(Secret); ok {
+			return h.redacted(a.Key, s.value)
+		}
+	}
+
+	if h.matchesKey(groups, a.Key) || h.matchesType(a.Value) {
+		return h.redacted(a.Key, a.Value.Resolve())
+	}
+
+	a.Value = a.Value.Resolve()
+	if h.matchesType(a.Value) {
+		return h.redacted(a.Key, a.Value)
+	}
+
+	if a.Value.Kind() == slog.KindGroup && depth < maxAttrDepth {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+
+		members := a.Value.Group()
+		redacted := make([]slog.Attr, 0, len(members))
+		for _, ga := range members {
+			redacted = append(
+				redacted, h.redactAttr(groups, ga, depth+1),
+			)
+		}
+
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	}
+
+	for _, pred := range h.opts.predicates {
+		if pred(groups, a) {
+			return h.redacted(a.Key, a.Value)
+		}
+	}
+
+	return a
+}
+
+// matchesKey returns true if the given key, or its dotted path including the
+// given groups, matches one of the redacted key patterns.
+func (h *RedactingHandler) matchesKey(groups []string, key string) bool {
+	if len(h.opts.keys) == 0 {
+		return false
+	}
+
+	key = strings.ToLower(key)
+	fullKey := key
+	if len(groups) > 0 {
+		fullKey = strings.ToLower(strings.Join(groups, ".")) + "." + key
+	}
+
+	for _, pattern := range h.opts.keys {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, fullKey); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesType returns true if the given value is of one of the redacted types.
+func (h *RedactingHandler) matchesType(v slog.Value) bool {
+	if len(h.opts.types) == 0 {
+		return false
+	}
+	if v.Kind() != slog.KindAny && v.Kind() != slog.KindLogValuer {
+		return false
+	}
+
+	t := reflect.TypeOf(v.Any())
+	for _, rt := range h.opts.types {
+		if t == rt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redacted returns an attribute with the given key and a redacted value in
+// place of the given value, which may be a slog.Value.
+func (h *RedactingHandler) redacted(key string, value any) slog.Attr {
+	if !h.opts.hash {
+		return slog.String(key, RedactedValue)
+	}
+
+	return slog.String(key, redactedHash(value))
+}
+
+// redactedHash returns a short hash of the given value.
+func redactedHash(value any) string {
+	var s string
+	switch v := value.(type) {
+	case slog.Value:
+		if v.Kind() == slog.KindAny {
+			return redactedHash(v.Any())
+		}
+		s = v.String()
+	case []byte:
+		s = hex.EncodeToString(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	sum := sha256.Sum256([]byte(s))
+
+	return redactedHashPrefix + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,114 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// macaroon is a type used to test redaction by type.
+type macaroon struct {
+	id string
+}
+
+// TestRedactingHandler tests that the RedactingHandler redacts attributes by
+// key, type, predicate and the Secret wrapper.
+func TestRedactingHandler(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	handler := NewRedactingHandler(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithRedactedKeys("*seed*", "peer.key", "preimage"),
+		WithRedactedTypes(&macaroon{}),
+		WithRedactFunc(func(groups []string, a slog.Attr) bool {
+			return strings.HasPrefix(a.Value.String(), "xprv")
+		}),
+	)
+	log := NewSLogger(handler)
+	ctx := context.Background()
+
+	log.InfoS(ctx, "Keys", "wallet_seed", "abandon", "SEED", "abandon",
+		"height", 5)
+	log.InfoS(ctx, "Groups", slog.Group("peer", "key", "secret",
+		"addr", "127.0.0.1"), "key", "not secret")
+	log.InfoS(ctx, "Types", "mac", &macaroon{id: "secret"},
+		"other", macaroon{id: "not secret"})
+	log.InfoS(ctx, "Predicate", "ext_key", "xprv9s21ZrQH143K")
+	log.InfoS(ctx, "Hex", Hex("preimage", []byte{0x01, 0x02}))
+	log.InfoS(ctx, "Secret", "pw", NewSecret("hunter2"))
+
+	ctx = WithCtx(ctx, "seed", "abandon")
+	log.InfoS(ctx, "Context")
+
+	grouped := handler.WithGroup("peer").WithAttrs([]slog.Attr{
+		slog.String("key", "secret"),
+	})
+	slog.New(grouped).Info("WithAttrs", "key", "secret")
+
+	// A Secret should also never be written by a formatted log call or by
+	// a handler that does no redaction.
+	log.Infof("Formatted %v %s %#v", NewSecret("a"), NewSecret("b"),
+		NewSecret("c"))
+	slog.New(NewDefaultHandler(&buf, WithNoTimestamp())).Info("Plain",
+		"pw", NewSecret("hunter2"))
+
+	expectedLog := `[INF]: Keys wallet_seed=[REDACTED] SEED=[REDACTED] height=5
+[INF]: Groups peer.key=[REDACTED] peer.addr=127.0.0.1 key="not secret"
+[INF]: Types mac=[REDACTED] other="{id:not secret}"
+[INF]: Predicate ext_key=[REDACTED]
+[INF]: Hex preimage=[REDACTED]
+[INF]: Secret pw=[REDACTED]
+[INF]: Context seed=[REDACTED]
+[INF]: WithAttrs peer.key=[REDACTED] peer.key=[REDACTED]
+[INF]: Formatted [REDACTED] [REDACTED] btclog.Secret([REDACTED])
+[INF]: Plain pw=[REDACTED]
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+}
+
+// TestRedactingHandlerHash tests that redacted values can be replaced with a
+// short hash which is the same for equal values.
+func TestRedactingHandlerHash(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	log := NewSLogger(NewRedactingHandler(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithRedactedKeys("preimage"), WithRedactHash(),
+	))
+	ctx := context.Background()
+
+	preimage := []byte{0x01, 0x02}
+	log.InfoS(ctx, "Hex", Hex("preimage", preimage))
+	log.InfoS(ctx, "Secret", "p", NewSecret(preimage))
+	log.InfoS(ctx, "Other", "preimage", "0103")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+
+	hash := redactedHash("0102")
+	expected := []string{
+		fmt.Sprintf("[INF]: Hex preimage=%s", hash),
+		fmt.Sprintf("[INF]: Secret p=%s", hash),
+	}
+	for i, exp := range expected {
+		if lines[i] != exp {
+			t.Fatalf("Expected %q, got %q", exp, lines[i])
+		}
+	}
+
+	if strings.Contains(lines[2], hash) ||
+		!strings.Contains(lines[2], redactedHashPrefix) {
+
+		t.Fatalf("Expected a different hash, got %q", lines[2])
+	}
+}
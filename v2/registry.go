@@ -0,0 +1,480 @@
+package btclog
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btclog"
+)
+
+var (
+	// ErrUnknownSubSystem is returned when a level is set for a subsystem
+	// that has not been registered.
+	ErrUnknownSubSystem = errors.New("unknown subsystem")
+
+	// ErrInvalidLevel is returned when a level string can't be parsed.
+	ErrInvalidLevel = errors.New("invalid log level")
+
+	// ErrInvalidLevelSpec is returned when a level spec is malformed.
+	ErrInvalidLevelSpec = errors.New("invalid log level spec")
+)
+
+// SubSystemLevel pairs a subsystem tag with a logging level.
+type SubSystemLevel struct {
+	// Tag is the subsystem tag.
+	Tag string
+
+	// Level is the logging level of the subsystem.
+	Level btclog.Level
+}
+
+// LevelSpec is the parsed form of a level spec string such as
+// "info,PEER=debug,SRVR=trace".
+type LevelSpec struct {
+	// Global is the level that applies to all subsystems. It is only
+	// valid if HasGlobal is true.
+	Global btclog.Level
+
+	// HasGlobal is true if the spec contained a level without a subsystem
+	// tag.
+	HasGlobal bool
+
+	// SubSystems holds the per-subsystem levels in the order in which they
+	// appeared in the spec.
+	SubSystems []SubSystemLevel
+}
+
+// ParseLevelSpec parses a level spec string. The spec is a comma separated
+// list of elements where each element is either a bare level, which applies to
+// all subsystems, or a "TAG=level" pair which applies to a single subsystem.
+// The tag of a pair may also be a glob pattern with the syntax of path.Match,
+// in which case the pair applies to all matching subsystems. At most one bare
+// level may be given. Levels are parsed with LevelFromString.
+//
+// Example specs:
+//
+//	debug
+//	PEER=trace,SRVR=debug
+//	info,PEER=debug
+//	info,HSWC.*=trace
+func ParseLevelSpec(spec string) (*LevelSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("%w: empty spec", ErrInvalidLevelSpec)
+	}
+
+	var ls LevelSpec
+	for _, elem := range strings.Split(spec, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			return nil, fmt.Errorf("%w: empty element in %q",
+				ErrInvalidLevelSpec, spec)
+		}
+
+		tag, lvlStr, isPair := strings.Cut(elem, "=")
+		if !isPair {
+			if ls.HasGlobal {
+				return nil, fmt.Errorf("%w: more than one "+
+					"global level in %q",
+					ErrInvalidLevelSpec, spec)
+			}
+
+			lvl, ok := LevelFromString(elem)
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidLevel,
+					elem)
+			}
+
+			ls.Global = lvl
+			ls.HasGlobal = true
+
+			continue
+		}
+
+		tag = strings.TrimSpace(tag)
+		lvlStr = strings.TrimSpace(lvlStr)
+		if tag == "" || strings.Contains(lvlStr, "=") {
+			return nil, fmt.Errorf("%w: malformed element %q",
+				ErrInvalidLevelSpec, elem)
+		}
+		if _, err := path.Match(tag, ""); err != nil {
+			return nil, fmt.Errorf("%w: malformed pattern %q",
+				ErrInvalidLevelSpec, tag)
+		}
+
+		lvl, ok := LevelFromString(lvlStr)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q for subsystem %s",
+				ErrInvalidLevel, lvlStr, tag)
+		}
+
+		ls.SubSystems = append(ls.SubSystems, SubSystemLevel{
+			Tag:   tag,
+			Level: lvl,
+		})
+	}
+
+	return &ls, nil
+}
+
+// Registry keeps track of the subsystem loggers of an application by tag so
+// that their levels can be listed and changed in one place. Loggers are
+// created lazily using the function that the Registry was constructed with,
+// which allows both v1 Backends and v2 Handlers to be used.
+//
+// Levels can also be set with glob patterns, such as "PEER.*", which is useful
+// for hierarchical subsystems. A pattern applies to the matching subsystems
+// that exist when it is set and to those that are created later, until a level
+// is set for all subsystems.
+//
+// If the Registry was created from a Handler with hierarchical subsystems, see
+// WithHierarchicalSubSystems, the logger of a nested subsystem such as
+// "PEER.CONN" is created from that of its parent, "PEER", which is created
+// first if required. The new logger then inherits the level of its parent
+// unless a pattern gives it a different level.
+type Registry[L btclog.Logger] struct {
+	newLogger func(tag string) L
+
+	// subSystem creates the logger of a nested subsystem from the logger
+	// of its parent if the loggers have hierarchical subsystems.
+	subSystem func(parent L, tag string) L
+
+	mu      sync.RWMutex
+	loggers map[string]L
+
+	// defaultLevel is the level that newly created loggers are set to.
+	defaultLevel btclog.Level
+
+	// rules holds the levels that were set by pattern, in the order in
+	// which they were set, so that they can be applied to newly created
+	// loggers.
+	rules []SubSystemLevel
+}
+
+// NewRegistry creates a new Registry that uses the given function to create
+// the logger for a subsystem the first time it is requested.
+func NewRegistry[L btclog.Logger](newLogger func(tag string) L) *Registry[L] {
+	return &Registry[L]{
+		newLogger:    newLogger,
+		loggers:      make(map[string]L),
+		defaultLevel: LevelInfo,
+	}
+}
+
+// NewBackendRegistry creates a new Registry whose loggers are created with the
+// given v1 Backend, which may be one created by NewBridgeBackend.
+func NewBackendRegistry(b *btclog.Backend) *Registry[btclog.Logger] {
+	return NewRegistry(b.Logger)
+}
+
+// NewHandlerRegistry creates a new Registry whose loggers are structured
+// loggers created from SubSystem handlers of the given Handler. If the handler
+// has hierarchical subsystems, the loggers of nested subsystems are created
+// from the loggers of their parents.
+func NewHandlerRegistry(h Handler) *Registry[Logger] {
+	r := NewRegistry(func(tag string) Logger {
+		return NewSLogger(h.SubSystem(tag))
+	})
+	if isHierarchical(h) {
+		r.subSystem = func(parent Logger, tag string) Logger {
+			return parent.SubSystem(tag)
+		}
+	}
+
+	return r
+}
+
+// Logger returns the logger for the given subsystem tag, creating it if it does
+// not exist yet. A newly created logger is set to the level of the last
+// pattern that matches its tag, if any, or otherwise to the level most
+// recently applied to all subsystems, or LevelInfo if there was none. The
+// logger of a nested subsystem that is created from that of its parent keeps
+// inheriting the parent's level if that is the level it would be set to.
+func (r *Registry[L]) Logger(tag string) L {
+	r.mu.RLock()
+	l, ok := r.loggers[tag]
+	r.mu.RUnlock()
+	if ok {
+		return l
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.logger(tag)
+}
+
+// logger returns the logger for the given subsystem tag, creating it and, for
+// hierarchical loggers, its ancestors if they don't exist yet.
+//
+// NOTE: the caller must hold the mutex for writes.
+func (r *Registry[L]) logger(tag string) L {
+	if l, ok := r.loggers[tag]; ok {
+		return l
+	}
+
+	level := r.defaultLevel
+	for _, rule := range r.rules {
+		if matchTag(rule.Tag, tag) {
+			level = rule.Level
+		}
+	}
+
+	var l L
+	parentTag, nested := r.parentTag(tag)
+	if nested {
+		parent := r.logger(parentTag)
+		l = r.subSystem(parent, tag[len(parentTag)+1:])
+	} else {
+		l = r.newLogger(tag)
+	}
+
+	// A level registered with RegisterLevel can only have been checked
+	// against the loggers that existed when it was set, so a new logger
+	// that doesn't support it uses the closest built-in level instead.
+	if checkLevel(tag, l, level) != nil {
+		level = builtinLevel(SlogLevel(level))
+	}
+
+	// Only set the level of a nested logger if it differs from the one it
+	// inherits, so that it follows later changes to the level of its
+	// parent.
+	if !nested || l.Level() != level {
+		l.SetLevel(level)
+	}
+	r.loggers[tag] = l
+
+	return l
+}
+
+// parentTag returns the tag of the subsystem that the logger of the given
+// subsystem is created from, and false if it is not created from another
+// logger.
+func (r *Registry[L]) parentTag(tag string) (string, bool) {
+	i := strings.LastIndex(tag, SubSystemSeparator)
+	if r.subSystem == nil || i <= 0 || i == len(tag)-1 {
+		return "", false
+	}
+
+	return tag[:i], true
+}
+
+// Get returns the logger for the given subsystem tag if it has been created.
+func (r *Registry[L]) Get(tag string) (L, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	l, ok := r.loggers[tag]
+
+	return l, ok
+}
+
+// SubSystems returns the sorted tags of all registered subsystems.
+func (r *Registry[L]) SubSystems() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.subSystems()
+}
+
+// subSystems returns the sorted tags of all registered subsystems.
+//
+// NOTE: the caller must hold the mutex.
+func (r *Registry[L]) subSystems() []string {
+	tags := make([]string, 0, len(r.loggers))
+	for tag := range r.loggers {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	return tags
+}
+
+// Levels returns the current level of each registered subsystem, sorted by
+// tag.
+func (r *Registry[L]) Levels() []SubSystemLevel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	levels := make([]SubSystemLevel, 0, len(r.loggers))
+	for _, tag := range r.subSystems() {
+		levels = append(levels, SubSystemLevel{
+			Tag:   tag,
+			Level: r.loggers[tag].Level(),
+		})
+	}
+
+	return levels
+}
+
+// SetLevel sets the level of a single registered subsystem. An error wrapping
+// ErrUnknownSubSystem is returned if the subsystem does not exist. If the tag
+// is a glob pattern, the level is set for all matching subsystems, including
+// those created later, and an error wrapping ErrInvalidLevelSpec is returned
+// if the pattern is malformed. An error wrapping ErrInvalidLevel is returned,
+// and no level is changed, if the level was registered with RegisterLevel and
+// one of the subsystems is not a logger of this package.
+func (r *Registry[L]) SetLevel(tag string, level btclog.Level) error {
+	if isTagPattern(tag) {
+		if _, err := path.Match(tag, ""); err != nil {
+			return fmt.Errorf("%w: malformed pattern %q",
+				ErrInvalidLevelSpec, tag)
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if err := r.checkLevel(tag, level); err != nil {
+			return err
+		}
+		r.setPatternLevel(tag, level)
+
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	l, ok := r.loggers[tag]
+	if !ok {
+		return r.unknownSubSystemErr(tag)
+	}
+	if err := checkLevel(tag, l, level); err != nil {
+		return err
+	}
+	l.SetLevel(level)
+
+	return nil
+}
+
+// SetLevels sets the level of all registered subsystems along with that of
+// any subsystems created later. Nested subsystems of a Registry with
+// hierarchical subsystems inherit the level from their parents again. An error wrapping ErrInvalidLevel is returned,
+// and no level is changed, if the level was registered with RegisterLevel and
+// one of the subsystems is not a logger of this package.
+func (r *Registry[L]) SetLevels(level btclog.Level) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkLevel("", level); err != nil {
+		return err
+	}
+
+	r.setAllLevels(level)
+
+	return nil
+}
+
+// setAllLevels sets the level of all subsystems along with that of any
+// subsystems created later. The loggers of nested subsystems that are created
+// from their parents inherit the level of their parents again, rather than
+// having it set, so that they follow later changes to their parents' levels.
+//
+// NOTE: the caller must hold the mutex for writes.
+func (r *Registry[L]) setAllLevels(level btclog.Level) {
+	r.defaultLevel = level
+	r.rules = nil
+	for tag, l := range r.loggers {
+		li, ok := any(l).(levelInheritor)
+		if _, nested := r.parentTag(tag); nested && ok {
+			li.resetLevel()
+			continue
+		}
+
+		l.SetLevel(level)
+	}
+}
+
+// checkLevel returns an error if the given level can't be set for one of the
+// subsystems that match the given pattern, or for one of all subsystems if the
+// pattern is empty.
+//
+// NOTE: the caller must hold the mutex.
+func (r *Registry[L]) checkLevel(pattern string, level btclog.Level) error {
+	for _, tag := range r.subSystems() {
+		if pattern != "" && !matchTag(pattern, tag) {
+			continue
+		}
+		if err := checkLevel(tag, r.loggers[tag], level); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setPatternLevel sets the level of all subsystems that match the given
+// pattern and records it for subsystems created later.
+//
+// NOTE: the caller must hold the mutex.
+func (r *Registry[L]) setPatternLevel(pattern string, level btclog.Level) {
+	r.rules = append(r.rules, SubSystemLevel{Tag: pattern, Level: level})
+	for tag, l := range r.loggers {
+		if matchTag(pattern, tag) {
+			l.SetLevel(level)
+		}
+	}
+}
+
+// ApplyLevelSpec parses the given level spec with ParseLevelSpec and applies
+// it. Any global level is applied first, followed by the per-subsystem levels
+// in order, so a later element overrides an earlier pattern. A pattern that
+// matches no subsystem is not an error since it also applies to subsystems
+// created later. The spec is validated in full before any level is changed, so
+// an error wrapping ErrUnknownSubSystem, ErrInvalidLevel or
+// ErrInvalidLevelSpec means that no levels were changed. Levels registered with
+// RegisterLevel are invalid for subsystems that are not loggers of this
+// package.
+func (r *Registry[L]) ApplyLevelSpec(spec string) error {
+	ls, err := ParseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sl := range ls.SubSystems {
+		if !isTagPattern(sl.Tag) {
+			if _, ok := r.loggers[sl.Tag]; !ok {
+				return r.unknownSubSystemErr(sl.Tag)
+			}
+		}
+		if err := r.checkLevel(sl.Tag, sl.Level); err != nil {
+			return err
+		}
+	}
+	if ls.HasGlobal {
+		if err := r.checkLevel("", ls.Global); err != nil {
+			return err
+		}
+	}
+
+	if ls.HasGlobal {
+		r.setAllLevels(ls.Global)
+	}
+
+	for _, sl := range ls.SubSystems {
+		if isTagPattern(sl.Tag) {
+			r.setPatternLevel(sl.Tag, sl.Level)
+			continue
+		}
+
+		r.loggers[sl.Tag].SetLevel(sl.Level)
+	}
+
+	return nil
+}
+
+// unknownSubSystemErr returns an error for the given unknown subsystem tag
+// which lists the supported subsystems.
+//
+// NOTE: the caller must hold the mutex.
+func (r *Registry[L]) unknownSubSystemErr(tag string) error {
+	return fmt.Errorf("%w %q, supported subsystems: %s",
+		ErrUnknownSubSystem, tag, strings.Join(r.subSystems(), ", "))
+}
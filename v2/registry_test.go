@@ -0,0 +1,384 @@
+package btclog
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btclog"
+)
+
+// TestParseLevelSpec tests that level specs are parsed correctly and that
+// malformed specs are rejected with a descriptive error.
+func TestParseLevelSpec(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		spec        string
+		expected    *LevelSpec
+		expectedErr error
+	}{
+		{
+			name: "global only",
+			spec: "debug",
+			expected: &LevelSpec{
+				Global:    LevelDebug,
+				HasGlobal: true,
+			},
+		},
+		{
+			name: "global and subsystems",
+			spec: "info, PEER=debug,SRVR=TRC",
+			expected: &LevelSpec{
+				Global:    LevelInfo,
+				HasGlobal: true,
+				SubSystems: []SubSystemLevel{
+					{Tag: "PEER", Level: LevelDebug},
+					{Tag: "SRVR", Level: LevelTrace},
+				},
+			},
+		},
+		{
+			name: "subsystems only",
+			spec: "PEER=off",
+			expected: &LevelSpec{
+				SubSystems: []SubSystemLevel{
+					{Tag: "PEER", Level: LevelOff},
+				},
+			},
+		},
+		{
+			name: "pattern",
+			spec: "info,HSWC.*=trace",
+			expected: &LevelSpec{
+				Global:    LevelInfo,
+				HasGlobal: true,
+				SubSystems: []SubSystemLevel{
+					{Tag: "HSWC.*", Level: LevelTrace},
+				},
+			},
+		},
+		{
+			name:        "malformed pattern",
+			spec:        "HSWC[=trace",
+			expectedErr: ErrInvalidLevelSpec,
+		},
+		{
+			name:        "empty",
+			spec:        " ",
+			expectedErr: ErrInvalidLevelSpec,
+		},
+		{
+			name:        "empty element",
+			spec:        "info,,PEER=debug",
+			expectedErr: ErrInvalidLevelSpec,
+		},
+		{
+			name:        "two global levels",
+			spec:        "info,debug",
+			expectedErr: ErrInvalidLevelSpec,
+		},
+		{
+			name:        "missing tag",
+			spec:        "=debug",
+			expectedErr: ErrInvalidLevelSpec,
+		},
+		{
+			name:        "bad global level",
+			spec:        "verbose",
+			expectedErr: ErrInvalidLevel,
+		},
+		{
+			name:        "bad subsystem level",
+			spec:        "PEER=verbose",
+			expectedErr: ErrInvalidLevel,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ls, err := ParseLevelSpec(test.spec)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("Expected error %v, got %v",
+					test.expectedErr, err)
+			}
+
+			if !reflect.DeepEqual(ls, test.expected) {
+				t.Fatalf("Expected spec %+v, got %+v",
+					test.expected, ls)
+			}
+		})
+	}
+}
+
+// TestRegistry tests that a Registry backed by a v2 Handler creates, tracks
+// and updates subsystem loggers.
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	reg := NewHandlerRegistry(NewDefaultHandler(&buf, WithNoTimestamp()))
+
+	peerLog := reg.Logger("PEER")
+	srvrLog := reg.Logger("SRVR")
+
+	if reg.Logger("PEER") != peerLog {
+		t.Fatalf("Expected the same logger to be returned")
+	}
+	if _, ok := reg.Get("AMGR"); ok {
+		t.Fatalf("Expected AMGR to not be registered")
+	}
+
+	err := reg.ApplyLevelSpec("debug,PEER=trace")
+	if err != nil {
+		t.Fatalf("Unable to apply level spec: %v", err)
+	}
+
+	expectedLevels := []SubSystemLevel{
+		{Tag: "PEER", Level: LevelTrace},
+		{Tag: "SRVR", Level: LevelDebug},
+	}
+	if levels := reg.Levels(); !reflect.DeepEqual(levels, expectedLevels) {
+		t.Fatalf("Expected levels %v, got %v", expectedLevels, levels)
+	}
+
+	// Subsystems created after a global level was applied should use
+	// that level.
+	if amgrLog := reg.Logger("AMGR"); amgrLog.Level() != LevelDebug {
+		t.Fatalf("Expected new logger to have level debug, got %s",
+			amgrLog.Level())
+	}
+
+	peerLog.Trace("Peer trace")
+	srvrLog.Trace("Server trace")
+	srvrLog.Debug("Server debug")
+
+	expectedLog := `[TRC] PEER: Peer trace
+[DBG] SRVR: Server debug
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+
+	// An unknown subsystem should result in an error and no levels should
+	// be changed.
+	err = reg.ApplyLevelSpec("info,FOO=debug")
+	if !errors.Is(err, ErrUnknownSubSystem) {
+		t.Fatalf("Expected ErrUnknownSubSystem, got %v", err)
+	}
+	if peerLog.Level() != LevelTrace {
+		t.Fatalf("Expected PEER level to be unchanged, got %s",
+			peerLog.Level())
+	}
+
+	err = reg.SetLevel("FOO", LevelDebug)
+	if !errors.Is(err, ErrUnknownSubSystem) {
+		t.Fatalf("Expected ErrUnknownSubSystem, got %v", err)
+	}
+
+	if err := reg.SetLevels(LevelWarn); err != nil {
+		t.Fatalf("Unable to set levels: %v", err)
+	}
+	for _, sl := range reg.Levels() {
+		if sl.Level != LevelWarn {
+			t.Fatalf("Expected %s to have level warn, got %s",
+				sl.Tag, sl.Level)
+		}
+	}
+
+	expectedTags := []string{"AMGR", "PEER", "SRVR"}
+	if tags := reg.SubSystems(); !reflect.DeepEqual(tags, expectedTags) {
+		t.Fatalf("Expected subsystems %v, got %v", expectedTags, tags)
+	}
+}
+
+// TestRegistryPatterns tests that the levels of subsystems can be set by glob
+// pattern and that patterns apply to subsystems created later.
+func TestRegistryPatterns(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	reg := NewHandlerRegistry(NewDefaultHandler(&buf, WithNoTimestamp()))
+
+	reg.Logger("HSWC")
+	reg.Logger("HSWC.LINK")
+	reg.Logger("PEER")
+
+	err := reg.ApplyLevelSpec("debug,HSWC.*=trace,HSWC.LINK.*=warn")
+	if err != nil {
+		t.Fatalf("Unable to apply level spec: %v", err)
+	}
+
+	// The last matching pattern applies to subsystems created later.
+	reg.Logger("HSWC.SWITCH")
+	reg.Logger("HSWC.LINK.CHAN")
+	reg.Logger("SRVR")
+
+	expectedLevels := []SubSystemLevel{
+		{Tag: "HSWC", Level: LevelDebug},
+		{Tag: "HSWC.LINK", Level: LevelTrace},
+		{Tag: "HSWC.LINK.CHAN", Level: LevelWarn},
+		{Tag: "HSWC.SWITCH", Level: LevelTrace},
+		{Tag: "PEER", Level: LevelDebug},
+		{Tag: "SRVR", Level: LevelDebug},
+	}
+	if levels := reg.Levels(); !reflect.DeepEqual(levels, expectedLevels) {
+		t.Fatalf("Expected levels %v, got %v", expectedLevels, levels)
+	}
+
+	if err := reg.SetLevel("P*", LevelError); err != nil {
+		t.Fatalf("Unable to set level: %v", err)
+	}
+	if log, _ := reg.Get("PEER"); log.Level() != LevelError {
+		t.Fatalf("Expected PEER to have level error, got %s",
+			log.Level())
+	}
+	err = reg.SetLevel("P[", LevelError)
+	if !errors.Is(err, ErrInvalidLevelSpec) {
+		t.Fatalf("Expected ErrInvalidLevelSpec, got %v", err)
+	}
+
+	// A global level discards all patterns.
+	if err := reg.SetLevels(LevelInfo); err != nil {
+		t.Fatalf("Unable to set levels: %v", err)
+	}
+	if log := reg.Logger("HSWC.NEW"); log.Level() != LevelInfo {
+		t.Fatalf("Expected HSWC.NEW to have level info, got %s",
+			log.Level())
+	}
+}
+
+// TestRegistryHierarchy tests that a Registry backed by a Handler with
+// hierarchical subsystems creates nested loggers from their parents and that
+// they keep inheriting the level of their parent.
+func TestRegistryHierarchy(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	reg := NewHandlerRegistry(NewDefaultHandler(
+		&buf, WithNoTimestamp(), WithHierarchicalSubSystems(),
+	))
+
+	// The parent is created along with the nested subsystem.
+	connLog := reg.Logger("PEER.CONN")
+	peerLog, ok := reg.Get("PEER")
+	if !ok {
+		t.Fatalf("Expected PEER to be registered")
+	}
+
+	peerLog.SetLevel(LevelDebug)
+	if connLog.Level() != LevelDebug {
+		t.Fatalf("Expected PEER.CONN to inherit level debug, got %s",
+			connLog.Level())
+	}
+
+	connLog.Debug("Nested")
+	if buf.String() != "[DBG] PEER.CONN: Nested\n" {
+		t.Fatalf("Unexpected output %q", buf.Bytes())
+	}
+
+	// A pattern that gives a new subsystem a different level than its
+	// parent sets its own level, while one that matches the parent's
+	// level keeps it inheriting.
+	if err := reg.SetLevel("PEER.*", LevelTrace); err != nil {
+		t.Fatalf("Unable to set level: %v", err)
+	}
+	addrLog := reg.Logger("PEER.ADDR")
+	cacheLog := reg.Logger("PEER.ADDR.CACHE")
+	peerLog.SetLevel(LevelWarn)
+
+	if addrLog.Level() != LevelTrace {
+		t.Fatalf("Expected PEER.ADDR to have level trace, got %s",
+			addrLog.Level())
+	}
+	addrLog.SetLevel(LevelError)
+	if cacheLog.Level() != LevelError {
+		t.Fatalf("Expected PEER.ADDR.CACHE to inherit level error, "+
+			"got %s", cacheLog.Level())
+	}
+
+	expectedTags := []string{
+		"PEER", "PEER.ADDR", "PEER.ADDR.CACHE", "PEER.CONN",
+	}
+	if tags := reg.SubSystems(); !reflect.DeepEqual(tags, expectedTags) {
+		t.Fatalf("Expected subsystems %v, got %v", expectedTags, tags)
+	}
+
+	// A global level makes nested subsystems inherit the level of their
+	// parents again, while an explicit level in the same spec is kept.
+	if err := reg.ApplyLevelSpec("info,PEER.ADDR.CACHE=warn"); err != nil {
+		t.Fatalf("Unable to apply level spec: %v", err)
+	}
+	if err := reg.SetLevel("PEER", LevelDebug); err != nil {
+		t.Fatalf("Unable to set level: %v", err)
+	}
+	if connLog.Level() != LevelDebug || addrLog.Level() != LevelDebug {
+		t.Fatalf("Expected PEER.CONN and PEER.ADDR to inherit level "+
+			"debug, got %s and %s", connLog.Level(),
+			addrLog.Level())
+	}
+	if cacheLog.Level() != LevelWarn {
+		t.Fatalf("Expected PEER.ADDR.CACHE to have level warn, got %s",
+			cacheLog.Level())
+	}
+
+	if err := reg.SetLevels(LevelError); err != nil {
+		t.Fatalf("Unable to set levels: %v", err)
+	}
+	peerLog.SetLevel(LevelTrace)
+	if cacheLog.Level() != LevelTrace {
+		t.Fatalf("Expected PEER.ADDR.CACHE to inherit level trace, "+
+			"got %s", cacheLog.Level())
+	}
+}
+
+// TestBackendRegistry tests that a Registry can be backed by a v1 Backend.
+func TestBackendRegistry(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	reg := NewBackendRegistry(btclog.NewBackend(&buf))
+
+	log := reg.Logger("PEER")
+	if err := reg.ApplyLevelSpec("PEER=debug"); err != nil {
+		t.Fatalf("Unable to apply level spec: %v", err)
+	}
+
+	log.Debug("Peer debug")
+	if !bytes.Contains(buf.Bytes(), []byte("[DBG] PEER: Peer debug")) {
+		t.Fatalf("Debug message not found in output: %s", buf.String())
+	}
+
+	// Registered levels are unknown to v1 loggers, so they are rejected
+	// rather than silently turning the loggers off.
+	invalid := []func() error{
+		func() error { return reg.ApplyLevelSpec("PEER=notice") },
+		func() error { return reg.ApplyLevelSpec("notice") },
+		func() error { return reg.ApplyLevelSpec("info,P*=notice") },
+		func() error { return reg.SetLevel("PEER", levelNotice) },
+		func() error { return reg.SetLevels(levelNotice) },
+	}
+	for i, f := range invalid {
+		if err := f(); !errors.Is(err, ErrInvalidLevel) {
+			t.Fatalf("Expected ErrInvalidLevel for case %d, got %v",
+				i, err)
+		}
+		if log.Level() != LevelDebug {
+			t.Fatalf("Expected PEER level to be unchanged, got %s",
+				log.Level())
+		}
+	}
+
+	// A pattern can't be checked against loggers created later, which
+	// use the closest built-in level instead.
+	if err := reg.SetLevel("SRVR*", levelNotice); err != nil {
+		t.Fatalf("Unable to set level: %v", err)
+	}
+	if srvrLog := reg.Logger("SRVR"); srvrLog.Level() != LevelInfo {
+		t.Fatalf("Expected SRVR to have level info, got %s",
+			srvrLog.Level())
+	}
+}
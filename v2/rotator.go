@@ -0,0 +1,543 @@
+package btclog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the layout of the timestamp that is appended to the
+// name of a rotated log file. It sorts lexically and avoids characters that
+// are not allowed in file names on some platforms.
+const rotatedTimeFormat = "2006-01-02T15-04-05.000"
+
+// compressSuffix is the file extension added to compressed rotated log files.
+const compressSuffix = ".gz"
+
+// RotatorOption is the signature of a functional option that can be used to
+// modify the behaviour of a RotatingFile.
+type RotatorOption func(*rotatorOpts)
+
+// rotatorOpts holds options that can be modified by a RotatorOption.
+type rotatorOpts struct {
+	// maxSize is the size in bytes after which the file is rotated. Zero
+	// disables size based rotation.
+	maxSize int64
+
+	// interval is the time after which the file is rotated. Zero disables
+	// time based rotation.
+	interval time.Duration
+
+	// maxFiles is the number of rotated files to keep. Zero keeps all
+	// rotated files.
+	maxFiles int
+
+	// compress defines whether rotated files should be gzip compressed.
+	compress bool
+
+	// timeSource is used to obtain the current time.
+	timeSource func() time.Time
+}
+
+// defaultRotatorOpts constructs a rotatorOpts with default settings.
+func defaultRotatorOpts() *rotatorOpts {
+	return &rotatorOpts{
+		timeSource: time.Now,
+	}
+}
+
+// WithMaxSize sets the size in bytes after which the log file is rotated.
+func WithMaxSize(size int64) RotatorOption {
+	return func(opts *rotatorOpts) {
+		opts.maxSize = size
+	}
+}
+
+// WithRotationInterval sets the duration after which the log file is rotated,
+// measured from when the file was opened.
+func WithRotationInterval(interval time.Duration) RotatorOption {
+	return func(opts *rotatorOpts) {
+		opts.interval = interval
+	}
+}
+
+// WithMaxFiles sets the number of rotated log files to keep. The oldest files
+// are deleted once there are more than this number.
+func WithMaxFiles(n int) RotatorOption {
+	return func(opts *rotatorOpts) {
+		opts.maxFiles = n
+	}
+}
+
+// WithCompression causes rotated log files to be gzip compressed in the
+// background.
+func WithCompression() RotatorOption {
+	return func(opts *rotatorOpts) {
+		opts.compress = true
+	}
+}
+
+// WithRotatorTimeSource can be used to overwrite the time source used to name
+// rotated files and to determine when the rotation interval has passed.
+func WithRotatorTimeSource(fn func() time.Time) RotatorOption {
+	return func(opts *rotatorOpts) {
+		opts.timeSource = fn
+	}
+}
+
+// RotatingFile is an io.WriteCloser that writes to a log file and rotates it
+// once it grows beyond a maximum size and/or after a fixed interval. Rotated
+// files are renamed by appending a timestamp to the file name, e.g.
+// "btcd.log.2009-01-03T12-00-00.000", and may optionally be compressed.
+//
+// Each call to Write is treated as a single log record which is never split
+// across files. Both the v1 Backend and the v2 handlers write each record with
+// a single call to Write so a RotatingFile is safe to share between them. If
+// the file is written to by a HashChainWriter, a checkpoint of the chain is
+// written to the end of each file before it is rotated or closed and to the
+// start of each new file, so that each file can be verified on its own.
+type RotatingFile struct {
+	path string
+	opts *rotatorOpts
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// empty is true while the current file holds no records. Checkpoints
+	// of a hash chain don't count as records.
+	empty bool
+
+	// closed is set once Close has been called. The file may also be nil
+	// if it couldn't be reopened after a rotation, in which case opening it
+	// is retried on the next write.
+	closed bool
+
+	// pruneMu serialises the pruning of old files which may happen from
+	// background compression goroutines.
+	pruneMu sync.Mutex
+
+	// wg tracks background compression goroutines.
+	wg sync.WaitGroup
+
+	// bgErr holds the first error encountered by a background goroutine.
+	bgErrMu sync.Mutex
+	bgErr   error
+
+	// checkpoint returns the checkpoint line of the HashChainWriter that
+	// writes to the file, if any, which is written to the end of each file
+	// before it is closed and to the start of each new file.
+	checkpoint func() []byte
+}
+
+// A compile-time check to ensure that RotatingFile implements io.WriteCloser.
+var _ io.WriteCloser = (*RotatingFile)(nil)
+
+// A compile-time check to ensure that RotatingFile implements chainedWriter.
+var _ chainedWriter = (*RotatingFile)(nil)
+
+// NewRotatingFile opens the log file at the given path for appending, creating
+// it and any parent directories if they don't exist.
+func NewRotatingFile(path string, options ...RotatorOption) (*RotatingFile,
+	error) {
+
+	opts := defaultRotatorOpts()
+	for _, o := range options {
+		o(opts)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	r := &RotatingFile{
+		path: path,
+		opts: opts,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Write writes a single log record to the current file, rotating the file
+// first if required.
+//
+// NOTE: this is part of the io.Writer interface.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	return r.writeCommit(p, nil)
+}
+
+// writeCommit writes a single log record to the current file, rotating the file
+// first if required, and calls commit, if set, once the record was written.
+//
+// NOTE: this is part of the chainedWriter interface.
+func (r *RotatingFile) writeCommit(p []byte, commit func()) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.ensureOpen(); err != nil {
+		return 0, err
+	}
+
+	if r.shouldRotate(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if n > 0 {
+		r.empty = false
+	}
+	if err == nil && commit != nil {
+		commit()
+	}
+
+	return n, err
+}
+
+// setCheckpointer sets the function that returns the checkpoint line of the
+// HashChainWriter that writes to the file.
+//
+// NOTE: this is part of the chainedWriter interface.
+func (r *RotatingFile) setCheckpointer(fn func() []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checkpoint = fn
+}
+
+// Rotate forces the current file to be rotated.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.ensureOpen(); err != nil {
+		return err
+	}
+
+	return r.rotate()
+}
+
+// Close closes the current file and waits for any background compression to
+// complete. The first error encountered during background compression, if
+// any, is returned.
+//
+// NOTE: this is part of the io.Closer interface.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	r.closed = true
+	if r.file != nil {
+		err = r.writeCheckpoint()
+		if closeErr := r.file.Close(); err == nil {
+			err = closeErr
+		}
+		r.file = nil
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	r.bgErrMu.Lock()
+	defer r.bgErrMu.Unlock()
+	if err == nil {
+		err = r.bgErr
+	}
+
+	return err
+}
+
+// open opens the log file for appending.
+//
+// NOTE: the caller must hold the mutex.
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(
+		r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600,
+	)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.empty = r.size == 0
+	r.openedAt = r.opts.timeSource()
+
+	return r.writeCheckpoint()
+}
+
+// writeCheckpoint writes a checkpoint of the hash chain that is written to the
+// file, if any, to the current file.
+//
+// NOTE: the caller must hold the mutex.
+func (r *RotatingFile) writeCheckpoint() error {
+	if r.checkpoint == nil {
+		return nil
+	}
+
+	line := r.checkpoint()
+	if line == nil {
+		return nil
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+
+	return err
+}
+
+// ensureOpen returns os.ErrClosed if the RotatingFile has been closed and
+// otherwise opens the log file if it isn't open, which is the case if opening
+// it failed during the last rotation.
+//
+// NOTE: the caller must hold the mutex.
+func (r *RotatingFile) ensureOpen() error {
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file != nil {
+		return nil
+	}
+
+	return r.open()
+}
+
+// shouldRotate returns true if the current file should be rotated before a
+// record of n bytes is written to it. A file is never rotated while it holds no
+// records, so that a record larger than the maximum size is still written and
+// no empty files, or files that only hold the checkpoint of a hash chain, are
+// rotated if nothing was logged during an interval. The interval of such a
+// file is restarted instead.
+//
+// NOTE: the caller must hold the mutex.
+func (r *RotatingFile) shouldRotate(n int) bool {
+	if r.opts.maxSize > 0 && !r.empty &&
+		r.size+int64(n) > r.opts.maxSize {
+
+		return true
+	}
+
+	if r.opts.interval <= 0 {
+		return false
+	}
+
+	now := r.opts.timeSource()
+	if now.Sub(r.openedAt) < r.opts.interval {
+		return false
+	}
+	if r.empty {
+		r.openedAt = now
+		return false
+	}
+
+	return true
+}
+
+// rotate closes the current file, renames it and opens a new one in its place.
+// If any of these steps fail, the file is left closed and is reopened by the
+// next write.
+//
+// NOTE: the caller must hold the mutex.
+func (r *RotatingFile) rotate() error {
+	if err := r.writeCheckpoint(); err != nil {
+		return err
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return err
+	}
+
+	rotated, err := r.rotatedName()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, rotated); err != nil {
+		return err
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		if r.opts.compress {
+			if err := compressFile(rotated); err != nil {
+				r.setBgErr(err)
+			}
+		}
+
+		if err := r.prune(); err != nil {
+			r.setBgErr(err)
+		}
+	}()
+
+	return r.open()
+}
+
+// rotatedName returns an unused name for the current file once rotated.
+//
+// NOTE: the caller must hold the mutex.
+func (r *RotatingFile) rotatedName() (string, error) {
+	base := r.path + "." + r.opts.timeSource().Format(rotatedTimeFormat)
+
+	name := base
+	for i := 1; ; i++ {
+		_, err := os.Stat(name)
+		if errors.Is(err, os.ErrNotExist) {
+			_, err = os.Stat(name + compressSuffix)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// prune deletes the oldest rotated files so that at most maxFiles remain.
+func (r *RotatingFile) prune() error {
+	if r.opts.maxFiles <= 0 {
+		return nil
+	}
+
+	r.pruneMu.Lock()
+	defer r.pruneMu.Unlock()
+
+	matches, err := filepath.Glob(escapeGlob(r.path) + ".*")
+	if err != nil {
+		return err
+	}
+
+	// Group the files by their rotated name without the compression
+	// suffix so that a file that is in the middle of being compressed is
+	// only counted once.
+	files := make(map[string][]string)
+	for _, match := range matches {
+		name := strings.TrimSuffix(match, compressSuffix)
+		stamp := strings.TrimPrefix(name, r.path+".")
+		if len(stamp) < len(rotatedTimeFormat) {
+			continue
+		}
+		_, err := time.Parse(
+			rotatedTimeFormat, stamp[:len(rotatedTimeFormat)],
+		)
+		if err != nil {
+			continue
+		}
+
+		files[name] = append(files[name], match)
+	}
+
+	if len(files) <= r.opts.maxFiles {
+		return nil
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names[:len(names)-r.opts.maxFiles] {
+		for _, file := range files[name] {
+			err := os.Remove(file)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// escapeGlob escapes the characters of the given path that have a special
+// meaning in the patterns of filepath.Glob. Each is placed in a character class
+// of its own, which works regardless of whether the platform uses backslashes
+// as escape characters or as path separators.
+func escapeGlob(path string) string {
+	var b strings.Builder
+	for _, c := range path {
+		switch {
+		case c == '*' || c == '?' || c == '[':
+			b.WriteByte('[')
+			b.WriteRune(c)
+			b.WriteByte(']')
+
+		case c == '\\' && runtime.GOOS != "windows":
+			b.WriteString(`[\\]`)
+
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+// setBgErr records the given error if no other background error has been
+// recorded yet.
+func (r *RotatingFile) setBgErr(err error) {
+	r.bgErrMu.Lock()
+	defer r.bgErrMu.Unlock()
+
+	if r.bgErr == nil {
+		r.bgErr = err
+	}
+}
+
+// compressFile gzip compresses the file at the given path and removes the
+// original once the compressed file has been written successfully.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(
+		path+compressSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600,
+	)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + compressSuffix)
+		return err
+	}
+
+	src.Close()
+
+	return os.Remove(path)
+}
@@ -0,0 +1,346 @@
+package btclog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// rotatedFiles returns the sorted base names of the rotated files of the log
+// file at the given path.
+func rotatedFiles(t *testing.T, path string) []string {
+	t.Helper()
+
+	matches, err := filepath.Glob(escapeGlob(path) + ".*")
+	if err != nil {
+		t.Fatalf("Unable to list rotated files: %v", err)
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, filepath.Base(match))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// TestRotatingFileSize tests that a RotatingFile is rotated once it reaches the
+// maximum size, that records are never split across files and that only the
+// configured number of old files are kept.
+func TestRotatingFileSize(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now  = timeSource()
+		path = filepath.Join(t.TempDir(), "test.log")
+	)
+	r, err := NewRotatingFile(
+		path, WithMaxSize(10), WithMaxFiles(2),
+		WithRotatorTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create rotating file: %v", err)
+	}
+
+	records := []string{"aaaa\n", "bbbb\n", "cccc\n", "dddddddddddd\n",
+		"eeee\n", "ffff\n"}
+	for _, record := range records {
+		now = now.Add(time.Second)
+		if _, err := r.Write([]byte(record)); err != nil {
+			t.Fatalf("Unable to write: %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+
+	// The records should have been written to the following files, of
+	// which the oldest should have been pruned:
+	//   aaaa bbbb | cccc | dddddddddddd | eeee ffff
+	expectedFiles := []string{
+		"test.log.2009-01-03T12-00-04.000",
+		"test.log.2009-01-03T12-00-05.000",
+	}
+	if files := rotatedFiles(t, path); !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected rotated files %v, got %v", expectedFiles,
+			files)
+	}
+
+	expectedContents := map[string]string{
+		expectedFiles[0]: "cccc\n",
+		expectedFiles[1]: "dddddddddddd\n",
+		"test.log":       "eeee\nffff\n",
+	}
+	for name, expected := range expectedContents {
+		contents, err := os.ReadFile(filepath.Join(filepath.Dir(path),
+			name))
+		if err != nil {
+			t.Fatalf("Unable to read %s: %v", name, err)
+		}
+		if string(contents) != expected {
+			t.Fatalf("Expected %s to contain %q, got %q", name,
+				expected, contents)
+		}
+	}
+}
+
+// TestRotatingFileInterval tests that a RotatingFile is rotated once the
+// rotation interval has passed and that rotated files are compressed.
+func TestRotatingFileInterval(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now  = timeSource()
+		path = filepath.Join(t.TempDir(), "logs", "test.log")
+	)
+	r, err := NewRotatingFile(
+		path, WithRotationInterval(time.Hour), WithCompression(),
+		WithRotatorTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create rotating file: %v", err)
+	}
+
+	write := func(s string) {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatalf("Unable to write: %v", err)
+		}
+	}
+
+	write("first\n")
+	now = now.Add(30 * time.Minute)
+	write("second\n")
+	now = now.Add(30 * time.Minute)
+	write("third\n")
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+	if _, err := r.Write([]byte("closed\n")); err == nil {
+		t.Fatalf("Expected an error when writing to a closed file")
+	}
+
+	expectedFiles := []string{"test.log.2009-01-03T13-00-00.000.gz"}
+	files := rotatedFiles(t, path)
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected rotated files %v, got %v", expectedFiles,
+			files)
+	}
+
+	f, err := os.Open(filepath.Join(filepath.Dir(path), files[0]))
+	if err != nil {
+		t.Fatalf("Unable to open compressed file: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Unable to read compressed file: %v", err)
+	}
+	contents, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Unable to read compressed file: %v", err)
+	}
+	if string(contents) != "first\nsecond\n" {
+		t.Fatalf("Unexpected compressed contents: %q", contents)
+	}
+
+	contents, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read log file: %v", err)
+	}
+	if string(contents) != "third\n" {
+		t.Fatalf("Unexpected log file contents: %q", contents)
+	}
+}
+
+// TestRotatingFileEmptyInterval tests that a file that is still empty once the
+// rotation interval has passed isn't rotated and that its interval restarts.
+func TestRotatingFileEmptyInterval(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now  = timeSource()
+		path = filepath.Join(t.TempDir(), "test.log")
+	)
+	r, err := NewRotatingFile(
+		path, WithRotationInterval(time.Hour),
+		WithRotatorTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create rotating file: %v", err)
+	}
+	defer r.Close()
+
+	write := func(s string) {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatalf("Unable to write: %v", err)
+		}
+	}
+
+	now = now.Add(90 * time.Minute)
+	write("first\n")
+	now = now.Add(30 * time.Minute)
+	write("second\n")
+	if files := rotatedFiles(t, path); len(files) != 0 {
+		t.Fatalf("Expected no rotated files, got %v", files)
+	}
+
+	now = now.Add(30 * time.Minute)
+	write("third\n")
+
+	expectedFiles := []string{"test.log.2009-01-03T14-30-00.000"}
+	if files := rotatedFiles(t, path); !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected rotated files %v, got %v", expectedFiles,
+			files)
+	}
+}
+
+// TestRotatingFileReopen tests that a RotatingFile whose file is left closed by
+// a failed rotation retries opening it on the next write, and that
+// old files are pruned even if the path contains glob metacharacters.
+func TestRotatingFileReopen(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now  = timeSource()
+		path = filepath.Join(t.TempDir(), "logs[1]*", "test.log")
+	)
+	r, err := NewRotatingFile(
+		path, WithMaxSize(10), WithMaxFiles(1),
+		WithRotatorTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create rotating file: %v", err)
+	}
+	defer r.Close()
+
+	write := func(s string) error {
+		now = now.Add(time.Second)
+		_, err := r.Write([]byte(s))
+
+		return err
+	}
+
+	if err := write("aaaaaaaa\n"); err != nil {
+		t.Fatalf("Unable to write: %v", err)
+	}
+
+	// Remove the log directory so that the next rotation fails and leaves
+	// the file closed, and that it can't be reopened until the directory
+	// is restored.
+	dir := filepath.Dir(path)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("Unable to remove log directory: %v", err)
+	}
+	if err := r.Rotate(); err == nil {
+		t.Fatalf("Expected rotation to fail")
+	}
+	if err := write("bbbbbbbb\n"); err == nil {
+		t.Fatalf("Expected write to fail")
+	}
+
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("Unable to create log directory: %v", err)
+	}
+	records := []string{"cccccccc\n", "dddddddd\n", "eeeeeeee\n"}
+	for _, record := range records {
+		if err := write(record); err != nil {
+			t.Fatalf("Unable to write: %v", err)
+		}
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read log file: %v", err)
+	}
+	if string(contents) != "eeeeeeee\n" {
+		t.Fatalf("Unexpected log file contents: %q", contents)
+	}
+
+	// Of the rotated files, only the newest should have been kept once
+	// the background pruning completes.
+	if err := r.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+	expectedFiles := []string{"test.log.2009-01-03T12-00-05.000"}
+	if files := rotatedFiles(t, path); !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected rotated files %v, got %v", expectedFiles,
+			files)
+	}
+}
+
+// TestRotatingFileShared tests that a RotatingFile can be shared between a v1
+// Backend and a v2 handler without any log lines being split or lost.
+func TestRotatingFileShared(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "test.log")
+	r, err := NewRotatingFile(path, WithMaxSize(1024))
+	if err != nil {
+		t.Fatalf("Unable to create rotating file: %v", err)
+	}
+
+	v1Log := btclog.NewBackend(r).Logger("V1")
+	v2Log := NewSLogger(NewDefaultHandler(r)).SubSystem("V2")
+
+	const numLogs = 100
+	var wg sync.WaitGroup
+	for _, log := range []btclog.Logger{v1Log, v2Log} {
+		wg.Add(1)
+		go func(log btclog.Logger) {
+			defer wg.Done()
+
+			for i := 0; i < numLogs; i++ {
+				log.Infof("record %d", i)
+			}
+		}(log)
+	}
+	wg.Wait()
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Unable to close: %v", err)
+	}
+
+	var all bytes.Buffer
+	for _, name := range append(rotatedFiles(t, path), "test.log") {
+		contents, err := os.ReadFile(
+			filepath.Join(filepath.Dir(path), name),
+		)
+		if err != nil {
+			t.Fatalf("Unable to read %s: %v", name, err)
+		}
+		all.Write(contents)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(all.String(), "\n"), "\n")
+	if len(lines) != 2*numLogs {
+		t.Fatalf("Expected %d lines, got %d", 2*numLogs, len(lines))
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "[INF] V1: record ") &&
+			!strings.Contains(line, "[INF] V2: record ") {
+
+			t.Fatalf("Malformed log line: %q", line)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package btclog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// Default settings of a SamplingHandler.
+const (
+	// DefaultSampleFirst is the default number of records per sample key
+	// that are let through in each sampling interval.
+	DefaultSampleFirst = 100
+
+	// DefaultSampleThereafter is the default rate at which records are let
+	// through once DefaultSampleFirst records have been seen within an
+	// interval.
+	DefaultSampleThereafter = 100
+
+	// DefaultSampleInterval is the default sampling interval.
+	DefaultSampleInterval = time.Second
+
+	// DefaultSummaryInterval is the default minimum time between two
+	// summary records.
+	DefaultSummaryInterval = time.Minute
+)
+
+// SamplerOption is the signature of a functional option that can be used to
+// modify the behaviour of a SamplingHandler.
+type SamplerOption func(*samplerOpts)
+
+// samplerOpts holds options that can be modified by a SamplerOption.
+type samplerOpts struct {
+	// rate and burst define the token bucket of each sample key. Token
+	// bucket limiting is disabled if rate is zero.
+	rate  float64
+	burst int
+
+	// first, thereafter and interval define the "first N then every Mth"
+	// sampler of each sample key. It is disabled if interval is zero.
+	first      int
+	thereafter int
+	interval   time.Duration
+
+	// byMessage defines whether records are keyed by their level and
+	// message rather than by their call-site.
+	byMessage bool
+
+	// summaryInterval is the minimum time between two summary records.
+	summaryInterval time.Duration
+
+	// timeSource is used to obtain the current time.
+	timeSource func() time.Time
+}
+
+// defaultSamplerOpts constructs a samplerOpts with default settings.
+func defaultSamplerOpts() *samplerOpts {
+	return &samplerOpts{
+		first:           DefaultSampleFirst,
+		thereafter:      DefaultSampleThereafter,
+		interval:        DefaultSampleInterval,
+		summaryInterval: DefaultSummaryInterval,
+		timeSource:      time.Now,
+	}
+}
+
+// WithRateLimit limits the records of each sample key using a token bucket
+// that holds up to burst tokens and is refilled at rate tokens per second.
+// Each record consumes a single token. This disables the default "first N
+// then every Mth" sampler unless WithSampleFirst is also given.
+func WithRateLimit(rate float64, burst int) SamplerOption {
+	return func(opts *samplerOpts) {
+		opts.rate = rate
+		opts.burst = burst
+		opts.interval = 0
+	}
+}
+
+// WithSampleFirst lets the first records of each sample key through in each
+// interval and, after that, only every thereafter'th record. A thereafter
+// value of zero drops all records after the first ones. This can be combined
+// with WithRateLimit, in which case a record must be allowed by both.
+func WithSampleFirst(first, thereafter int,
+	interval time.Duration) SamplerOption {
+
+	return func(opts *samplerOpts) {
+		opts.first = first
+		opts.thereafter = thereafter
+		opts.interval = interval
+	}
+}
+
+// WithSampleByMessage causes records to be sampled by their level and message
+// rather than by the call-site that produced them.
+func WithSampleByMessage() SamplerOption {
+	return func(opts *samplerOpts) {
+		opts.byMessage = true
+	}
+}
+
+// WithSummaryInterval sets the minimum time between two summary records of a
+// subsystem.
+func WithSummaryInterval(interval time.Duration) SamplerOption {
+	return func(opts *samplerOpts) {
+		opts.summaryInterval = interval
+	}
+}
+
+// WithSamplerTimeSource can be used to overwrite the time source used for
+// sampling and summaries.
+func WithSamplerTimeSource(fn func() time.Time) SamplerOption {
+	return func(opts *samplerOpts) {
+		opts.timeSource = fn
+	}
+}
+
+// sampleKey identifies a group of similar records.
+type sampleKey struct {
+	pc    uintptr
+	level slog.Level
+	msg   string
+}
+
+// sampleEntry holds the sampling state of a single sample key.
+type sampleEntry struct {
+	// tokens is the number of tokens left in the token bucket as of
+	// lastRefill.
+	tokens     float64
+	lastRefill time.Time
+
+	// count is the number of records seen since intervalStart.
+	count         int
+	intervalStart time.Time
+
+	// lastSeen is the time of the most recent record with this key.
+	lastSeen time.Time
+}
+
+// samplerState holds the sampling state of a single subsystem.
+type samplerState struct {
+	mu      sync.Mutex
+	entries map[sampleKey]*sampleEntry
+
+	// pending is the number of records that have been suppressed since the
+	// last summary record and pendingLevel is the highest level among them.
+	pending      uint64
+	pendingLevel slog.Level
+	lastSummary  time.Time
+
+	// suppressed is the total number of records that have been suppressed.
+	suppressed atomic.Uint64
+}
+
+// newSamplerState creates a new samplerState.
+func newSamplerState(now time.Time) *samplerState {
+	return &samplerState{
+		entries:     make(map[sampleKey]*sampleEntry),
+		lastSummary: now,
+	}
+}
+
+// SamplingHandler is a Handler that wraps another Handler and limits the
+// number of similar records that are passed on to it. Records are grouped by
+// the call-site that produced them, as given by their PC, or by their level and
+// message if WithSampleByMessage is used, and each group is limited
+// independently.
+//
+// Suppressed records are counted per subsystem. Once the summary interval has
+// passed, the next record of the subsystem is preceded by a summary record such
+// as "suppressed 4812 similar messages". A summary can also be written at any
+// time with Summarize.
+//
+// Each handler created with SubSystem has its own sampling state, while
+// handlers created with WithPrefix, WithAttrs and WithGroup share the state of
+// their parent.
+type SamplingHandler struct {
+	handler Handler
+	opts    *samplerOpts
+	state   *samplerState
+}
+
+// A compile-time check to ensure that SamplingHandler implements Handler.
+var _ Handler = (*SamplingHandler)(nil)
+
+// NewSamplingHandler creates a new SamplingHandler that wraps the given
+// handler.
+func NewSamplingHandler(handler Handler,
+	options ...SamplerOption) *SamplingHandler {
+
+	opts := defaultSamplerOpts()
+	for _, o := range options {
+		o(opts)
+	}
+
+	return &SamplingHandler{
+		handler: handler,
+		opts:    opts,
+		state:   newSamplerState(opts.timeSource()),
+	}
+}
+
+// Suppressed returns the total number of records of this handler's subsystem
+// that have been suppressed.
+func (s *SamplingHandler) Suppressed() uint64 {
+	return s.state.suppressed.Load()
+}
+
+// Summarize writes a summary record for this handler's subsystem if any
+// records have been suppressed since the last summary.
+func (s *SamplingHandler) Summarize(ctx context.Context) error {
+	now := s.opts.timeSource()
+
+	s.state.mu.Lock()
+	summary, ok := s.takeSummary(now)
+	s.state.mu.Unlock()
+
+	if !ok || !s.handler.Enabled(ctx, summary.Level) {
+		return nil
+	}
+
+	return s.handler.Handle(ctx, summary)
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the Handler interface.
+func (s *SamplingHandler) Level() btclog.Level {
+	return s.handler.Level()
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the Handler interface.
+func (s *SamplingHandler) SetLevel(level btclog.Level) {
+	s.handler.SetLevel(level)
+}
+
+// Enabled reports whether the handler handles records at the given level.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return s.handler.Enabled(ctx, level)
+}
+
+// criticalExits returns the CriticalExits that are run after the wrapped
+// handler has handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (s *SamplingHandler) criticalExits(level slog.Level) []*CriticalExit {
+	return criticalExitsOf(s.handler, level)
+}
+
+// Handle passes the record on to the wrapped handler if it is allowed by the
+// sampler. Records that cause the wrapped handler to exit the process, see
+// WithCriticalExit, are always passed on.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	key := sampleKey{level: r.Level}
+	if s.opts.byMessage {
+		key.msg = r.Message
+	} else {
+		key.pc = r.PC
+	}
+
+	now := s.opts.timeSource()
+
+	s.state.mu.Lock()
+	allowed := s.allow(key, now) || len(s.criticalExits(r.Level)) != 0
+	if !allowed {
+		s.state.pending++
+		if s.state.pending == 1 || r.Level > s.state.pendingLevel {
+			s.state.pendingLevel = r.Level
+		}
+		s.state.suppressed.Add(1)
+	}
+
+	var (
+		summary    slog.Record
+		hasSummary bool
+	)
+	if now.Sub(s.state.lastSummary) >= s.opts.summaryInterval {
+		summary, hasSummary = s.takeSummary(now)
+	}
+	s.state.mu.Unlock()
+
+	if hasSummary && s.handler.Enabled(ctx, summary.Level) {
+		if err := s.handler.Handle(ctx, summary); err != nil {
+			return err
+		}
+	}
+
+	if !allowed {
+		return nil
+	}
+
+	return s.handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new Handler with the given attributes added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return s.with(withAttrs(s.handler, attrs), s.state)
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SamplingHandler) WithGroup(name string) slog.Handler {
+	return s.with(withGroup(s.handler, name), s.state)
+}
+
+// SubSystem returns a copy of the given handler but with the new tag and its
+// own sampling state.
+//
+// NOTE: this is part of the Handler interface.
+func (s *SamplingHandler) SubSystem(tag string) Handler {
+	return s.with(
+		s.handler.SubSystem(tag), newSamplerState(s.opts.timeSource()),
+	)
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message. The new handler shares the sampling state of its
+// parent.
+//
+// NOTE: this is part of the Handler interface.
+func (s *SamplingHandler) WithPrefix(prefix string) Handler {
+	return s.with(s.handler.WithPrefix(prefix), s.state)
+}
+
+// with returns a new SamplingHandler that wraps the given handler.
+func (s *SamplingHandler) with(handler Handler,
+	state *samplerState) *SamplingHandler {
+
+	return &SamplingHandler{
+		handler: handler,
+		opts:    s.opts,
+		state:   state,
+	}
+}
+
+// allow returns true if a record with the given key should be let through.
+//
+// NOTE: the caller must hold the state mutex.
+func (s *SamplingHandler) allow(key sampleKey, now time.Time) bool {
+	entry, ok := s.state.entries[key]
+	if !ok {
+		entry = &sampleEntry{
+			tokens:        float64(s.opts.burst),
+			lastRefill:    now,
+			intervalStart: now,
+		}
+		s.state.entries[key] = entry
+	}
+	entry.lastSeen = now
+
+	allowed := true
+
+	if s.opts.interval > 0 {
+		if now.Sub(entry.intervalStart) >= s.opts.interval {
+			entry.count = 0
+			entry.intervalStart = now
+		}
+		entry.count++
+
+		if entry.count > s.opts.first {
+			allowed = s.opts.thereafter > 0 &&
+				(entry.count-s.opts.first)%s.opts.thereafter == 0
+		}
+	}
+
+	if s.opts.rate > 0 && allowed {
+		elapsed := now.Sub(entry.lastRefill).Seconds()
+		entry.tokens += elapsed * s.opts.rate
+		if entry.tokens > float64(s.opts.burst) {
+			entry.tokens = float64(s.opts.burst)
+		}
+		entry.lastRefill = now
+
+		if entry.tokens >= 1 {
+			entry.tokens--
+		} else {
+			allowed = false
+		}
+	}
+
+	return allowed
+}
+
+// takeSummary returns a summary record of the suppressed records and resets
+// the pending count. False is returned if no records have been suppressed.
+// Sample entries that have not been seen for a whole summary interval are
+// removed to bound the memory used by the sampler.
+//
+// NOTE: the caller must hold the state mutex.
+func (s *SamplingHandler) takeSummary(now time.Time) (slog.Record, bool) {
+	for key, entry := range s.state.entries {
+		if now.Sub(entry.lastSeen) >= s.opts.summaryInterval {
+			delete(s.state.entries, key)
+		}
+	}
+
+	s.state.lastSummary = now
+	if s.state.pending == 0 {
+		return slog.Record{}, false
+	}
+
+	msg := fmt.Sprintf("suppressed %d similar messages", s.state.pending)
+	summary := slog.NewRecord(now, s.state.pendingLevel, msg, 0)
+	s.state.pending = 0
+
+	return summary, true
+}
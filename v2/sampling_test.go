@@ -0,0 +1,164 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// TestSamplingHandlerFirstThereafter tests that the "first N then every Mth"
+// sampler limits records per call-site and that summary records are written.
+func TestSamplingHandlerFirstThereafter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf bytes.Buffer
+		now = timeSource()
+	)
+	handler := NewSamplingHandler(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithSampleFirst(2, 3, time.Second),
+		WithSummaryInterval(time.Minute),
+		WithSamplerTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	log := NewSLogger(handler)
+
+	// Records 1, 2, 5 and 8 should be let through. The logs from the
+	// second call-site are sampled independently.
+	for i := 1; i <= 9; i++ {
+		log.Infof("loop %d", i)
+	}
+	log.Info("other call-site")
+
+	// Once the interval has passed, the first records are let through
+	// again.
+	now = now.Add(time.Second)
+	for i := 1; i <= 2; i++ {
+		log.Infof("loop %d", i)
+	}
+
+	// Once the summary interval has passed, the next record is preceded by
+	// a summary.
+	now = now.Add(time.Minute)
+	log.Warn("after summary interval")
+
+	expectedLog := `[INF]: loop 1
+[INF]: loop 2
+[INF]: loop 5
+[INF]: loop 8
+[INF]: other call-site
+[INF]: loop 1
+[INF]: loop 2
+[INF]: suppressed 5 similar messages
+[WRN]: after summary interval
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+
+	if handler.Suppressed() != 5 {
+		t.Fatalf("Expected 5 suppressed records, got %d",
+			handler.Suppressed())
+	}
+}
+
+// TestSamplingHandlerRateLimit tests the token bucket sampler keyed by
+// message and that each subsystem keeps its own counters.
+func TestSamplingHandlerRateLimit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf bytes.Buffer
+		now = timeSource()
+		ctx = context.Background()
+	)
+	handler := NewSamplingHandler(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithRateLimit(1, 2),
+		WithSampleByMessage(),
+		WithSamplerTimeSource(func() time.Time {
+			return now
+		}),
+	)
+	subHandler := handler.SubSystem("SUBS").(*SamplingHandler)
+	prefixHandler := subHandler.WithPrefix("(Peer)").(*SamplingHandler)
+
+	log := NewSLogger(subHandler)
+	prefixLog := NewSLogger(prefixHandler)
+
+	// The bucket starts with two tokens.
+	log.Info("msg")
+	log.Info("msg")
+	log.Info("msg")
+	log.Info("other msg")
+
+	// The prefixed logger shares the subsystem's sampling state.
+	prefixLog.Info("msg")
+
+	// After one second a single token has been added.
+	now = now.Add(time.Second)
+	log.Info("msg")
+	log.Info("msg")
+
+	if err := subHandler.Summarize(ctx); err != nil {
+		t.Fatalf("Unable to summarize: %v", err)
+	}
+
+	// Summarizing again should be a no-op as nothing was suppressed since.
+	if err := subHandler.Summarize(ctx); err != nil {
+		t.Fatalf("Unable to summarize: %v", err)
+	}
+
+	expectedLog := `[INF] SUBS: msg
+[INF] SUBS: msg
+[INF] SUBS: other msg
+[INF] SUBS: msg
+[INF] SUBS: suppressed 3 similar messages
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+
+	if prefixHandler.Suppressed() != 3 || handler.Suppressed() != 0 {
+		t.Fatalf("Unexpected suppressed counts: subsystem %d, root %d",
+			prefixHandler.Suppressed(), handler.Suppressed())
+	}
+}
+
+// TestSamplingHandlerRecordPC tests that records are keyed by their call-site
+// when they are logged through an slog.Logger and the sampler is wrapped by
+// other handlers.
+func TestSamplingHandlerRecordPC(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	sampler := NewSamplingHandler(
+		NewDefaultHandler(&buf, WithNoTimestamp()),
+		WithSampleFirst(1, 0, time.Hour),
+		WithSummaryInterval(time.Hour),
+	)
+	logger := slog.New(NewMultiHandler(NewMultiHandler(sampler)))
+
+	for i := 0; i < 3; i++ {
+		logger.Info("first call-site")
+		logger.Info("second call-site")
+	}
+
+	expectedLog := `[INF]: first call-site
+[INF]: second call-site
+`
+	if buf.String() != expectedLog {
+		t.Fatalf("Log result mismatch. Expected \n\"%s\", got \n\"%s\"",
+			expectedLog, buf.Bytes())
+	}
+	if sampler.Suppressed() != 4 {
+		t.Fatalf("Expected 4 suppressed records, got %d",
+			sampler.Suppressed())
+	}
+}
@@ -0,0 +1,100 @@
+package btclog
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// sink is the destination of the formatted records of a handler and of all the
+// handlers derived from it. It serialises writes to the underlying writer,
+// counts and reports failed writes and, if configured, writes records to a
+// fallback writer while the primary writer is failing.
+type sink struct {
+	w  io.Writer
+	mu sync.Mutex
+
+	// fallback is written to when a write to w fails. Each record is
+	// first attempted on w so logging returns to w as soon as it recovers.
+	fallback io.Writer
+
+	// errHandler is called with any error returned by w.
+	errHandler func(error)
+
+	// failed is the number of writes to w that have failed.
+	failed atomic.Uint64
+
+	// chain is the HashChainWriter that wraps the underlying writer, if
+	// the handler was created with WithHashChain.
+	chain *HashChainWriter
+}
+
+// newSink creates a new sink that writes to w using the error handling and hash
+// chain settings of the given options.
+func newSink(w io.Writer, opts *handlerOpts) *sink {
+	s := &sink{
+		w:          w,
+		fallback:   opts.fallback,
+		errHandler: opts.errHandler,
+	}
+	if opts.withHashChain {
+		s.chain = NewHashChainWriter(w, opts.hashChain...)
+		s.w = s.chain
+	}
+
+	return s
+}
+
+// checkpoint writes a checkpoint of the hash chain, if any.
+func (s *sink) checkpoint() error {
+	if s.chain == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	err := s.chain.Checkpoint()
+	s.mu.Unlock()
+
+	return err
+}
+
+// write writes a single formatted record. If the write to the primary writer
+// fails, the error handler is called and the record is written to the fallback
+// writer instead. An error is only returned if the record could not be written
+// at all.
+func (s *sink) write(p []byte) error {
+	s.mu.Lock()
+	_, err := s.w.Write(p)
+
+	var wroteFallback bool
+	if err != nil {
+		s.failed.Add(1)
+
+		if s.fallback != nil {
+			_, fallbackErr := s.fallback.Write(p)
+			wroteFallback = fallbackErr == nil
+		}
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+
+	s.reportErr(err)
+	if wroteFallback {
+		return nil
+	}
+
+	return err
+}
+
+// reportErr passes the given error to the error handler, if any.
+//
+// NOTE: this must not be called while holding the mutex as the error handler
+// may itself log.
+func (s *sink) reportErr(err error) {
+	if s.errHandler != nil {
+		s.errHandler(err)
+	}
+}
@@ -0,0 +1,140 @@
+package btclog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// errDiskFull is the error returned by a failingWriter.
+var errDiskFull = errors.New("disk full")
+
+// failingWriter is an io.Writer that fails while its fail field is set.
+type failingWriter struct {
+	bytes.Buffer
+	fail bool
+}
+
+// Write writes p to the buffer or returns errDiskFull if the writer is set to
+// fail.
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.fail {
+		return 0, errDiskFull
+	}
+
+	return w.Buffer.Write(p)
+}
+
+// TestHandlerWriteErrors tests that failed writes are counted, reported and
+// written to the fallback writer and that logging returns to the primary
+// writer once it recovers.
+func TestHandlerWriteErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		handlerFunc   func(w io.Writer, opts ...HandlerOption) Handler
+		expectedLog   string
+		expectedFalls string
+	}{
+		{
+			name: "default handler",
+			handlerFunc: func(w io.Writer,
+				opts ...HandlerOption) Handler {
+
+				return NewDefaultHandler(w, opts...)
+			},
+			expectedLog:   "[INF] SUBS: before\n[INF] SUBS: after\n",
+			expectedFalls: "[INF] SUBS: failed 1\n[INF]: failed 2\n",
+		},
+		{
+			name: "json handler",
+			handlerFunc: func(w io.Writer,
+				opts ...HandlerOption) Handler {
+
+				return NewJSONHandler(w, opts...)
+			},
+			expectedLog: `{"level":"INF","subsystem":"SUBS","msg":"before"}
+{"level":"INF","subsystem":"SUBS","msg":"after"}
+`,
+			expectedFalls: `{"level":"INF","subsystem":"SUBS","msg":"failed 1"}
+{"level":"INF","msg":"failed 2"}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				w        failingWriter
+				fallback bytes.Buffer
+				errs     []error
+			)
+			handler := test.handlerFunc(
+				&w, WithNoTimestamp(),
+				WithFallbackWriter(&fallback),
+				WithErrorHandler(func(err error) {
+					errs = append(errs, err)
+				}),
+			)
+			log := NewSLogger(handler.SubSystem("SUBS"))
+
+			log.Info("before")
+
+			// Handlers derived from the same handler share the
+			// writer and so the count of failed writes.
+			w.fail = true
+			log.Info("failed 1")
+			NewSLogger(handler).Info("failed 2")
+
+			w.fail = false
+			log.Info("after")
+
+			if w.String() != test.expectedLog {
+				t.Fatalf("Log result mismatch. Expected \n\"%s\", "+
+					"got \n\"%s\"", test.expectedLog, w.String())
+			}
+			if fallback.String() != test.expectedFalls {
+				t.Fatalf("Fallback result mismatch. Expected "+
+					"\n\"%s\", got \n\"%s\"", test.expectedFalls,
+					fallback.String())
+			}
+
+			failed := handler.(interface{ FailedWrites() uint64 })
+			if failed.FailedWrites() != 2 {
+				t.Fatalf("Expected 2 failed writes, got %d",
+					failed.FailedWrites())
+			}
+			if len(errs) != 2 || !errors.Is(errs[0], errDiskFull) {
+				t.Fatalf("Unexpected reported errors: %v", errs)
+			}
+		})
+	}
+}
+
+// TestHandlerWriteErrorNoFallback tests that the write error is returned when
+// there is no fallback writer.
+func TestHandlerWriteErrorNoFallback(t *testing.T) {
+	t.Parallel()
+
+	w := &failingWriter{fail: true}
+	handler := NewDefaultHandler(w, WithNoTimestamp())
+
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "failed", 0)
+	err := handler.Handle(context.Background(), r)
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("Expected %v, got %v", errDiskFull, err)
+	}
+
+	if handler.FailedWrites() != 1 {
+		t.Fatalf("Expected 1 failed write, got %d",
+			handler.FailedWrites())
+	}
+}
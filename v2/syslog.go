@@ -0,0 +1,822 @@
+package btclog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btclog"
+)
+
+// SyslogFacility is the facility of the messages written by a SyslogHandler.
+type SyslogFacility int
+
+// The syslog facilities that are commonly used by applications.
+const (
+	FacilityUser   SyslogFacility = 1
+	FacilityDaemon SyslogFacility = 3
+	FacilityLocal0 SyslogFacility = 16
+	FacilityLocal1 SyslogFacility = 17
+	FacilityLocal2 SyslogFacility = 18
+	FacilityLocal3 SyslogFacility = 19
+	FacilityLocal4 SyslogFacility = 20
+	FacilityLocal5 SyslogFacility = 21
+	FacilityLocal6 SyslogFacility = 22
+	FacilityLocal7 SyslogFacility = 23
+)
+
+// DefaultSyslogSDID is the default ID of the structured data element that
+// holds the attributes of a record. It uses the private enterprise number that
+// RFC 5612 reserves for documentation, so it should be replaced with an ID
+// under the operator's own enterprise number if the structured data is
+// processed by other systems.
+const DefaultSyslogSDID = "attrs@32473"
+
+// DefaultSyslogBufferSize is the default maximum total size, in bytes, of the
+// messages that a SyslogHandler buffers while it reconnects.
+const DefaultSyslogBufferSize = 1 << 20
+
+const (
+	// syslogMinBackoff is the time that is waited after the first failed
+	// attempt to reconnect to the syslog daemon. It is doubled after each
+	// further failed attempt, up to syslogMaxBackoff.
+	syslogMinBackoff = 100 * time.Millisecond
+
+	// syslogMaxBackoff is the maximum time that is waited between attempts
+	// to reconnect to the syslog daemon.
+	syslogMaxBackoff = 30 * time.Second
+)
+
+// syslogSeverity maps the btclog levels to syslog severities. There is no
+// syslog severity below debug so both the trace and debug levels map to debug.
+// Levels registered with RegisterLevel use the syslog severity of the closest
+// built-in level below them.
+var syslogSeverity = map[btclog.Level]int{
+	btclog.LevelTrace:    7,
+	btclog.LevelDebug:    7,
+	btclog.LevelInfo:     6,
+	btclog.LevelWarn:     4,
+	btclog.LevelError:    3,
+	btclog.LevelCritical: 2,
+}
+
+// syslogTimeFormat is the RFC 5424 timestamp format, which is limited to
+// microsecond precision.
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// localSyslogPaths are the paths at which the local syslog daemon commonly
+// listens.
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogOption is the signature of a functional option that can be used to
+// modify the behaviour of a SyslogHandler.
+type SyslogOption func(*syslogOpts)
+
+// syslogOpts holds options that can be modified by a SyslogOption.
+type syslogOpts struct {
+	facility SyslogFacility
+	appName  string
+	hostname string
+	sdID     string
+
+	// timeSource is used to obtain the timestamp of a message, if not set
+	// then the record time is used.
+	timeSource func() time.Time
+
+	// errHandler is called with any error returned when writing a message.
+	errHandler func(error)
+
+	// dialTimeout is the timeout of each connection attempt.
+	dialTimeout time.Duration
+
+	// writeTimeout is the timeout of each write.
+	writeTimeout time.Duration
+
+	// bufferSize is the maximum total size of the messages that are
+	// buffered while reconnecting.
+	bufferSize int
+
+	// criticalExit, if set, exits the process after a critical record is
+	// handled.
+	criticalExit *CriticalExit
+}
+
+// WithSyslogFacility sets the facility of the messages. It defaults to
+// FacilityDaemon.
+func WithSyslogFacility(facility SyslogFacility) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.facility = facility
+	}
+}
+
+// WithSyslogAppName sets the APP-NAME of the messages. It defaults to the name
+// of the executable.
+func WithSyslogAppName(name string) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.appName = name
+	}
+}
+
+// WithSyslogHostname sets the HOSTNAME of the messages. It defaults to the
+// host name reported by the kernel.
+func WithSyslogHostname(hostname string) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.hostname = hostname
+	}
+}
+
+// WithSyslogSDID sets the ID of the structured data element that holds the
+// attributes of each record. It defaults to DefaultSyslogSDID.
+func WithSyslogSDID(id string) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.sdID = id
+	}
+}
+
+// WithSyslogTimeSource can be used to overwrite the time sourced from the slog
+// Record.
+func WithSyslogTimeSource(fn func() time.Time) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.timeSource = fn
+	}
+}
+
+// WithSyslogErrorHandler sets a call-back that is called with any error
+// returned when writing a message. The call-back may itself log.
+func WithSyslogErrorHandler(fn func(error)) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.errHandler = fn
+	}
+}
+
+// WithSyslogWriteTimeout sets the time after which a write to the syslog daemon
+// fails if the daemon isn't reading its messages, so that logging doesn't block
+// indefinitely. It defaults to five seconds and a zero timeout disables it.
+func WithSyslogWriteTimeout(timeout time.Duration) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.writeTimeout = timeout
+	}
+}
+
+// WithSyslogBufferSize sets the maximum total size, in bytes, of the messages
+// that are buffered while the connection to the syslog daemon is re-established.
+// Messages that don't fit are dropped and reported as failed writes. It
+// defaults to DefaultSyslogBufferSize and a zero size disables buffering.
+func WithSyslogBufferSize(size int) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.bufferSize = size
+	}
+}
+
+// WithSyslogCriticalExit causes the handler to exit the process with the given
+// CriticalExit after it has handled a record at the critical level or above,
+// as described for WithCriticalExit.
+func WithSyslogCriticalExit(c *CriticalExit) SyslogOption {
+	return func(opts *syslogOpts) {
+		opts.criticalExit = c
+	}
+}
+
+// SyslogHandler is a Handler that formats records as RFC 5424 syslog messages
+// and writes them to a syslog daemon. The subsystem tag of a record is used as
+// the MSGID, the prefix is prepended to the message and the attributes are
+// written as the parameters of a single structured data element, with the
+// keys of grouped attributes in dotted form.
+//
+// Messages are written to a Unix datagram socket or UDP as one message per
+// datagram and to TCP or a Unix stream socket with octet-counted framing as
+// described in RFC 6587. If a write fails, the handler reconnects in the
+// background, waiting with an exponential backoff between failed attempts, so
+// that logging resumes once the daemon is restarted. The failed message and any
+// messages logged while reconnecting are buffered, see WithSyslogBufferSize,
+// and written once the connection has been re-established. The exception is a
+// write that fails after part of a message was written to a stream connection,
+// e.g. because the write timeout passed, in which case the message is not
+// retried, as the daemon may have received enough of it to log it.
+//
+// As with the DefaultHandler, handlers created with SubSystem have an
+// independent level, while handlers created with WithPrefix share the level of
+// their parent. All derived handlers share the connection.
+type SyslogHandler struct {
+	level *levelNode
+
+	opts *syslogOpts
+	sink *sink
+
+	tag    string
+	prefix string
+
+	// groupPrefix is the dotted path of any groups added via WithGroup,
+	// including a trailing dot.
+	groupPrefix string
+
+	fields []slog.Attr
+}
+
+// A compile-time check to ensure that SyslogHandler implements Handler.
+var _ Handler = (*SyslogHandler)(nil)
+
+// NewSyslogHandler creates a new SyslogHandler that writes to the syslog daemon
+// at the given address. The network is one of "unixgram", "unix", "udp" or
+// "tcp" and their variants. If the network is empty, the local syslog daemon
+// is used. An error is returned if the initial connection fails.
+func NewSyslogHandler(network, addr string,
+	options ...SyslogOption) (*SyslogHandler, error) {
+
+	opts := &syslogOpts{
+		facility:     FacilityDaemon,
+		appName:      filepath.Base(os.Args[0]),
+		sdID:         DefaultSyslogSDID,
+		dialTimeout:  5 * time.Second,
+		writeTimeout: 5 * time.Second,
+		bufferSize:   DefaultSyslogBufferSize,
+	}
+	opts.hostname, _ = os.Hostname()
+	for _, o := range options {
+		o(opts)
+	}
+
+	conn := newSyslogConn(network, addr, opts)
+	netConn, framed, err := conn.dial()
+	if err != nil {
+		return nil, err
+	}
+	conn.conn, conn.framed = netConn, framed
+
+	handler := &SyslogHandler{
+		level: newLevelNode(int64(levelInfo)),
+		opts:  opts,
+		sink:  &sink{w: conn, errHandler: opts.errHandler},
+	}
+
+	return handler, nil
+}
+
+// Close closes the connection to the syslog daemon. Records that are logged
+// through the handler, or any handler derived from it, after it is closed are
+// not written.
+func (s *SyslogHandler) Close() error {
+	return s.sink.w.(*syslogConn).close()
+}
+
+// FailedWrites returns the number of messages that could not be written. The
+// count is shared by all handlers derived from the same NewSyslogHandler call.
+func (s *SyslogHandler) FailedWrites() uint64 {
+	return s.sink.failed.Load()
+}
+
+// Level returns the current logging level of the Handler.
+//
+// NOTE: This is part of the Handler interface.
+func (s *SyslogHandler) Level() btclog.Level {
+	return fromSlogLevel(slog.Level(s.level.Load()))
+}
+
+// SetLevel changes the logging level of the Handler to the passed
+// level.
+//
+// NOTE: This is part of the Handler interface.
+func (s *SyslogHandler) SetLevel(level btclog.Level) {
+	s.level.Store(int64(toSlogLevel(level)))
+}
+
+// Enabled reports whether the handler handles records at the given level. A
+// level override carried by the context, see WithLevelOverride, can lower the
+// level of the handler but not raise it.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SyslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if s.opts.criticalExit.exitsAt(level) {
+		return true
+	}
+
+	return enabledAt(ctx, s.level.Load(), level)
+}
+
+// criticalExits returns the CriticalExits that are run after the handler has
+// handled a record at the given level.
+//
+// NOTE: this is part of the criticalExiter interface.
+func (s *SyslogHandler) criticalExits(level slog.Level) []*CriticalExit {
+	return s.opts.criticalExit.exits(level)
+}
+
+// Handle formats the record as an RFC 5424 message and writes it.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SyslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if s.opts.criticalExit.exitsAt(r.Level) {
+		defer s.opts.criticalExit.handled(ctx)
+
+		if !enabledAt(ctx, s.level.Load(), r.Level) {
+			return nil
+		}
+	}
+
+	buf := newBuffer()
+	defer buf.free()
+
+	// PRI and VERSION.
+	severity := syslogSeverity[builtinLevel(r.Level)]
+	buf.writeByte('<')
+	itoa(buf, int(s.opts.facility)*8+severity, -1)
+	buf.writeString(">1 ")
+
+	// TIMESTAMP.
+	t := r.Time
+	if s.opts.timeSource != nil {
+		t = s.opts.timeSource()
+	}
+	if t.IsZero() {
+		buf.writeByte('-')
+	} else {
+		*buf = t.AppendFormat(*buf, syslogTimeFormat)
+	}
+
+	// HOSTNAME, APP-NAME, PROCID and MSGID.
+	writeSyslogHeaderField(buf, s.opts.hostname, 255)
+	writeSyslogHeaderField(buf, s.opts.appName, 48)
+	writeSyslogHeaderField(buf, strconv.Itoa(os.Getpid()), 128)
+	writeSyslogHeaderField(buf, s.tag, 32)
+
+	// STRUCTURED-DATA.
+	sd := newBuffer()
+	defer sd.free()
+	for _, attr := range s.fields {
+		appendSyslogParam(sd, attr, "", 0)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		appendSyslogParam(sd, a, s.groupPrefix, 0)
+		return true
+	})
+	buf.writeByte(' ')
+	if len(*sd) == 0 {
+		buf.writeByte('-')
+	} else {
+		buf.writeByte('[')
+		buf.writeString(s.opts.sdID)
+		buf.writeBytes(*sd)
+		buf.writeByte(']')
+	}
+
+	// MSG.
+	msg := r.Message
+	if s.prefix != "" {
+		msg = strings.TrimSuffix(s.prefix+" "+msg, " ")
+	}
+	if msg != "" {
+		buf.writeByte(' ')
+		buf.writeString(msg)
+	}
+
+	return s.sink.write(*buf)
+}
+
+// WithAttrs returns a new Handler with the given attributes added.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SyslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return s
+	}
+
+	// If any groups are active, then the attributes are stored as a single
+	// group attribute so that their keys are qualified by the group path.
+	if s.groupPrefix != "" {
+		attrs = []slog.Attr{{
+			Key:   strings.TrimSuffix(s.groupPrefix, "."),
+			Value: slog.GroupValue(attrs...),
+		}}
+	}
+
+	return s.with(s.tag, s.prefix, true, attrs...)
+}
+
+// WithGroup returns a new Handler with the given group appended to the
+// receiver's existing groups.
+//
+// NOTE: this is part of the slog.Handler interface.
+func (s *SyslogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return s
+	}
+
+	sl := s.with(s.tag, s.prefix, true)
+	sl.groupPrefix += name + "."
+
+	return sl
+}
+
+// SubSystem returns a copy of the given handler but with the new tag, which is
+// used as the MSGID. All attributes added with WithAttrs will be kept but all
+// groups added with WithGroup are lost.
+//
+// NOTE: this creates a new logger with an independent log level. This
+// means that SetLevel needs to be called on the new logger to change
+// the level as any changes to the parent logger's level after creation
+// will not be inherited by the new logger.
+//
+// NOTE: this is part of the Handler interface.
+func (s *SyslogHandler) SubSystem(tag string) Handler {
+	sl := s.with(tag, s.prefix, false)
+	sl.groupPrefix = ""
+
+	return sl
+}
+
+// WithPrefix returns a copy of the Handler but with the given string prefixed
+// to each log message. Note that the subsystem of the original logger is kept
+// but any existing prefix is overridden.
+//
+// NOTE: this creates a new logger with an inherited log level. This
+// means that if SetLevel is called on the parent logger, then this new
+// level will be inherited by the new logger
+//
+// NOTE: this is part of the Handler interface.
+func (s *SyslogHandler) WithPrefix(prefix string) Handler {
+	return s.with(s.tag, prefix, true)
+}
+
+// with returns a new handler with the given tag, prefix and attributes added.
+// If shareLevel is false, the new handler has an independent copy of the level.
+func (s *SyslogHandler) with(tag, prefix string, shareLevel bool,
+	attrs ...slog.Attr) *SyslogHandler {
+
+	sl := *s
+	sl.fields = append(
+		make([]slog.Attr, 0, len(s.fields)+len(attrs)), s.fields...,
+	)
+	sl.fields = append(sl.fields, attrs...)
+	sl.tag = tag
+	sl.prefix = prefix
+
+	if !shareLevel {
+		sl.level = s.level.derive(false)
+	}
+
+	return &sl
+}
+
+// writeSyslogHeaderField writes a space followed by the given header field,
+// with any characters that are not printable US-ASCII replaced and truncated
+// to the given maximum length. An empty field is written as the NILVALUE.
+func writeSyslogHeaderField(buf *buffer, field string, maxLen int) {
+	buf.writeByte(' ')
+	if field == "" {
+		buf.writeByte('-')
+		return
+	}
+
+	if len(field) > maxLen {
+		field = field[:maxLen]
+	}
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c < '!' || c > '~' {
+			c = '_'
+		}
+		buf.writeByte(c)
+	}
+}
+
+// appendSyslogParam writes the given attribute to the buffer as one or more
+// SD-PARAMs. The key is qualified with the given dotted group prefix and group
+// attributes are flattened.
+func appendSyslogParam(buf *buffer, a slog.Attr, prefix string, depth int) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		buf.writeByte(' ')
+		writeSDName(buf, prefix+a.Key)
+		buf.writeString(`="`)
+		writeSDValue(buf, a.Value.String())
+		buf.writeByte('"')
+
+		return
+	}
+
+	attrs := a.Value.Group()
+	if len(attrs) == 0 || depth >= maxAttrDepth {
+		return
+	}
+
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range attrs {
+		appendSyslogParam(buf, ga, prefix, depth+1)
+	}
+}
+
+// writeSDName writes the given key as an SD-NAME, which is limited to 32
+// printable US-ASCII characters other than '=', ' ', ']' and '"'. Any other
+// characters are replaced.
+func writeSDName(buf *buffer, key string) {
+	if key == "" {
+		key = "_"
+	}
+	if len(key) > 32 {
+		key = key[:32]
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c < '!' || c > '~' || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf.writeByte(c)
+	}
+}
+
+// writeSDValue writes the given string as a PARAM-VALUE, escaping the
+// characters '"', '\' and ']'.
+func writeSDValue(buf *buffer, value string) {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			buf.writeByte('\\')
+			buf.writeByte(c)
+		default:
+			buf.writeByte(c)
+		}
+	}
+}
+
+// syslogConn is a connection to a syslog daemon that reconnects on failure.
+// Once a write fails, the connection is re-established in the background with
+// an exponential backoff, and messages are buffered until it is.
+type syslogConn struct {
+	network      string
+	addr         string
+	timeout      time.Duration
+	writeTimeout time.Duration
+	bufferSize   int
+
+	// quit is closed when the connection is closed to stop reconnecting.
+	quit chan struct{}
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+
+	// framed is true if messages are written with octet-counted framing,
+	// which is the case for stream connections.
+	framed bool
+
+	// reconnecting is true while the connection is re-established in the
+	// background.
+	reconnecting bool
+
+	// pending holds the messages that were written while disconnected, and
+	// pendingSize is their total size.
+	pending     [][]byte
+	pendingSize int
+
+	// dialErr is the error of the last failed connection attempt.
+	dialErr error
+}
+
+// newSyslogConn creates a new syslogConn that is not connected yet.
+func newSyslogConn(network, addr string, opts *syslogOpts) *syslogConn {
+	return &syslogConn{
+		network:      network,
+		addr:         addr,
+		timeout:      opts.dialTimeout,
+		writeTimeout: opts.writeTimeout,
+		bufferSize:   opts.bufferSize,
+		quit:         make(chan struct{}),
+	}
+}
+
+// dial connects to the syslog daemon and returns the connection and whether
+// messages are written to it with octet-counted framing. The mutex must not be
+// held, since connecting may take up to the dial timeout.
+func (c *syslogConn) dial() (net.Conn, bool, error) {
+	if c.network != "" {
+		conn, err := net.DialTimeout(c.network, c.addr, c.timeout)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return conn, isStreamNetwork(c.network), nil
+	}
+
+	// Find the local syslog daemon, which listens on a datagram or
+	// stream socket depending on the system.
+	paths := localSyslogPaths
+	if c.addr != "" {
+		paths = []string{c.addr}
+	}
+	for _, path := range paths {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, path, c.timeout)
+			if err != nil {
+				continue
+			}
+
+			return conn, network == "unix", nil
+		}
+	}
+
+	return nil, false, errors.New("unix syslog delivery error")
+}
+
+// Write writes a single message. If the write fails without having written any
+// part of the message, or the connection is being re-established, the message
+// is buffered and written once the connection has been re-established. An
+// error is returned if the buffer is full.
+//
+// This is part of the io.Writer interface implementation.
+func (c *syslogConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	if c.conn != nil {
+		n, err := c.write(p)
+		if err == nil {
+			return len(p), nil
+		}
+		c.disconnect()
+
+		// The framing of a stream connection is broken once part of
+		// a message has been written, so the connection can't be used
+		// any more. The message isn't retried as the daemon may
+		// already have logged the part that it received.
+		if c.framed && n > 0 {
+			return 0, err
+		}
+	}
+
+	if c.pendingSize+len(p) > c.bufferSize {
+		if c.dialErr != nil {
+			return 0, fmt.Errorf("%w: %w", errSyslogDisconnected,
+				c.dialErr)
+		}
+
+		return 0, errSyslogDisconnected
+	}
+	c.pending = append(c.pending, append([]byte(nil), p...))
+	c.pendingSize += len(p)
+
+	return len(p), nil
+}
+
+// errSyslogDisconnected is returned when a message is dropped because the
+// connection to the syslog daemon is being re-established and the buffer is
+// full.
+var errSyslogDisconnected = errors.New("syslog daemon disconnected, " +
+	"message dropped")
+
+// disconnect closes the current connection and starts re-establishing it in
+// the background, unless that is already the case. The mutex must be held.
+func (c *syslogConn) disconnect() {
+	c.conn.Close()
+	c.conn = nil
+
+	if !c.reconnecting {
+		c.reconnecting = true
+		go c.reconnect()
+	}
+}
+
+// reconnect re-establishes the connection, waiting with an exponential backoff
+// between failed attempts, and writes the buffered messages to it. It returns
+// once all buffered messages have been written, or the connection is closed.
+func (c *syslogConn) reconnect() {
+	backoff := syslogMinBackoff
+	for {
+		conn, framed, err := c.dial()
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			if conn != nil {
+				conn.Close()
+			}
+
+			return
+		}
+
+		c.dialErr = err
+		if err == nil {
+			c.conn, c.framed = conn, framed
+			if c.flush() {
+				c.reconnecting = false
+				c.mu.Unlock()
+
+				return
+			}
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-time.After(backoff):
+		case <-c.quit:
+			return
+		}
+
+		backoff *= 2
+		if backoff > syslogMaxBackoff {
+			backoff = syslogMaxBackoff
+		}
+	}
+}
+
+// flush writes the buffered messages to the current connection and returns
+// true if all of them were written. If a write fails, the connection is closed
+// and the message is kept unless part of it was written to a stream connection,
+// in which case it is dropped. The mutex must be held.
+func (c *syslogConn) flush() bool {
+	for len(c.pending) > 0 {
+		p := c.pending[0]
+		n, err := c.write(p)
+		if err != nil {
+			c.conn.Close()
+			c.conn = nil
+
+			if !c.framed || n == 0 {
+				return false
+			}
+		}
+
+		c.pending[0] = nil
+		c.pending = c.pending[1:]
+		c.pendingSize -= len(p)
+
+		if err != nil {
+			return false
+		}
+	}
+	c.pending = nil
+
+	return true
+}
+
+// write writes the message to the current connection and returns the number of
+// bytes written, including any framing. The mutex must be held.
+func (c *syslogConn) write(p []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		deadline := time.Now().Add(c.writeTimeout)
+		if err := c.conn.SetWriteDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+
+	if !c.framed {
+		return c.conn.Write(p)
+	}
+
+	frame := make([]byte, 0, len(p)+8)
+	frame = strconv.AppendInt(frame, int64(len(p)), 10)
+	frame = append(frame, ' ')
+
+	return c.conn.Write(append(frame, p...))
+}
+
+// close closes the connection and stops re-establishing it. Any buffered
+// messages are dropped.
+func (c *syslogConn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.quit)
+
+	c.pending = nil
+	c.pendingSize = 0
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
+
+// isStreamNetwork returns true if the given network is stream oriented.
+func isStreamNetwork(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,423 @@
+package btclog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testSyslogOpts are the options used by the syslog tests to make the messages
+// deterministic.
+var testSyslogOpts = []SyslogOption{
+	WithSyslogAppName("btcd"),
+	WithSyslogHostname("host"),
+	WithSyslogTimeSource(func() time.Time {
+		return time.Date(2009, time.January, 3, 12, 0, 0, 5000, time.UTC)
+	}),
+}
+
+// TestSyslogFormat tests that records are formatted according to RFC 5424.
+func TestSyslogFormat(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer conn.Close()
+
+	handler, err := NewSyslogHandler(
+		"udp", conn.LocalAddr().String(), testSyslogOpts...,
+	)
+	if err != nil {
+		t.Fatalf("Unable to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	header := func(pri int, msgID string) string {
+		return fmt.Sprintf("<%d>1 2009-01-03T12:00:00.000005Z host btcd "+
+			"%d %s", pri, os.Getpid(), msgID)
+	}
+
+	log := NewSLogger(handler)
+	log.SetLevel(LevelTrace)
+	peerLog := log.SubSystem("PEER").WithPrefix("(inbound)")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		log      func()
+		expected string
+	}{
+		{
+			name: "no attributes",
+			log: func() {
+				log.Info("Starting")
+			},
+			expected: header(30, "-") + " - Starting",
+		},
+		{
+			name: "trace maps to debug",
+			log: func() {
+				log.Trace("Details")
+			},
+			expected: header(31, "-") + " - Details",
+		},
+		{
+			name: "subsystem, prefix and attributes",
+			log: func() {
+				peerLog.WarnS(ctx, "Slow", nil, "addr", "1.2.3.4",
+					"ms", 250)
+			},
+			expected: header(28, "PEER") + ` [attrs@32473 ` +
+				`addr="1.2.3.4" ms="250"] (inbound) Slow`,
+		},
+		{
+			name: "groups and escaping",
+			log: func() {
+				log.With("id", 1).WithGroup("conn").CriticalS(
+					ctx, "Failed", errors.New(`a "b" ]`),
+					"bad key", `c\d`,
+				)
+			},
+			expected: header(26, "-") + ` [attrs@32473 id="1" ` +
+				`conn.err="a \"b\" \]" conn.bad_key="c\\d"] Failed`,
+		},
+	}
+
+	buf := make([]byte, 2048)
+	for _, test := range tests {
+		test.log()
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("%s: unable to read: %v", test.name, err)
+		}
+
+		if string(buf[:n]) != test.expected {
+			t.Fatalf("%s: Log result mismatch. Expected \n\"%s\", "+
+				"got \n\"%s\"", test.name, test.expected, buf[:n])
+		}
+	}
+}
+
+// TestSyslogTCP tests that messages are written to a stream connection with
+// octet-counted framing and that the handler reconnects once the connection
+// has failed.
+func TestSyslogTCP(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer ln.Close()
+
+	handler, err := NewSyslogHandler(
+		"tcp", ln.Addr().String(), testSyslogOpts...,
+	)
+	if err != nil {
+		t.Fatalf("Unable to create handler: %v", err)
+	}
+	defer handler.Close()
+	log := NewSLogger(handler)
+
+	readFrame := func(r *bufio.Reader) string {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("Unable to read frame: %v", err)
+		}
+		n, err := strconv.Atoi(length[:len(length)-1])
+		if err != nil {
+			t.Fatalf("Invalid frame length %q", length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatalf("Unable to read frame: %v", err)
+		}
+
+		return string(msg)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	log.Info("one")
+	log.Info("two")
+	r := bufio.NewReader(conn)
+	for _, expected := range []string{"one", "two"} {
+		msg := readFrame(r)
+		if msg[len(msg)-len(expected):] != expected {
+			t.Fatalf("Expected message %q, got %q", expected, msg)
+		}
+	}
+
+	// Once the daemon closes the connection, writes fail after the
+	// connection is reset and the handler reconnects. Messages written
+	// before the failure is detected are lost.
+	conn.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		log.Info("three")
+
+		select {
+		case conn := <-accepted:
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			msg := readFrame(bufio.NewReader(conn))
+			if msg[len(msg)-len("three"):] != "three" {
+				t.Fatalf("Unexpected message %q", msg)
+			}
+			return
+
+		case <-deadline:
+			t.Fatalf("Handler did not reconnect")
+
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// TestSyslogUnixReconnect tests that the handler reconnects to a Unix datagram
+// socket once the daemon is restarted, without losing messages.
+func TestSyslogUnixReconnect(t *testing.T) {
+	t.Parallel()
+
+	// Unix socket paths are limited in length so the socket is not
+	// created in the test's temporary directory.
+	dir, err := os.MkdirTemp("", "syslog")
+	if err != nil {
+		t.Fatalf("Unable to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	var errs []error
+	handler, err := NewSyslogHandler("", path, append(
+		testSyslogOpts, WithSyslogErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)...)
+	if err != nil {
+		t.Fatalf("Unable to create handler: %v", err)
+	}
+	defer handler.Close()
+	log := NewSLogger(handler)
+
+	read := func(conn net.PacketConn, expected string) {
+		buf := make([]byte, 2048)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Unable to read: %v", err)
+		}
+		msg := string(buf[:n])
+		if msg[len(msg)-len(expected):] != expected {
+			t.Fatalf("Expected message %q, got %q", expected, msg)
+		}
+	}
+
+	log.Info("one")
+	read(conn, "one")
+
+	// Restart the daemon.
+	conn.Close()
+	os.Remove(path)
+	conn, err = net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer conn.Close()
+
+	log.Info("two")
+	read(conn, "two")
+
+	// While the daemon is down, messages are buffered and written once it
+	// is restarted.
+	conn.Close()
+	os.Remove(path)
+	log.Info("three")
+	log.Info("four")
+
+	conn, err = net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer conn.Close()
+
+	read(conn, "three")
+	read(conn, "four")
+	if len(errs) != 0 || handler.FailedWrites() != 0 {
+		t.Fatalf("Expected no failed writes, got %d errors and %d "+
+			"failed writes", len(errs), handler.FailedWrites())
+	}
+}
+
+// TestSyslogWriteTimeout tests that writes to a daemon that doesn't read its
+// messages fail once the write timeout has passed rather than blocking.
+func TestSyslogWriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer ln.Close()
+
+	var errs []error
+	handler, err := NewSyslogHandler("tcp", ln.Addr().String(), append(
+		testSyslogOpts, WithSyslogWriteTimeout(50*time.Millisecond),
+		WithSyslogErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}),
+	)...)
+	if err != nil {
+		t.Fatalf("Unable to create handler: %v", err)
+	}
+	defer handler.Close()
+	log := NewSLogger(handler)
+
+	// Accept connections but never read from them, so that the writes
+	// block once the socket buffers are full.
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	msg := string(make([]byte, 1<<20))
+	deadline := time.Now().Add(5 * time.Second)
+	for handler.FailedWrites() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Writes did not time out")
+		}
+		log.Info(msg)
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", errs)
+	}
+}
+
+// errShortWrite is the error returned by a shortConn.
+var errShortWrite = errors.New("short write")
+
+// shortConn is a net.Conn that writes half of each message before failing.
+type shortConn struct {
+	net.Conn
+	closed bool
+}
+
+// Write returns errShortWrite after pretending to write half of p.
+func (c *shortConn) Write(p []byte) (int, error) {
+	return len(p) / 2, errShortWrite
+}
+
+// SetWriteDeadline does nothing.
+func (c *shortConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Close marks the connection as closed.
+func (c *shortConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// TestSyslogPartialWrite tests that a connection is closed without retrying the
+// message once part of a message was written to a stream connection.
+func TestSyslogPartialWrite(t *testing.T) {
+	t.Parallel()
+
+	// The address can't be connected to, so the connection isn't
+	// re-established.
+	conn := &shortConn{}
+	c := newSyslogConn("tcp", "127.0.0.1:0", &syslogOpts{
+		dialTimeout:  time.Second,
+		writeTimeout: time.Second,
+		bufferSize:   DefaultSyslogBufferSize,
+	})
+	defer c.close()
+	c.conn, c.framed = conn, true
+
+	if _, err := c.Write([]byte("message")); !errors.Is(err, errShortWrite) {
+		t.Fatalf("Expected %v, got %v", errShortWrite, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !conn.closed || c.conn != nil || len(c.pending) != 0 {
+		t.Fatalf("Expected the connection to be closed without " +
+			"buffering the message")
+	}
+}
+
+// TestSyslogBuffer tests that messages are buffered while the connection is
+// re-established and dropped once the buffer is full.
+func TestSyslogBuffer(t *testing.T) {
+	t.Parallel()
+
+	// The address can't be connected to, so the connection isn't
+	// re-established.
+	conn := &shortConn{}
+	c := newSyslogConn("udp", "127.0.0.1:0", &syslogOpts{
+		dialTimeout:  time.Second,
+		writeTimeout: time.Second,
+		bufferSize:   10,
+	})
+	defer c.close()
+	c.conn = conn
+
+	if _, err := c.Write([]byte("message")); err != nil {
+		t.Fatalf("Expected the message to be buffered, got %v", err)
+	}
+	_, err := c.Write([]byte("message"))
+	if !errors.Is(err, errSyslogDisconnected) {
+		t.Fatalf("Expected %v, got %v", errSyslogDisconnected, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !conn.closed || len(c.pending) != 1 || c.pendingSize != 7 {
+		t.Fatalf("Expected a single buffered message, got %d",
+			len(c.pending))
+	}
+}
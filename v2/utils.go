@@ -68,10 +68,22 @@ func writeTimestamp(buf *buffer, t time.Time) {
 }
 
 // callsite returns the file name and line number of the callsite to the
-// subsystem logger.
-func callsite(flag uint32, skipDepth int) (string, int) {
-	_, file, line, ok := runtime.Caller(skipDepth)
-	if !ok {
+// subsystem logger, which is identified by the given PC of the record. If the
+// skip depth exceeds DefaultSkipDepth, the callsite is that many frames further
+// up the stack, provided that the record is handled synchronously. An empty
+// file name is returned for a record without a PC, such as a summary written by
+// a DedupHandler or a SamplingHandler.
+func callsite(flag uint32, pc uintptr, skipDepth int) (string, int) {
+	if pc == 0 {
+		return "", 0
+	}
+	if skipDepth > DefaultSkipDepth {
+		pc = ascend(pc, skipDepth-DefaultSkipDepth)
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	file, line := frame.File, frame.Line
+	if file == "" {
 		return "???", 0
 	}
 	if flag&Lshortfile != 0 {
@@ -87,6 +99,27 @@ func callsite(flag uint32, skipDepth int) (string, int) {
 	return file, line
 }
 
+// ascend returns the PC of the frame that is the given number of frames above
+// the frame of the given PC on the current stack. The PC is returned as is if
+// it is not on the current stack, which is the case for records that are
+// handled asynchronously.
+func ascend(pc uintptr, frames int) uintptr {
+	var pcs [64]uintptr
+	n := runtime.Callers(3, pcs[:])
+	for i := 0; i < n; i++ {
+		if pcs[i] != pc {
+			continue
+		}
+		if i+frames < n {
+			return pcs[i+frames]
+		}
+
+		break
+	}
+
+	return pc
+}
+
 // Copied from log/slog/text_handler.go.
 //
 // needsQuoting returns true if the given strings should be wrapped in quotes.